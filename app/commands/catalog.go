@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"ecommerce/app/crud"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"os"
+)
+
+// Run runs a command line tool instead of the API server, e.g. `catalog import -branch 1 menu.csv`
+func Run(db *gorm.DB, args []string) error {
+	switch args[0] {
+	case "catalog":
+		return runCatalog(db, args[1:])
+	}
+	return fmt.Errorf("unknown command %q, the commands are: catalog", args[0])
+}
+
+func runCatalog(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: catalog import|export [flags]")
+	}
+	switch args[0] {
+	case "import":
+		return importCatalog(db, args[1:])
+	case "export":
+		return exportCatalog(db, args[1:])
+	}
+	return fmt.Errorf("unknown catalog command %q, use import or export", args[0])
+}
+
+// importCatalog imports a catalog file, or the standard input for -, and prints the import report.
+// It fails when some rows have errors so scripts can stop on it.
+func importCatalog(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("catalog import", flag.ContinueOnError)
+	branchID := flags.Uint("branch", 0, "branch to import the products to")
+	format := flags.String("format", "", "csv or json, taken from the file extension when not set")
+	dryRun := flags.Bool("dry-run", false, "only check the catalog")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *branchID == 0 || flags.NArg() != 1 {
+		return errors.New("usage: catalog import -branch <id> [-format csv|json] [-dry-run] <file|->")
+	}
+
+	path := flags.Arg(0)
+	input := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	catalogFormat, err := crud.CatalogFormat(*format, path)
+	if err != nil {
+		return err
+	}
+	rows, rowErrors, err := crud.ParseCatalog(input, catalogFormat)
+	if err != nil {
+		return err
+	}
+	result, err := crud.ImportCatalog(db, uint(*branchID), rows, rowErrors, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d rows have errors, nothing was imported", len(result.Errors))
+	}
+	return nil
+}
+
+// exportCatalog writes the catalog of a branch to a file, or to the standard output
+func exportCatalog(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("catalog export", flag.ContinueOnError)
+	branchID := flags.Uint("branch", 0, "branch to export the products of")
+	format := flags.String("format", crud.CatalogCSV, "csv or json")
+	output := flags.String("o", "", "file to write, the standard output when not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *branchID == 0 || (*format != crud.CatalogCSV && *format != crud.CatalogJSON) {
+		return errors.New("usage: catalog export -branch <id> [-format csv|json] [-o file]")
+	}
+
+	products, err := crud.ExportCatalog(db, uint(*branchID))
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return crud.WriteCatalog(os.Stdout, *format, products)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := crud.WriteCatalog(file, *format, products); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -11,14 +11,19 @@ import (
 
 var DB *gorm.DB
 
-func InitDB() error {
+// DSN builds the database connection string from the environment
+func DSN() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	dbPort := os.Getenv("DB_PORT")
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai", dbHost, dbUser, dbPassword, dbName, dbPort)
+}
+
+func InitDB() error {
 	//DSN and Connecting to the db
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai", dbHost, dbUser, dbPassword, dbName, dbPort)
+	dsn := DSN()
 	var err error
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
@@ -33,10 +38,24 @@ func InitDB() error {
 		&models.BlacklistedToken{},
 		&models.EmailVerificationToken{},
 		&models.PasswordResetToken{},
+		&models.EmailChangeRequest{},
+		&models.PhoneVerificationCode{},
+		&models.UserIdentity{},
+		&models.OIDCAuthState{},
 		&models.Addon{},
 		&models.Branch{},
+		&models.BranchOpeningHour{},
+		&models.BranchHoliday{},
+		&models.SlotBooking{},
+		&models.BranchStaff{},
 		&models.Product{},
+		&models.BranchProduct{},
+		&models.MediaFile{},
+		&models.ProductImage{},
 		&models.ShippingAddress{},
+		&models.Address{},
+		&models.DeliveryZone{},
+		&models.ShippingRate{},
 		&models.VariationOption{},
 		&models.ProductVariation{},
 		&models.Category{},
@@ -46,8 +65,16 @@ func InitDB() error {
 		&models.OrderItemAddon{},
 		&models.OrderItem{},
 		&models.OrderItemVariation{},
+		&models.OrderItemTax{},
+		&models.OrderTax{},
+		&models.OrderStatusHistory{},
+		&models.FavouriteOrder{},
+		&models.TaxCategory{},
+		&models.TaxRate{},
 		&models.Payment{},
 		&models.Coupon{},
+		&models.DataExport{},
+		&models.AccountDeletionRequest{},
 	}
 
 	// Loop for each model for auto Migration
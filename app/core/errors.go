@@ -18,6 +18,11 @@ type ErrorResponse struct {
 
 // HandleValidationErrors processes and returns validation errors
 func HandleValidationErrors(c *gin.Context, err error) {
+	c.JSON(400, ErrorResponse{Errors: ValidationMessages(err)})
+}
+
+// ValidationMessages gives the messages of binding errors by field, like HandleValidationErrors answers them
+func ValidationMessages(err error) map[string]interface{} {
 	var ve validator.ValidationErrors
 	var je *json.UnmarshalTypeError
 
@@ -27,14 +32,13 @@ func HandleValidationErrors(c *gin.Context, err error) {
 		for _, e := range ve {
 			errs[e.Field()] = formatErrorMessage(e)
 		}
-		c.JSON(400, ErrorResponse{Errors: errs})
+		return errs
 	case errors.As(err, &je):
-		errs := map[string]interface{}{
+		return map[string]interface{}{
 			je.Field: fmt.Sprintf("Invalid value type. Expected %s", je.Type.String()),
 		}
-		c.JSON(400, ErrorResponse{Errors: errs})
 	default:
-		c.JSON(400, ErrorResponse{Errors: map[string]interface{}{"general": err.Error()}})
+		return map[string]interface{}{"general": err.Error()}
 	}
 }
 
@@ -65,6 +69,14 @@ func formatErrorMessage(e validator.FieldError) string {
 		return "This field must contain only numeric characters"
 	case "alphanum":
 		return "This field must contain only alphanumeric characters"
+	case "required_with":
+		return fmt.Sprintf("This field is required when %s is set", e.Param())
+	case "latitude":
+		return "Invalid latitude"
+	case "longitude":
+		return "Invalid longitude"
+	case "datetime":
+		return fmt.Sprintf("This field must match the format %s", e.Param())
 	default:
 		return fmt.Sprintf("Invalid value for %s", e.Field())
 	}
@@ -80,7 +92,23 @@ func (e *HTTPError) Error() string {
 	return e.Message
 }
 
+// ValidationError is an invalid request value only found past binding, it is answered like the binding errors
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
 func CustomErrorResponse(c *gin.Context, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(400, ErrorResponse{Errors: map[string]interface{}{validationErr.Field: validationErr.Message}})
+		log.Println("Error --> ", 400, err)
+		return
+	}
 	var httpErr *HTTPError
 	if errors.As(err, &httpErr) {
 		c.JSON(httpErr.StatusCode, gin.H{"error": httpErr.Message})
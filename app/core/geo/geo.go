@@ -0,0 +1,44 @@
+package geo
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+// Point is a latitude / longitude pair in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DistanceKm returns the great-circle distance between two points using the haversine formula
+func DistanceKm(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// InPolygon reports whether the point is inside the polygon (ray casting), good enough for city sized zones
+func InPolygon(p Point, polygon []Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// PointsFromFlat turns a flattened [lat1, lng1, lat2, lng2, ...] list into points
+func PointsFromFlat(values []float64) []Point {
+	points := make([]Point, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		points = append(points, Point{Lat: values[i], Lng: values[i+1]})
+	}
+	return points
+}
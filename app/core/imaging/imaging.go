@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	// decoders of the allowed types
+	_ "image/gif"
+)
+
+// Extensions are the image types that can be uploaded, by sniffed content type
+var Extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// MaxPixels guards against decompression bombs, small files that decode to huge images
+const MaxPixels = 50_000_000
+
+// Sniff detects the content type from the first bytes, the file name and the declared type are not trusted
+func Sniff(content []byte) string {
+	return http.DetectContentType(content)
+}
+
+// Decode decodes an image after checking its dimensions
+func Decode(content []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("image is %dx%d, at most %d pixels are allowed", config.Width, config.Height, MaxPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	return img, err
+}
+
+// Fit scales an image down to fit a maxSize x maxSize box, keeping its ratio. Every target pixel is the
+// average of the source pixels it covers, which keeps the thumbnails sharp without aliasing.
+func Fit(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if srcWidth <= maxSize && srcHeight <= maxSize {
+		return src
+	}
+	width, height := maxSize, maxSize
+	if srcWidth > srcHeight {
+		height = max(1, srcHeight*maxSize/srcWidth)
+	} else {
+		width = max(1, srcWidth*maxSize/srcHeight)
+	}
+
+	// premultiplied alpha, so transparent pixels don't bleed their color into the average
+	source := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(source, source.Bounds(), src, bounds.Min, draw.Src)
+	target := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				row := source.Pix[sy*source.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += int(pixel[0])
+					g += int(pixel[1])
+					b += int(pixel[2])
+					a += int(pixel[3])
+					count++
+				}
+			}
+			offset := y*target.Stride + x*4
+			target.Pix[offset] = uint8(r / count)
+			target.Pix[offset+1] = uint8(g / count)
+			target.Pix[offset+2] = uint8(b / count)
+			target.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return target
+}
+
+// Encode writes a thumbnail, JPEG for the JPEG images and PNG for the others so the transparency is kept.
+// It returns the written content type.
+func Encode(w io.Writer, img image.Image, sourceType string) (string, error) {
+	if sourceType == "image/jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return "image/png", png.Encode(w, img)
+}
@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"ecommerce/app/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// AdminMiddleware only lets super users through, it must run after AuthMiddleware
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(models.User)
+		if !user.IsSuperUser {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -37,13 +37,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 		var user models.User
 
-		result := db.Where("email = ?", claims.Email).First(&user)
+		result := db.First(&user, claims.UserID)
 		if result.Error != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
-		// Set the authenticated user's email in the context
+		// Set the authenticated user in the context
 		c.Set("user", user)
 
 		c.Next()
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"strings"
+)
+
+// redactedQueryParams are the query parameters carrying credentials, see QueryTokenMiddleware
+var redactedQueryParams = []string{"access_token"}
+
+// Logger logs the requests like the gin default logger, without the credentials passed in query strings
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			params.StatusCode,
+			params.Latency,
+			params.ClientIP,
+			params.Method,
+			redactPath(params.Path),
+			params.ErrorMessage,
+		)
+	})
+}
+
+func redactPath(path string) string {
+	base, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base + "?[unparsable query]"
+	}
+	redacted := false
+	for _, param := range redactedQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+	return base + "?" + query.Encode()
+}
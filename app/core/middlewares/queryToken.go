@@ -0,0 +1,15 @@
+package middlewares
+
+import "github.com/gin-gonic/gin"
+
+// QueryTokenMiddleware accepts the access token as an access_token query parameter, for clients like the
+// browser EventSource that can not set headers. It must run before AuthMiddleware, and the request logger
+// must redact the parameter (see Logger).
+func QueryTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		c.Next()
+	}
+}
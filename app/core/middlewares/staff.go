@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// BranchStaffMiddleware only lets members of the branch in the :id path parameter (and super users) through,
+// it must run after AuthMiddleware
+func BranchStaffMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(models.User)
+		branchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+			c.Abort()
+			return
+		}
+		if user.IsSuperUser {
+			c.Next()
+			return
+		}
+
+		var count int64
+		if err := core.GetDB().Model(&models.BranchStaff{}).
+			Where("branch_id = ? AND user_id = ?", branchID, user.ID).
+			Count(&count).Error; err != nil || count == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this branch"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
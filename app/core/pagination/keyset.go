@@ -0,0 +1,120 @@
+package pagination
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// SortKey is one key of a list order, Column is a SQL expression that must never be NULL
+type SortKey struct {
+	Column string
+	Vars   []interface{}
+	Desc   bool
+}
+
+// Keyset is the order a list is paged in, the id comes last so the order is stable
+type Keyset struct {
+	// identifies the order in the cursors, e.g. "price:desc"
+	Name string
+	Keys []SortKey
+	// the id column, qualify it when the query has joins
+	IDColumn string
+	// the id goes from the highest to the lowest
+	IDDesc bool
+}
+
+// ByID pages a list by its id
+func ByID(idColumn string, desc bool) Keyset {
+	name := "id"
+	if desc {
+		name = "id:desc"
+	}
+	return Keyset{Name: name, IDColumn: idColumn, IDDesc: desc}
+}
+
+// Paginate returns the page of query after the params cursor, key returns the sort key values and the id of an item.
+// The errors are *core.HTTPError, a bad cursor is a bad request.
+func Paginate[T any](query *gorm.DB, params Params, keyset Keyset, key func(T) ([]interface{}, uint)) (Page[T], error) {
+	page := Page[T]{Data: []T{}}
+	if keyset.IDColumn == "" {
+		keyset.IDColumn = "id"
+	}
+	if params.WithTotal {
+		total, err := countTotal(query)
+		if err != nil {
+			return page, err
+		}
+		page.Total = total
+	}
+
+	if params.Cursor != "" {
+		after, err := decodeCursor(params.Cursor, keyset.Name)
+		if err != nil || len(after.Values) != len(keyset.Keys) {
+			return page, invalidCursor()
+		}
+		query = query.Where(keyset.after(after))
+	}
+	query = query.Order(keyset.orderBy())
+
+	limit := params.PageSize()
+	var items []T
+	if err := query.Limit(limit + 1).Find(&items).Error; err != nil {
+		return page, listError(err)
+	}
+	if len(items) > limit {
+		items = items[:limit]
+		values, id := key(items[limit-1])
+		page.HasMore = true
+		page.NextCursor = cursor{Sort: keyset.Name, Values: values, ID: id}.encode()
+	}
+	page.Data = append(page.Data, items...)
+	return page, nil
+}
+
+// orderBy is the whole order in one clause, gorm drops expression orders merged with other orders
+func (k Keyset) orderBy() clause.OrderBy {
+	var columns []string
+	var vars []interface{}
+	for _, sortKey := range k.Keys {
+		columns = append(columns, sortKey.Column+direction(sortKey.Desc))
+		vars = append(vars, sortKey.Vars...)
+	}
+	columns = append(columns, k.IDColumn+direction(k.IDDesc))
+	return clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(columns, ", "), Vars: vars, WithoutParentheses: true}}
+}
+
+// after builds the condition selecting the rows after the cursor:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND id > id1)
+func (k Keyset) after(c cursor) clause.Expr {
+	var groups []string
+	var vars []interface{}
+	var equalSQL []string
+	var equalVars []interface{}
+	for i, sortKey := range k.Keys {
+		groups = append(groups, strings.Join(append(append([]string{}, equalSQL...),
+			fmt.Sprintf("%s %s ?", sortKey.Column, comparison(sortKey.Desc))), " AND "))
+		vars = append(append(append(vars, equalVars...), sortKey.Vars...), c.Values[i])
+
+		equalSQL = append(equalSQL, sortKey.Column+" = ?")
+		equalVars = append(append(equalVars, sortKey.Vars...), c.Values[i])
+	}
+	groups = append(groups, strings.Join(append(equalSQL, fmt.Sprintf("%s %s ?", k.IDColumn, comparison(k.IDDesc))), " AND "))
+	vars = append(append(vars, equalVars...), c.ID)
+	return clause.Expr{SQL: "(" + strings.Join(groups, ") OR (") + ")", Vars: vars}
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+func comparison(desc bool) string {
+	if desc {
+		return "<"
+	}
+	return ">"
+}
@@ -0,0 +1,108 @@
+package pagination
+
+import (
+	"gorm.io/gorm/clause"
+	"reflect"
+	"testing"
+)
+
+func TestKeysetAfter(t *testing.T) {
+	const relevance = "coalesce(array_position(?::bigint[], products.id::bigint), 0)"
+	tests := []struct {
+		name   string
+		keyset Keyset
+		cursor cursor
+		sql    string
+		vars   []interface{}
+	}{
+		{
+			name:   "id only",
+			keyset: ByID("products.id", false),
+			cursor: cursor{ID: 7},
+			sql:    "(products.id > ?)",
+			vars:   []interface{}{uint(7)},
+		},
+		{
+			name:   "id descending",
+			keyset: ByID("id", true),
+			cursor: cursor{ID: 7},
+			sql:    "(id < ?)",
+			vars:   []interface{}{uint(7)},
+		},
+		{
+			name: "one key",
+			keyset: Keyset{
+				Keys:     []SortKey{{Column: "products.price"}},
+				IDColumn: "products.id",
+			},
+			cursor: cursor{Values: []interface{}{9.5}, ID: 7},
+			sql:    "(products.price > ?) OR (products.price = ? AND products.id > ?)",
+			vars:   []interface{}{9.5, 9.5, uint(7)},
+		},
+		{
+			name: "mixed directions",
+			keyset: Keyset{
+				Keys:     []SortKey{{Column: "products.total_sales", Desc: true}, {Column: "products.price"}},
+				IDColumn: "products.id",
+				IDDesc:   true,
+			},
+			cursor: cursor{Values: []interface{}{12, 9.5}, ID: 7},
+			sql: "(products.total_sales < ?) OR (products.total_sales = ? AND products.price > ?)" +
+				" OR (products.total_sales = ? AND products.price = ? AND products.id < ?)",
+			vars: []interface{}{12, 12, 9.5, 12, 9.5, uint(7)},
+		},
+		{
+			name: "three keys",
+			keyset: Keyset{
+				Keys:     []SortKey{{Column: "a"}, {Column: "b", Desc: true}, {Column: "c"}},
+				IDColumn: "id",
+			},
+			cursor: cursor{Values: []interface{}{1, 2, 3}, ID: 4},
+			sql:    "(a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND c > ?) OR (a = ? AND b = ? AND c = ? AND id > ?)",
+			vars:   []interface{}{1, 1, 2, 1, 2, 3, 1, 2, 3, uint(4)},
+		},
+		{
+			name: "key with its own vars",
+			keyset: Keyset{
+				Keys:     []SortKey{{Column: relevance, Vars: []interface{}{"ids"}}, {Column: "products.price"}},
+				IDColumn: "products.id",
+			},
+			cursor: cursor{Values: []interface{}{2, 9.5}, ID: 7},
+			sql: "(" + relevance + " > ?) OR (" + relevance + " = ? AND products.price > ?)" +
+				" OR (" + relevance + " = ? AND products.price = ? AND products.id > ?)",
+			vars: []interface{}{"ids", 2, "ids", 2, 9.5, "ids", 2, 9.5, uint(7)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := tt.keyset.after(tt.cursor)
+			if expr.SQL != tt.sql {
+				t.Errorf("SQL\n got: %s\nwant: %s", expr.SQL, tt.sql)
+			}
+			if !reflect.DeepEqual(expr.Vars, tt.vars) {
+				t.Errorf("vars\n got: %#v\nwant: %#v", expr.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestKeysetOrderBy(t *testing.T) {
+	keyset := Keyset{
+		Keys: []SortKey{
+			{Column: "coalesce(array_position(?::bigint[], products.id::bigint), 0)", Vars: []interface{}{"ids"}},
+			{Column: "products.price", Desc: true},
+		},
+		IDColumn: "products.id",
+	}
+	expr, ok := keyset.orderBy().Expression.(clause.Expr)
+	if !ok {
+		t.Fatalf("order expression is %T", keyset.orderBy().Expression)
+	}
+	sql := "coalesce(array_position(?::bigint[], products.id::bigint), 0) ASC, products.price DESC, products.id ASC"
+	if expr.SQL != sql {
+		t.Errorf("SQL\n got: %s\nwant: %s", expr.SQL, sql)
+	}
+	if !reflect.DeepEqual(expr.Vars, []interface{}{"ids"}) {
+		t.Errorf("vars: got %#v", expr.Vars)
+	}
+}
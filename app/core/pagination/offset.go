@@ -0,0 +1,49 @@
+package pagination
+
+// Offset returns where a page starts in a list paged by position, for lists the database can't page by keys
+// (e.g. results ranked by a search index, or computed in memory). sort identifies the order of the list.
+func (p Params) Offset(sort string) (int, error) {
+	if p.Cursor == "" {
+		return 0, nil
+	}
+	c, err := decodeCursor(p.Cursor, sort)
+	if err != nil {
+		return 0, err
+	}
+	return c.Offset, nil
+}
+
+// OffsetPage builds the page of a list paged by position, items holds the page starting at offset and,
+// when there is a next page, one more item
+func OffsetPage[T any](items []T, params Params, sort string, offset int) Page[T] {
+	page := Page[T]{Data: []T{}}
+	limit := params.PageSize()
+	if len(items) > limit {
+		items = items[:limit]
+		page.HasMore = true
+		page.NextCursor = cursor{Sort: sort, Offset: offset + limit}.encode()
+	}
+	page.Data = append(page.Data, items...)
+	return page
+}
+
+// Slice pages a list computed in memory
+func Slice[T any](items []T, params Params, sort string) (Page[T], error) {
+	offset, err := params.Offset(sort)
+	if err != nil {
+		return Page[T]{Data: []T{}}, err
+	}
+	total := int64(len(items))
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + params.PageSize() + 1
+	if end > len(items) {
+		end = len(items)
+	}
+	page := OffsetPage(items[offset:end], params, sort, offset)
+	if params.WithTotal {
+		page.Total = &total
+	}
+	return page, nil
+}
@@ -0,0 +1,100 @@
+package pagination
+
+import (
+	"ecommerce/app/core"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Params are the paging query parameters every list endpoint accepts
+type Params struct {
+	// next_cursor of the previous page, empty for the first page
+	Cursor string `form:"cursor" binding:"max=1024"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	// also count the whole list, it costs one more query
+	WithTotal bool `form:"with_total"`
+}
+
+// PageSize is the requested page size, capped to MaxLimit
+func (p Params) PageSize() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultLimit
+	case p.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return p.Limit
+}
+
+// Page is the response envelope of every list endpoint
+type Page[T any] struct {
+	Data []T `json:"data"`
+	// pass it as cursor to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+	// only set when with_total is asked for
+	Total *int64 `json:"total,omitempty"`
+}
+
+// Map converts the items of a page, typically models to their response schemas
+func Map[T, R any](page Page[T], convert func(T) R) Page[R] {
+	data := make([]R, len(page.Data))
+	for i, item := range page.Data {
+		data[i] = convert(item)
+	}
+	return Page[R]{Data: data, NextCursor: page.NextCursor, HasMore: page.HasMore, Total: page.Total}
+}
+
+// cursor is the position after the last item of a page, it is opaque to the clients
+type cursor struct {
+	// order the cursor was made for, a cursor can't be used with another order
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v,omitempty"`
+	ID     uint          `json:"i,omitempty"`
+	Offset int           `json:"o,omitempty"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string, sort string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Sort != sort || c.Offset < 0 {
+		return c, invalidCursor()
+	}
+	return c, nil
+}
+
+func listError(err error) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    fmt.Sprintf("Error listing: %s", err),
+	}
+}
+
+func invalidCursor() error {
+	return &core.HTTPError{
+		StatusCode: http.StatusBadRequest,
+		Message:    "Invalid cursor",
+	}
+}
+
+// countTotal counts the rows of a list query, the query is used as a subquery so its preloads are left out
+func countTotal(query *gorm.DB) (*int64, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{NewDB: true}).Table("(?) AS list", query).Count(&total).Error; err != nil {
+		return nil, listError(err)
+	}
+	return &total, nil
+}
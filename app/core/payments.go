@@ -0,0 +1,39 @@
+package core
+
+import "log"
+
+// PaymentGateway confirms and reverses payments, implement it to plug in a real gateway (Stripe, Adyen, ...).
+// Confirm reports whether the payment intent captured the amount, it is the only way a payment succeeds since
+// the clients can't be trusted with it. Refund is only called for confirmed payments and is retried when saving
+// its result fails, so it must be idempotent per payment intent (e.g. use it as the idempotency key).
+type PaymentGateway interface {
+	Confirm(paymentIntentID string, amount float64, currency string) (bool, error)
+	Refund(paymentIntentID string, amount float64, currency string) error
+}
+
+// LogPaymentGateway accepts every payment and only logs the refunds, it is the default until a real gateway is set
+type LogPaymentGateway struct{}
+
+func (LogPaymentGateway) Confirm(paymentIntentID string, amount float64, currency string) (bool, error) {
+	log.Printf("Payment of %.2f %s confirmed for payment intent %s", amount, currency, paymentIntentID)
+	return true, nil
+}
+
+func (LogPaymentGateway) Refund(paymentIntentID string, amount float64, currency string) error {
+	log.Printf("Refund of %.2f %s for payment intent %s", amount, currency, paymentIntentID)
+	return nil
+}
+
+var paymentGateway PaymentGateway = LogPaymentGateway{}
+
+func SetPaymentGateway(gateway PaymentGateway) {
+	paymentGateway = gateway
+}
+
+func ConfirmPayment(paymentIntentID string, amount float64, currency string) (bool, error) {
+	return paymentGateway.Confirm(paymentIntentID, amount, currency)
+}
+
+func RefundPayment(paymentIntentID string, amount float64, currency string) error {
+	return paymentGateway.Refund(paymentIntentID, amount, currency)
+}
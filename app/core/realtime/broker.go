@@ -0,0 +1,74 @@
+package realtime
+
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Broker carries the published events to the hub of every replica
+type Broker interface {
+	// Publish sends an event right away, it must be called once the changes behind the event are committed
+	Publish(db *gorm.DB, event Event) error
+}
+
+// MemoryBroker delivers the events to this process only, enough for a single instance
+type MemoryBroker struct {
+	hub *Hub
+}
+
+func (b MemoryBroker) Publish(_ *gorm.DB, event Event) error {
+	b.hub.Broadcast(event)
+	return nil
+}
+
+// PostgresBroker sends the events with NOTIFY and feeds every LISTENing replica hub
+type PostgresBroker struct {
+	channel string
+}
+
+const notifyChannel = "realtime_events"
+
+func (b PostgresBroker) Publish(db *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return db.Exec("SELECT pg_notify(?, ?)", b.channel, string(payload)).Error
+}
+
+// listen forwards the notifications of the channel to the hub until the process exits
+func (b PostgresBroker) listen(dsn string, hub *Hub) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Realtime listener: %s", err)
+		}
+	})
+	if err := listener.Listen(b.channel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case notification := <-listener.Notify:
+				// nil after a reconnection, events sent meanwhile are lost
+				if notification == nil {
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					log.Printf("Realtime listener: invalid event: %s", err)
+					continue
+				}
+				hub.Broadcast(event)
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
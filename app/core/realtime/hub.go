@@ -0,0 +1,73 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a change pushed to the connected clients
+type Event struct {
+	Type     string    `json:"type"`
+	OrderID  uint      `json:"order_id"`
+	UserID   uint      `json:"user_id"`
+	BranchID uint      `json:"branch_id"`
+	Status   string    `json:"status"`
+	At       time.Time `json:"at"`
+}
+
+const (
+	OrderCreated       = "order.created"
+	OrderStatusChanged = "order.status_changed"
+)
+
+// Hub fans the events out to the subscribers of this process
+type Hub struct {
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]subscriber
+}
+
+type subscriber struct {
+	events chan Event
+	filter func(Event) bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[int]subscriber)}
+}
+
+// Subscribe returns a channel receiving the events accepted by filter, cancel must be called once done
+func (h *Hub) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id := h.nextID
+	h.nextID++
+	events := make(chan Event, 16)
+	h.subscribers[id] = subscriber{events: events, filter: filter}
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers, id)
+			close(events)
+		})
+	}
+}
+
+// Broadcast delivers an event to the matching subscribers, a subscriber too slow to keep up misses it
+func (h *Hub) Broadcast(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
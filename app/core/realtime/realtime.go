@@ -0,0 +1,38 @@
+package realtime
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+var (
+	hub           = NewHub()
+	broker Broker = MemoryBroker{hub: hub}
+)
+
+// UsePostgres switches to the LISTEN/NOTIFY broker so the events reach the clients of every replica
+func UsePostgres(dsn string) error {
+	postgresBroker := PostgresBroker{channel: notifyChannel}
+	if err := postgresBroker.listen(dsn, hub); err != nil {
+		return err
+	}
+	broker = postgresBroker
+	return nil
+}
+
+// Publish sends an event to the subscribers, failures are only logged as events are best effort.
+// Call it after the transaction commits so the clients never see changes that are rolled back.
+func Publish(db *gorm.DB, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	if err := broker.Publish(db, event); err != nil {
+		log.Printf("Error publishing %s event for order %d: %s", event.Type, event.OrderID, err)
+	}
+}
+
+// Subscribe returns the events accepted by filter, cancel must be called once done
+func Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	return hub.Subscribe(filter)
+}
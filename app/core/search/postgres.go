@@ -0,0 +1,108 @@
+package search
+
+import (
+	"ecommerce/app/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// PostgresIndex searches the products table itself: a weighted tsvector column (title, then tags, then
+// description) kept up to date by a trigger, and pg_trgm similarity on the title for misspelled words
+type PostgresIndex struct{}
+
+const textSearchConfig = "english"
+
+const setupSQL = `
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE OR REPLACE FUNCTION products_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS products_search_vector_trigger ON products;
+CREATE TRIGGER products_search_vector_trigger BEFORE INSERT OR UPDATE OF title, description, tags ON products
+	FOR EACH ROW EXECUTE FUNCTION products_search_vector_update();
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING gin (title gin_trgm_ops);
+UPDATE products SET title = title WHERE search_vector IS NULL;
+`
+
+func (PostgresIndex) Setup(db *gorm.DB) error {
+	return db.Exec(setupSQL).Error
+}
+
+func (PostgresIndex) Search(db *gorm.DB, query Query) ([]Hit, error) {
+	text := strings.TrimSpace(query.Text)
+	if text == "" {
+		return nil, nil
+	}
+
+	// full-text matches rank first, the trigram similarity brings in titles with typos
+	tsQuery := db.Raw("SELECT websearch_to_tsquery(?, ?) AS query", textSearchConfig, text)
+	sql := db.Table("products, (?) AS q", tsQuery).
+		Select(`products.id AS product_id,
+			ts_rank_cd(products.search_vector, q.query) + similarity(products.title, ?) AS rank,
+			ts_headline(?, coalesce(products.title, '') || ' ' || coalesce(products.description, ''), q.query,
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20') AS snippet`,
+			text, textSearchConfig).
+		Where("products.deleted_at IS NULL").
+		Where(models.PublishedProductSQL).
+		Where("products.search_vector @@ q.query OR products.title % ? OR ? <% products.title", text, text)
+	if query.BranchID != nil {
+		sql = sql.Where(`products.branch_id = ? OR products.id IN (SELECT product_id FROM branch_products
+			WHERE branch_id = ? AND is_active AND deleted_at IS NULL)`, *query.BranchID, *query.BranchID)
+	}
+	if query.CategoryID != nil {
+		sql = sql.Where("products.category_id = ? OR products.id IN (SELECT product_id FROM product_categories WHERE category_id = ?)",
+			*query.CategoryID, *query.CategoryID)
+	}
+
+	var hits []Hit
+	err := sql.Order("rank DESC, products.id").Limit(query.Limit).Offset(query.Offset).Scan(&hits).Error
+	return hits, err
+}
+
+func (PostgresIndex) Suggest(db *gorm.DB, prefix string, branchID *uint, limit int) ([]string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return []string{}, nil
+	}
+
+	// titles starting with the text first, then the closest ones
+	sql := db.Table("products").
+		Select("title, max(CASE WHEN title ILIKE ? THEN 1 ELSE 0 END) AS starts_with, max(similarity(title, ?)) AS score",
+			escapeLike(prefix)+"%", prefix).
+		Where("deleted_at IS NULL AND title <> ''").
+		Where(models.PublishedProductSQL).
+		Where("title ILIKE ? OR ? <% title", "%"+escapeLike(prefix)+"%", prefix)
+	if branchID != nil {
+		sql = sql.Where(`branch_id = ? OR id IN (SELECT product_id FROM branch_products
+			WHERE branch_id = ? AND is_active AND deleted_at IS NULL)`, *branchID, *branchID)
+	}
+
+	suggestions := []string{}
+	err := db.Table("(?) AS suggestions", sql.Group("title")).
+		Order("starts_with DESC, score DESC, title").
+		Limit(limit).
+		Pluck("title", &suggestions).Error
+	return suggestions, err
+}
+
+// Index is a no-op, the products trigger keeps the search column up to date
+func (PostgresIndex) Index(_ *gorm.DB, _ []uint) error {
+	return nil
+}
+
+// Remove is a no-op, deleted products are filtered out by the search queries
+func (PostgresIndex) Remove(_ *gorm.DB, _ []uint) error {
+	return nil
+}
+
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
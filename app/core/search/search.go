@@ -0,0 +1,70 @@
+package search
+
+import "gorm.io/gorm"
+
+// Query is a product search, the optional filters are applied by the index so the paging stays right
+type Query struct {
+	Text       string
+	BranchID   *uint
+	CategoryID *uint
+	Limit      int
+	Offset     int
+}
+
+// Hit is a matching product, best matches first
+type Hit struct {
+	ProductID uint
+	Rank      float64
+	// matching part of the product text with the matched words wrapped in <mark></mark>
+	Snippet string
+}
+
+// SearchIndex searches the products, implement it to plug in an external engine (Elasticsearch, Meilisearch, ...).
+// Index and Remove must be called after the products are written so an external index stays in sync.
+type SearchIndex interface {
+	// Setup prepares the index, it is called once on startup
+	Setup(db *gorm.DB) error
+	Search(db *gorm.DB, query Query) ([]Hit, error)
+	// Suggest completes a partial search text with product titles
+	Suggest(db *gorm.DB, prefix string, branchID *uint, limit int) ([]string, error)
+	Index(db *gorm.DB, productIDs []uint) error
+	Remove(db *gorm.DB, productIDs []uint) error
+}
+
+var index SearchIndex = PostgresIndex{}
+
+func SetIndex(searchIndex SearchIndex) {
+	index = searchIndex
+}
+
+func Setup(db *gorm.DB) error {
+	return index.Setup(db)
+}
+
+func Search(db *gorm.DB, query Query) ([]Hit, error) {
+	if query.Limit <= 0 {
+		query.Limit = 20
+	}
+	return index.Search(db, query)
+}
+
+func Suggest(db *gorm.DB, prefix string, branchID *uint, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	return index.Suggest(db, prefix, branchID, limit)
+}
+
+func Index(db *gorm.DB, productIDs ...uint) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	return index.Index(db, productIDs)
+}
+
+func Remove(db *gorm.DB, productIDs ...uint) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	return index.Remove(db, productIDs)
+}
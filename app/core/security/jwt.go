@@ -18,9 +18,9 @@ var (
 	refreshExpiryDays   time.Duration = 7
 )
 
-// Claims structure
+// Claims structure, users are identified by their ID since the email can change
 type Claims struct {
-	Email string `json:"email"`
+	UserID uint `json:"user_id"`
 	jwt.RegisteredClaims
 }
 
@@ -30,10 +30,10 @@ func createToken(claims Claims, secret []byte) (string, error) {
 	return token.SignedString(secret)
 }
 
-func CreateAccessToken(email string) (string, error) {
+func CreateAccessToken(userID uint) (string, error) {
 	// Create the access token
 	accessClaims := Claims{
-		Email: email,
+		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessExpiryMinutes * time.Minute)),
 		},
@@ -45,10 +45,10 @@ func CreateAccessToken(email string) (string, error) {
 	return accessToken, nil
 }
 
-func CreateRefreshToken(email string) (string, error) {
+func CreateRefreshToken(userID uint) (string, error) {
 	// Create the refresh token
 	refreshClaims := Claims{
-		Email: email,
+		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshExpiryDays * 24 * time.Hour)),
 		},
@@ -60,12 +60,12 @@ func CreateRefreshToken(email string) (string, error) {
 	return refreshToken, nil
 }
 
-func CreateJwtDefaultTokens(email string) (string, string, error) {
-	accessToken, err := CreateAccessToken(email)
+func CreateJwtDefaultTokens(userID uint) (string, string, error) {
+	accessToken, err := CreateAccessToken(userID)
 	if err != nil {
 		return "", "", err
 	}
-	refreshToken, err := CreateRefreshToken(email)
+	refreshToken, err := CreateRefreshToken(userID)
 	if err != nil {
 		return "", "", err
 	}
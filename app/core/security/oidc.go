@@ -0,0 +1,228 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCProvider holds the client configuration and discovered endpoints of an OpenID Connect provider
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+
+	jwks *jwksCache
+}
+
+// OIDCClaims are the ID token claims we rely on
+type OIDCClaims struct {
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// IsEmailVerified handles providers that send email_verified as a bool or as a string (Apple)
+func (c *OIDCClaims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+var (
+	oidcProviders   = map[string]*OIDCProvider{}
+	oidcProvidersMu sync.Mutex
+	oidcHTTPClient  = &http.Client{Timeout: 10 * time.Second}
+)
+
+// GetOIDCProvider returns the configured provider by name, running discovery on first use.
+// Providers are configured from env, e.g. OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID,
+// OIDC_GOOGLE_CLIENT_SECRET, OIDC_GOOGLE_REDIRECT_URL and optionally OIDC_GOOGLE_SCOPES.
+// Pointing the issuer at a local mock provider is enough to test the whole flow.
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(name)
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	if provider, ok := oidcProviders[name]; ok {
+		return provider, nil
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	provider := &OIDCProvider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+	if provider.Issuer == "" || provider.ClientID == "" {
+		return nil, fmt.Errorf("oidc provider %s is not configured", name)
+	}
+	if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+		provider.Scopes = strings.Fields(scopes)
+	}
+	if err := provider.discover(); err != nil {
+		return nil, err
+	}
+	provider.jwks = &jwksCache{uri: provider.JWKSURI}
+
+	oidcProviders[name] = provider
+	return provider, nil
+}
+
+// discover loads the provider endpoints from its well-known configuration document
+func (p *OIDCProvider) discover() error {
+	resp, err := oidcHTTPClient.Get(p.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc discovery failed with status %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return fmt.Errorf("invalid oidc discovery document: %w", err)
+	}
+	if strings.TrimSuffix(document.Issuer, "/") != p.Issuer {
+		return fmt.Errorf("oidc discovery issuer mismatch: %s", document.Issuer)
+	}
+	p.AuthorizationEndpoint = document.AuthorizationEndpoint
+	p.TokenEndpoint = document.TokenEndpoint
+	p.JWKSURI = document.JWKSURI
+	return nil
+}
+
+// AuthCodeURL builds the authorization request URL using PKCE (S256)
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("invalid oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		return "", fmt.Errorf("oidc token exchange failed: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+	return tokenResponse.IDToken, nil
+}
+
+// VerifyIDToken checks the ID token signature against the provider JWKS and validates iss, aud, exp and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*OIDCClaims, error) {
+	token, err := jwt.ParseWithClaims(rawIDToken, &OIDCClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.jwks.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*OIDCClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid id token")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+// RandomURLToken returns a random base64url string, used for state, nonce and PKCE verifiers
+func RandomURLToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,26 @@
+package core
+
+import "log"
+
+// SMSProvider delivers text messages, implement it to plug in a real gateway (Twilio, Vonage, ...)
+type SMSProvider interface {
+	Send(phoneNumber string, message string) error
+}
+
+// LogSMSProvider only logs the messages, it is the default until a real provider is set
+type LogSMSProvider struct{}
+
+func (LogSMSProvider) Send(phoneNumber string, message string) error {
+	log.Printf("SMS to %s: %s", phoneNumber, message)
+	return nil
+}
+
+var smsProvider SMSProvider = LogSMSProvider{}
+
+func SetSMSProvider(provider SMSProvider) {
+	smsProvider = provider
+}
+
+func SendSMS(phoneNumber string, message string) error {
+	return smsProvider.Send(phoneNumber, message)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ConfigureFromEnv sets the blob store and the URL signing from the environment:
+// STORAGE_BACKEND (local or s3), MEDIA_DIR for the local store,
+// S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_PUBLIC_URL for s3,
+// MEDIA_SIGNING_KEY, MEDIA_PUBLIC and MEDIA_URL_EXPIRY_MINUTES for the served URLs.
+func ConfigureFromEnv() error {
+	public := false
+	if value := os.Getenv("MEDIA_PUBLIC"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid MEDIA_PUBLIC: %w", err)
+		}
+		public = parsed
+	}
+	var expiry time.Duration
+	if value := os.Getenv("MEDIA_URL_EXPIRY_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return fmt.Errorf("invalid MEDIA_URL_EXPIRY_MINUTES %q", value)
+		}
+		expiry = time.Duration(minutes) * time.Minute
+	}
+	ConfigureSigning(os.Getenv("MEDIA_SIGNING_KEY"), public, expiry)
+
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "media"
+		}
+		SetStore(NewLocalStore(dir))
+	case "s3":
+		config := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		}
+		if config.Endpoint == "" || config.Bucket == "" {
+			return fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 storage")
+		}
+		SetStore(NewS3Store(config))
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config is an S3-compatible bucket (AWS S3, MinIO, R2, ...), addressed path-style
+type S3Config struct {
+	// e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000 for MinIO
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// base URL of a public bucket or CDN, the URLs are presigned when not set
+	PublicURL string
+}
+
+// S3Store keeps the blobs in an S3-compatible bucket, the requests are signed with AWS Signature Version 4
+type S3Store struct {
+	config S3Config
+	client *http.Client
+}
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func NewS3Store(config S3Config) *S3Store {
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	config.PublicURL = strings.TrimSuffix(config.PublicURL, "/")
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3Store{config: config, client: &http.Client{Timeout: time.Minute}}
+}
+
+func (s *S3Store) objectURL(key string) string {
+	return s.config.Endpoint + "/" + awsEscape(s.config.Bucket) + "/" + awsEscapePath(key)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), content)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", contentType)
+	response, err := s.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response)
+	}
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	response, err := s.do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, "", ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, "", s3Error(response)
+	}
+	return response.Body, response.Header.Get("Content-Type"), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return s3Error(response)
+	}
+	return nil
+}
+
+// URL is the public URL of the blob, or a presigned GET URL expiring like the media route URLs
+func (s *S3Store) URL(key string) string {
+	if s.config.PublicURL != "" {
+		return s.config.PublicURL + "/" + awsEscapePath(key)
+	}
+	now := time.Now().UTC()
+	objectURL, _ := url.Parse(s.objectURL(key))
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.config.AccessKeyID + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(urlExpiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	headers := map[string]string{"host": objectURL.Host}
+	signature := s.signature(now, http.MethodGet, objectURL.EscapedPath(), query, headers, unsignedPayload)
+	return objectURL.String() + "?" + canonicalQuery(query) + "&X-Amz-Signature=" + signature
+}
+
+// do signs the request in its headers and sends it, the payload isn't hashed so uploads are streamed
+func (s *S3Store) do(request *http.Request) (*http.Response, error) {
+	now := time.Now().UTC()
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	request.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	signature := s.signature(now, request.Method, request.URL.EscapedPath(), request.URL.Query(), headers, unsignedPayload)
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, s.scope(now), signedHeaders(headers), signature))
+	return s.client.Do(request)
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(now time.Time, method, path string, query url.Values, headers map[string]string, payloadHash string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		method, path, canonicalQuery(query), canonicalHeaders.String(), signedHeaders(headers), payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), s.scope(now), hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func signedHeaders(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as Signature Version 4 expects
+func awsEscape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func awsEscapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = awsEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func s3Error(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("s3 %s: %s", response.Status, strings.TrimSpace(string(body)))
+}
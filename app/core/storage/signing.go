@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoutePrefix is where the media route serves the blobs
+const RoutePrefix = "/api/v1/media/files"
+
+var (
+	signingKey = randomKey()
+	// the media route URLs are signed unless the blobs are public
+	publicBlobs = false
+	urlExpiry   = time.Hour
+)
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("storage: generating the signing key: %v", err))
+	}
+	return key
+}
+
+// ConfigureSigning sets how the media route URLs are signed. Without a key a random one is used,
+// the signed URLs then only work on this instance until it restarts.
+func ConfigureSigning(key string, public bool, expiry time.Duration) {
+	if key != "" {
+		signingKey = []byte(key)
+	}
+	publicBlobs = public
+	if expiry > 0 {
+		urlExpiry = expiry
+	}
+}
+
+// IsPublic tells whether the media route serves the blobs without a signature
+func IsPublic() bool {
+	return publicBlobs
+}
+
+// RouteURL is the media route URL of a blob, with an expiring signature unless the blobs are public
+func RouteURL(key string) string {
+	path := RoutePrefix + "/" + escapeKey(key)
+	if publicBlobs {
+		return path
+	}
+	expires := strconv.FormatInt(time.Now().Add(urlExpiry).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {sign(key, expires)}}
+	return path + "?" + query.Encode()
+}
+
+// VerifySignature checks a media route signature and that it hasn't expired
+func VerifySignature(key, expires, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(sign(key, expires)))
+}
+
+func sign(key, expires string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob doesn't exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the uploaded files, implement it to plug in another storage (GCS, Azure, ...).
+// Keys are slash separated paths, e.g. "media/2024/05/<uuid>.jpg".
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	// Open returns the blob content and its content type, the caller closes the content
+	Open(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	// URL is the address clients download the blob from, signed and expiring when the blobs are private
+	URL(key string) string
+}
+
+var store BlobStore = NewLocalStore("media")
+
+func SetStore(blobStore BlobStore) {
+	store = blobStore
+}
+
+func Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	return store.Put(ctx, key, content, size, contentType)
+}
+
+func Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	return store.Open(ctx, key)
+}
+
+// Delete removes the blobs, the missing ones are skipped
+func Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func URL(key string) string {
+	return store.URL(key)
+}
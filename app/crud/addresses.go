@@ -0,0 +1,166 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// ListUserAddresses lists the address book of a user, default address first
+func ListUserAddresses(db *gorm.DB, user models.User, pageParams pagination.Params) (pagination.Page[models.Address], error) {
+	keyset := pagination.Keyset{Name: "default", Keys: []pagination.SortKey{{Column: "is_default", Desc: true}}}
+	return pagination.Paginate(db.Model(&models.Address{}).Where("user_id = ?", user.ID), pageParams, keyset,
+		func(address models.Address) ([]interface{}, uint) {
+			return []interface{}{address.IsDefault}, address.ID
+		})
+}
+
+func GetUserAddress(db *gorm.DB, user models.User, addressID uint) (models.Address, error) {
+	var address models.Address
+	if err := db.Where("user_id = ?", user.ID).First(&address, addressID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return address, &core.HTTPError{
+				Message:    fmt.Sprintf("Address %d not found", addressID),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return address, &core.HTTPError{
+			Message:    fmt.Sprintf("Error getting address: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return address, nil
+}
+
+func CreateUserAddress(db *gorm.DB, user models.User, addressData schemas.AddressSchema) (models.Address, error) {
+	address := models.Address{UserID: user.ID}
+	applyAddressData(&address, addressData)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the first address of a user is always the default one
+		var count int64
+		if err := tx.Model(&models.Address{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+		if address.IsDefault {
+			if err := clearDefaultAddress(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&address).Error
+	})
+	if err != nil {
+		return address, &core.HTTPError{
+			Message:    fmt.Sprintf("Error creating address: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return address, nil
+}
+
+func UpdateUserAddress(db *gorm.DB, user models.User, addressID uint, addressData schemas.AddressSchema) (models.Address, error) {
+	address, err := GetUserAddress(db, user, addressID)
+	if err != nil {
+		return address, err
+	}
+	wasDefault := address.IsDefault
+	applyAddressData(&address, addressData)
+	// unsetting the default is done by setting another address as default
+	if wasDefault {
+		address.IsDefault = true
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if address.IsDefault && !wasDefault {
+			if err := clearDefaultAddress(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		// Select("*") so cleared optional fields (e.g. coordinates) are saved too
+		return tx.Select("*").Omit("CreatedAt").Save(&address).Error
+	})
+	if err != nil {
+		return address, &core.HTTPError{
+			Message:    fmt.Sprintf("Error updating address: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return address, nil
+}
+
+func SetDefaultUserAddress(db *gorm.DB, user models.User, addressID uint) error {
+	address, err := GetUserAddress(db, user, addressID)
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultAddress(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Model(&address).Update("is_default", true).Error
+	})
+	if err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error setting default address: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func DeleteUserAddress(db *gorm.DB, user models.User, addressID uint) error {
+	address, err := GetUserAddress(db, user, addressID)
+	if err != nil {
+		return err
+	}
+	// orders keep their own snapshot, so deleting an address book entry never touches them
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+		// promote the oldest remaining address
+		var next models.Address
+		if err := tx.Where("user_id = ?", user.ID).Order("id").First(&next).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return tx.Model(&next).Update("is_default", true).Error
+	})
+	if err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error deleting address: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func clearDefaultAddress(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Address{}).Where("user_id = ? AND is_default = ?", userID, true).Update("is_default", false).Error
+}
+
+func applyAddressData(address *models.Address, addressData schemas.AddressSchema) {
+	address.Label = addressData.Label
+	address.AddressLine1 = addressData.AddressLine1
+	address.AddressLine2 = addressData.AddressLine2
+	address.City = addressData.City
+	address.Country = addressData.Country
+	address.Postcode = addressData.Postcode
+	address.State = addressData.State
+	address.Latitude = addressData.Latitude
+	address.Longitude = addressData.Longitude
+	address.IsDefault = addressData.IsDefault
+}
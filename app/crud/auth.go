@@ -4,6 +4,7 @@ import (
 	"ecommerce/app/core"
 	"ecommerce/app/core/security"
 	"ecommerce/app/models"
+	"ecommerce/app/schemas"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
@@ -20,7 +21,7 @@ func LoginUser(db *gorm.DB, email, password string) (string, string, error) {
 	if !security.CheckPasswordHash(password, user.HashedPassword) {
 		return "", "", fmt.Errorf("password is not correct")
 	}
-	accessToken, refreshToken, err := security.CreateJwtDefaultTokens(email)
+	accessToken, refreshToken, err := security.CreateJwtDefaultTokens(user.ID)
 	if err != nil {
 		return "", "", err
 	}
@@ -51,7 +52,7 @@ func CreateUser(db *gorm.DB, email, phoneNumber, password, firstName, lastName s
 		return "", "", err
 	}
 	// create new accessToken / refreshToken
-	accessToken, refreshToken, err := security.CreateJwtDefaultTokens(email)
+	accessToken, refreshToken, err := security.CreateJwtDefaultTokens(user.ID)
 	if err != nil {
 		return "", "", err
 	}
@@ -68,7 +69,7 @@ func RefreshUserToken(db *gorm.DB, refreshToken string) (string, error) {
 		return "", err
 	}
 
-	accessToken, err := security.CreateAccessToken(claims.Email)
+	accessToken, err := security.CreateAccessToken(claims.UserID)
 	if err != nil {
 		return "", err
 	}
@@ -84,7 +85,7 @@ func RefreshUserToken(db *gorm.DB, refreshToken string) (string, error) {
 		return "", err
 	}
 
-	if err := UpdateUserLastLogin(tx, claims.Email); err != nil {
+	if err := UpdateUserLastLogin(tx, claims.UserID); err != nil {
 		tx.Rollback()
 		return "", err
 	}
@@ -96,9 +97,9 @@ func RefreshUserToken(db *gorm.DB, refreshToken string) (string, error) {
 	return accessToken, nil
 }
 
-func UpdateUserLastLogin(db *gorm.DB, email string) error {
+func UpdateUserLastLogin(db *gorm.DB, userID uint) error {
 	var user models.User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.First(&user, userID).Error; err != nil {
 		return err
 	}
 	user.LastLogin = time.Now()
@@ -236,7 +237,7 @@ func ResendVerifyUser(db *gorm.DB, user models.User) error {
 	return nil
 }
 
-func UpdateUserInfo(db *gorm.DB, userID uint, firstName, lastName, email, phoneNumber *string) error {
+func UpdateUserInfo(db *gorm.DB, userID uint, firstName, lastName, phoneNumber *string) error {
 	var user models.User
 	if err := db.First(&user, userID).Error; err != nil {
 		return err
@@ -252,11 +253,13 @@ func UpdateUserInfo(db *gorm.DB, userID uint, firstName, lastName, email, phoneN
 	if lastName != nil {
 		updates["last_name"] = *lastName
 	}
-	if email != nil {
-		updates["email"] = *email
-	}
-	if phoneNumber != nil {
+	if phoneNumber != nil && *phoneNumber != user.PhoneNumber {
 		updates["phone_number"] = *phoneNumber
+		// a new phone number has to be verified again
+		updates["phone_verified"] = false
+		if err := db.Where("user_id = ?", user.ID).Delete(&models.PhoneVerificationCode{}).Error; err != nil {
+			return fmt.Errorf("error deleting old codes: %w", err)
+		}
 	}
 
 	if len(updates) > 0 {
@@ -270,3 +273,97 @@ func UpdateUserInfo(db *gorm.DB, userID uint, firstName, lastName, email, phoneN
 	}
 	return nil
 }
+
+// UpdateUserProfile updates the profile fields and requests the email change of a profile update,
+// nothing is saved when one of them fails
+func UpdateUserProfile(db *gorm.DB, user models.User, request schemas.UpdateUserRequest) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := UpdateUserInfo(tx, user.ID, request.FirstName, request.LastName, request.PhoneNumber); err != nil {
+			return err
+		}
+		if request.Email != nil && *request.Email != user.Email {
+			return RequestEmailChange(tx, user, *request.Email)
+		}
+		return nil
+	})
+}
+
+func RequestEmailChange(db *gorm.DB, user models.User, newEmail string) error {
+	if newEmail == user.Email {
+		return fmt.Errorf("new email is the same as the current one")
+	}
+	var count int64
+	if err := db.Model(&models.User{}).Where("email = ?", newEmail).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("email already in use")
+	}
+	// only the latest request is kept
+	if err := db.Where("user_id = ?", user.ID).Delete(&models.EmailChangeRequest{}).Error; err != nil {
+		return fmt.Errorf("error deleting old requests: %w", err)
+	}
+	changeRequest := models.EmailChangeRequest{
+		UUID:      uuid.New(),
+		NewEmail:  newEmail,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+	}
+	if err := db.Create(&changeRequest).Error; err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	// the confirmation goes to the new address to prove the user owns it
+	if err := core.SendEmail(newEmail, "Confirm Email Change", changeRequest.UUID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ConfirmEmailChange(db *gorm.DB, token uuid.UUID) error {
+	var changeRequest models.EmailChangeRequest
+	if err := db.Preload("User").First(&changeRequest, "uuid = ?", token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("invalid or expired token")
+		}
+		return fmt.Errorf("error finding token: %w", err)
+	}
+	if changeRequest.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("invalid or expired token")
+	}
+	oldEmail := changeRequest.User.Email
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the address may have been taken since the request was made
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", changeRequest.NewEmail, changeRequest.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("email already in use")
+		}
+		// confirming the link proves the new address, so the user stays verified
+		if err := tx.Model(&models.User{}).Where("id = ?", changeRequest.UserID).Updates(map[string]interface{}{
+			"email":       changeRequest.NewEmail,
+			"is_verified": true,
+		}).Error; err != nil {
+			return fmt.Errorf("error updating email: %w", err)
+		}
+		if err := tx.Where("user_id = ?", changeRequest.UserID).Delete(&models.EmailChangeRequest{}).Error; err != nil {
+			return fmt.Errorf("error deleting token: %w", err)
+		}
+		// pending verification links were sent to the old address
+		if err := tx.Where("user_id = ?", changeRequest.UserID).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+			return fmt.Errorf("error deleting old tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// let the old address know, in case the change was not made by its owner
+	if err := core.SendEmail(oldEmail, "Your Email Was Changed", fmt.Sprintf("Your account email was changed to %s", changeRequest.NewEmail)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -2,28 +2,394 @@ package crud
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/geo"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"net/http"
+	"sort"
+	"time"
 )
 
-func ListBranches(db *gorm.DB) ([]models.Branch, error) {
+// how far ahead the next slots are searched
+const slotSearchDays = 14
+
+// branchesByName pages the branch lists in name order
+var branchesByName = pagination.Keyset{
+	Name:     "name",
+	Keys:     []pagination.SortKey{{Column: "branches.name"}},
+	IDColumn: "branches.id",
+}
+
+// ListBranches lists the branches, inactive ones are only included when activeOnly is false
+func ListBranches(db *gorm.DB, activeOnly bool, pageParams pagination.Params) (pagination.Page[models.Branch], error) {
+	query := db.Model(&models.Branch{})
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+	return pagination.Paginate(query, pageParams, branchesByName,
+		func(branch models.Branch) ([]interface{}, uint) { return []interface{}{branch.Name}, branch.ID })
+}
+
+func GetBranchByID(db *gorm.DB, id uint) (models.Branch, error) {
+	var dbBranch models.Branch
+	if err := db.First(&dbBranch, id).Error; err != nil {
+		return dbBranch, fetchBranchError(err)
+	}
+	return dbBranch, nil
+}
+
+func fetchBranchError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &core.HTTPError{
+			Message:    "Branch not found",
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return &core.HTTPError{
+		Message:    fmt.Sprintf("Error fetching branch: %s", err),
+		StatusCode: http.StatusInternalServerError,
+	}
+}
+
+func CreateBranch(db *gorm.DB, branchData schemas.BranchSchema) (models.Branch, error) {
+	branch := models.Branch{IsActive: true, PickupLeadMinutes: 15, DeliveryLeadMinutes: 45, SlotMinutes: 15, ReleaseLeadMinutes: 30,
+		CancelWindowMinutes: 5, CancelScheduledLeadMinutes: 60}
+	if err := applyBranchData(&branch, branchData); err != nil {
+		return branch, err
+	}
+	if err := db.Create(&branch).Error; err != nil {
+		return branch, &core.HTTPError{
+			Message:    fmt.Sprintf("Error creating branch: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return branch, nil
+}
+
+func UpdateBranch(db *gorm.DB, id uint, branchData schemas.BranchSchema) (models.Branch, error) {
+	branch, err := GetBranchByID(db, id)
+	if err != nil {
+		return branch, err
+	}
+	if err := applyBranchData(&branch, branchData); err != nil {
+		return branch, err
+	}
+	if err := db.Omit("OpeningHours", "Holidays", "Products").Save(&branch).Error; err != nil {
+		return branch, &core.HTTPError{
+			Message:    fmt.Sprintf("Error updating branch: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return GetBranchWithHours(db, branch.ID)
+}
+
+// DeleteBranch soft deletes a branch, its orders keep referencing it
+func DeleteBranch(db *gorm.DB, id uint) error {
+	result := db.Delete(&models.Branch{}, id)
+	if result.Error != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error deleting branch: %s", result.Error),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Branch %d not found", id),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func applyBranchData(branch *models.Branch, branchData schemas.BranchSchema) error {
+	if _, err := time.LoadLocation(branchData.Timezone); err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Unknown timezone %s", branchData.Timezone),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	branch.Name = branchData.Name
+	branch.AddressLine1 = branchData.AddressLine1
+	branch.AddressLine2 = branchData.AddressLine2
+	branch.City = branchData.City
+	branch.State = branchData.State
+	branch.Postcode = branchData.Postcode
+	branch.Country = branchData.Country
+	branch.Latitude = branchData.Latitude
+	branch.Longitude = branchData.Longitude
+	branch.PhoneNumber = branchData.PhoneNumber
+	branch.Email = branchData.Email
+	branch.Timezone = branchData.Timezone
+	branch.TaxRegion = branchData.TaxRegion
+	branch.PricesIncludeTax = branchData.PricesIncludeTax
+	if branchData.IsActive != nil {
+		branch.IsActive = *branchData.IsActive
+	}
+	if branchData.CancelWindowMinutes != nil {
+		branch.CancelWindowMinutes = *branchData.CancelWindowMinutes
+	}
+	if branchData.CancelScheduledLeadMinutes != nil {
+		branch.CancelScheduledLeadMinutes = *branchData.CancelScheduledLeadMinutes
+	}
+	return nil
+}
+
+// NearestBranches returns the active branches closest to a point, within radiusKm when it is positive
+func NearestBranches(db *gorm.DB, point geo.Point, radiusKm float64, pageParams pagination.Params) (pagination.Page[schemas.BranchResponseSchema], error) {
 	var dbBranches []models.Branch
-	if err := db.Find(&dbBranches).Error; err != nil {
-		return nil, &core.HTTPError{
+	if err := db.Where("is_active = ? AND latitude IS NOT NULL AND longitude IS NOT NULL", true).
+		Find(&dbBranches).Error; err != nil {
+		return pagination.Page[schemas.BranchResponseSchema]{}, &core.HTTPError{
 			Message:    "Error fetching branches",
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
-	return dbBranches, nil
+
+	branches := make([]schemas.BranchResponseSchema, 0, len(dbBranches))
+	for _, branch := range dbBranches {
+		distance := geo.DistanceKm(point, geo.Point{Lat: *branch.Latitude, Lng: *branch.Longitude})
+		if radiusKm > 0 && distance > radiusKm {
+			continue
+		}
+		distance = models.RoundMoney(distance)
+		response := branch.ToResponse()
+		response.DistanceKm = &distance
+		branches = append(branches, response)
+	}
+	sort.Slice(branches, func(i, j int) bool { return *branches[i].DistanceKm < *branches[j].DistanceKm })
+	return pagination.Slice(branches, pageParams, "distance")
 }
-func GetBranchByID(db *gorm.DB, id uint) (models.Branch, error) {
+
+// GetBranchWithHours loads a branch with its opening hours and upcoming holidays
+func GetBranchWithHours(db *gorm.DB, id uint) (models.Branch, error) {
 	var dbBranch models.Branch
-	if err := db.First(&dbBranch, id).Error; err != nil {
-		return dbBranch, &core.HTTPError{
-			Message:    "Error fetching branch",
+	if err := db.Preload("OpeningHours").
+		Preload("Holidays", "date >= ?", time.Now().AddDate(0, 0, -1).Format(time.DateOnly)).
+		First(&dbBranch, id).Error; err != nil {
+		return dbBranch, fetchBranchError(err)
+	}
+	return dbBranch, nil
+}
+
+// GetActiveBranchWithHours is GetBranchWithHours for the public endpoints, the inactive branches are not found
+// like in the public list
+func GetActiveBranchWithHours(db *gorm.DB, id uint) (models.Branch, error) {
+	branch, err := GetBranchWithHours(db, id)
+	if err != nil {
+		return branch, err
+	}
+	if !branch.IsActive {
+		return models.Branch{}, fetchBranchError(gorm.ErrRecordNotFound)
+	}
+	return branch, nil
+}
+
+// UpdateBranchHours replaces the weekly opening hours of a branch
+func UpdateBranchHours(db *gorm.DB, id uint, hoursData schemas.BranchHoursSchema) (models.Branch, error) {
+	branch, err := GetBranchByID(db, id)
+	if err != nil {
+		return branch, err
+	}
+	if _, err := time.LoadLocation(hoursData.Timezone); err != nil {
+		return branch, &core.HTTPError{
+			Message:    fmt.Sprintf("Unknown timezone %s", hoursData.Timezone),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	openingHours := make([]models.BranchOpeningHour, len(hoursData.OpeningHours))
+	for i, period := range hoursData.OpeningHours {
+		openingHours[i] = models.BranchOpeningHour{
+			BranchID: branch.ID,
+			Weekday:  time.Weekday(period.Weekday),
+			OpensAt:  period.OpensAt,
+			ClosesAt: period.ClosesAt,
+		}
+		if _, _, err := openingHours[i].Minutes(); err != nil {
+			return branch, &core.HTTPError{
+				Message:    fmt.Sprintf("Invalid opening hours: %s", err),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+	}
+
+	branch.Timezone = hoursData.Timezone
+	branch.SlotMinutes = hoursData.SlotMinutes
+	if hoursData.PickupLeadMinutes != nil {
+		branch.PickupLeadMinutes = *hoursData.PickupLeadMinutes
+	}
+	if hoursData.DeliveryLeadMinutes != nil {
+		branch.DeliveryLeadMinutes = *hoursData.DeliveryLeadMinutes
+	}
+	if hoursData.SlotCapacity != nil {
+		branch.SlotCapacity = *hoursData.SlotCapacity
+	}
+	if hoursData.ReleaseLeadMinutes != nil {
+		branch.ReleaseLeadMinutes = *hoursData.ReleaseLeadMinutes
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("branch_id = ?", branch.ID).Delete(&models.BranchOpeningHour{}).Error; err != nil {
+			return err
+		}
+		if len(openingHours) > 0 {
+			if err := tx.Create(&openingHours).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("OpeningHours", "Holidays", "Products").Save(&branch).Error
+	})
+	if err != nil {
+		return branch, &core.HTTPError{
+			Message:    fmt.Sprintf("Error updating opening hours: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return GetBranchWithHours(db, branch.ID)
+}
+
+func CreateBranchHoliday(db *gorm.DB, branchID uint, holidayData schemas.BranchHolidaySchema) (models.BranchHoliday, error) {
+	if _, err := GetBranchByID(db, branchID); err != nil {
+		return models.BranchHoliday{}, err
+	}
+	date, err := time.Parse(time.DateOnly, holidayData.Date)
+	if err != nil {
+		return models.BranchHoliday{}, &core.HTTPError{
+			Message:    "Invalid holiday date",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	holiday := models.BranchHoliday{BranchID: branchID, Date: date, Reason: holidayData.Reason}
+	if err := db.Create(&holiday).Error; err != nil {
+		return holiday, &core.HTTPError{
+			Message:    fmt.Sprintf("Error creating holiday: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return holiday, nil
+}
+
+func DeleteBranchHoliday(db *gorm.DB, holidayID uint) error {
+	result := db.Delete(&models.BranchHoliday{}, holidayID)
+	if result.Error != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error deleting holiday: %s", result.Error),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Holiday %d not found", holidayID),
 			StatusCode: http.StatusNotFound,
 		}
 	}
-	return dbBranch, nil
+	return nil
+}
+
+// SetBranchPause pauses or resumes order taking of a branch
+func SetBranchPause(db *gorm.DB, branchID uint, pauseData schemas.BranchPauseSchema) (models.Branch, error) {
+	branch, err := GetBranchByID(db, branchID)
+	if err != nil {
+		return branch, err
+	}
+	if pauseData.IsPaused && pauseData.PausedUntil != nil && !pauseData.PausedUntil.After(time.Now()) {
+		return branch, &core.HTTPError{
+			Message:    "paused_until must be in the future",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	branch.IsPaused = pauseData.IsPaused
+	branch.PausedUntil = nil
+	if pauseData.IsPaused {
+		branch.PausedUntil = pauseData.PausedUntil
+	}
+	if err := db.Model(&branch).Select("IsPaused", "PausedUntil").Updates(&branch).Error; err != nil {
+		return branch, &core.HTTPError{
+			Message:    fmt.Sprintf("Error updating branch pause: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return branch, nil
+}
+
+// CheckBranchAcceptsOrder rejects orders placed while the branch is closed or paused,
+// scheduleAt is nil for orders wanted as soon as possible
+func CheckBranchAcceptsOrder(db *gorm.DB, branchID uint, orderType string, scheduleAt *time.Time) error {
+	branch, err := GetBranchWithHours(db, branchID)
+	if err != nil {
+		return err
+	}
+	if !branch.IsActive {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Branch %s is not active", branch.Name),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	now := time.Now()
+
+	if scheduleAt == nil {
+		if branch.IsPausedAt(now) {
+			return &core.HTTPError{
+				Message:    fmt.Sprintf("Branch %s is not taking orders at the moment", branch.Name),
+				StatusCode: http.StatusConflict,
+			}
+		}
+		if !branch.IsOpenAt(now) {
+			return &core.HTTPError{
+				Message:    fmt.Sprintf("Branch %s is closed", branch.Name),
+				StatusCode: http.StatusConflict,
+			}
+		}
+		return nil
+	}
+
+	if earliest := now.Add(branch.LeadTime(orderType)); scheduleAt.Before(earliest) {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Scheduled time must be after %s", earliest.In(branch.Location()).Format(time.RFC3339)),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if branch.IsPausedAt(*scheduleAt) {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Branch %s is not taking orders at the scheduled time", branch.Name),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	if !branch.IsOpenAt(*scheduleAt) {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Branch %s is closed at the scheduled time", branch.Name),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// GetBranchSlots returns the next pickup and delivery slots of a branch
+func GetBranchSlots(db *gorm.DB, branchID uint, count int) (schemas.BranchSlotsResponseSchema, error) {
+	branch, err := GetActiveBranchWithHours(db, branchID)
+	if err != nil {
+		return schemas.BranchSlotsResponseSchema{}, err
+	}
+	now := time.Now()
+
+	var available func(time.Time) bool
+	if branch.SlotCapacity > 0 {
+		booked, err := slotBookings(db, branch.ID, now.Add(-branch.SlotLength()), now.AddDate(0, 0, slotSearchDays+1))
+		if err != nil {
+			return schemas.BranchSlotsResponseSchema{}, err
+		}
+		available = func(slot time.Time) bool {
+			return booked[slot.Unix()] < branch.SlotCapacity
+		}
+	}
+	return schemas.BranchSlotsResponseSchema{
+		BranchID: branch.ID,
+		Timezone: branch.Location().String(),
+		IsOpen:   branch.IsOpenAt(now) && !branch.IsPausedAt(now),
+		Pickup:   branch.NextSlots(now, "pickup", count, slotSearchDays, available),
+		Delivery: branch.NextSlots(now, "shipping", count, slotSearchDays, available),
+	}, nil
 }
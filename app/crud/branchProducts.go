@@ -0,0 +1,134 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// the reasons a branch doesn't sell a product, see ProductInBranch
+const (
+	NotSoldByBranch = "not sold by this branch"
+	NotAvailable    = "not available"
+)
+
+// ProductInBranch gives a product the values of a branch: the products of the branch are sold as they are, the
+// shared products with the price, stock and flags of their branch product. The reason tells why the branch doesn't
+// sell the product, it is empty when it does.
+func ProductInBranch(tx *gorm.DB, product *models.Product, branchID uint) (string, error) {
+	if product.BranchID != nil {
+		if *product.BranchID != branchID {
+			return NotSoldByBranch, nil
+		}
+		return "", nil
+	}
+	var branchProduct models.BranchProduct
+	err := tx.Where("product_id = ? AND branch_id = ?", product.ID, branchID).First(&branchProduct).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotSoldByBranch, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !branchProduct.IsActive {
+		return NotSoldByBranch, nil
+	}
+	branchProduct.Apply(product)
+	if !branchProduct.IsAvailable {
+		return NotAvailable, nil
+	}
+	return "", nil
+}
+
+// ListBranchProducts returns the branches selling a shared product
+func ListBranchProducts(db *gorm.DB, productID uint, pageParams pagination.Params) (pagination.Page[models.BranchProduct], error) {
+	if _, err := sharedProduct(db, productID); err != nil {
+		return pagination.Page[models.BranchProduct]{}, err
+	}
+	return pagination.Paginate(db.Model(&models.BranchProduct{}).Where("product_id = ?", productID),
+		pageParams, pagination.ByID("id", false),
+		func(branchProduct models.BranchProduct) ([]interface{}, uint) { return nil, branchProduct.ID })
+}
+
+// SetBranchProduct offers a shared product in a branch, or updates the branch values of the product
+func SetBranchProduct(db *gorm.DB, productID uint, data schemas.BranchProductSchema) (models.BranchProduct, error) {
+	var branchProduct models.BranchProduct
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := sharedProduct(tx, productID); err != nil {
+			return err
+		}
+		if _, err := GetBranchByID(tx, data.BranchID); err != nil {
+			return err
+		}
+		err := tx.Where("product_id = ? AND branch_id = ?", productID, data.BranchID).First(&branchProduct).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			branchProduct = models.BranchProduct{ProductID: productID, BranchID: data.BranchID, IsAvailable: true, IsActive: true}
+		} else if err != nil {
+			return branchProductError(err)
+		}
+
+		branchProduct.Price = data.Price
+		branchProduct.StockType = data.StockType
+		branchProduct.Stock = data.Stock
+		branchProduct.DailyStock = data.DailyStock
+		if data.IsAvailable != nil {
+			branchProduct.IsAvailable = *data.IsAvailable
+		}
+		if data.IsActive != nil {
+			branchProduct.IsActive = *data.IsActive
+		}
+		if err := tx.Omit("Product", "Branch").Save(&branchProduct).Error; err != nil {
+			return branchProductError(err)
+		}
+		return nil
+	})
+	return branchProduct, err
+}
+
+// RemoveBranchProduct stops selling a shared product in a branch
+func RemoveBranchProduct(db *gorm.DB, productID uint, branchID uint) error {
+	result := db.Where("product_id = ? AND branch_id = ?", productID, branchID).Delete(&models.BranchProduct{})
+	if result.Error != nil {
+		return branchProductError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Product %d is not sold by branch %d", productID, branchID),
+		}
+	}
+	return nil
+}
+
+// sharedProduct loads a product that the branches sell through branch products
+func sharedProduct(db *gorm.DB, productID uint) (models.Product, error) {
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return product, &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Product %d not found", productID),
+			}
+		}
+		return product, branchProductError(err)
+	}
+	if product.BranchID != nil {
+		return product, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Product %d belongs to branch %d, only the shared products are sold through branch products", productID, *product.BranchID),
+		}
+	}
+	return product, nil
+}
+
+func branchProductError(err error) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    fmt.Sprintf("Error saving branch product: %s", err),
+	}
+}
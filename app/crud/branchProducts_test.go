@@ -0,0 +1,135 @@
+package crud
+
+import (
+	"ecommerce/app/models"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// branchProductDB answers the branch product lookups with branchProduct, or not found when it is nil
+func branchProductDB(t *testing.T, branchProduct *models.BranchProduct) *gorm.DB {
+	t.Helper()
+	db, _ := dryRunDB(t, 0)
+	err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		dest, ok := db.Statement.Dest.(*models.BranchProduct)
+		if !ok || branchProduct == nil {
+			db.AddError(gorm.ErrRecordNotFound)
+			return
+		}
+		*dest = *branchProduct
+		db.RowsAffected = 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestProductInBranch(t *testing.T) {
+	branchID, otherBranchID := uint(3), uint(4)
+	branchPrice := 7.5
+	tests := []struct {
+		name          string
+		product       models.Product
+		branchProduct *models.BranchProduct
+		reason        string
+		// the values the product gets in the branch
+		price     float64
+		stockType string
+		stock     uint
+		isActive  bool
+		available *bool
+	}{
+		{
+			name:      "product of the branch",
+			product:   models.Product{BranchID: &branchID, Price: 9, StockType: "FIXED", Stock: 2, IsActive: true},
+			price:     9,
+			stockType: "FIXED",
+			stock:     2,
+			isActive:  true,
+		},
+		{
+			name:     "product of another branch",
+			product:  models.Product{BranchID: &otherBranchID, Price: 9, IsActive: true},
+			reason:   NotSoldByBranch,
+			price:    9,
+			isActive: true,
+		},
+		{
+			name:     "shared product not offered",
+			product:  models.Product{Price: 9, IsActive: true},
+			reason:   NotSoldByBranch,
+			price:    9,
+			isActive: true,
+		},
+		{
+			name:          "shared product inactive in the branch",
+			product:       models.Product{Price: 9, IsActive: true},
+			branchProduct: &models.BranchProduct{Price: &branchPrice, StockType: "FIXED", Stock: 4, IsAvailable: true},
+			reason:        NotSoldByBranch,
+			price:         9,
+			isActive:      true,
+		},
+		{
+			name:          "branch price and stock",
+			product:       models.Product{Price: 9, StockType: "INFINITE", Stock: 100, IsActive: true},
+			branchProduct: &models.BranchProduct{Price: &branchPrice, StockType: "FIXED", Stock: 4, IsAvailable: true, IsActive: true},
+			price:         7.5,
+			stockType:     "FIXED",
+			stock:         4,
+			isActive:      true,
+			available:     boolPointer(true),
+		},
+		{
+			name:          "master price without a branch price",
+			product:       models.Product{Price: 9, IsActive: true},
+			branchProduct: &models.BranchProduct{StockType: "DAILY", Stock: 6, IsAvailable: true, IsActive: true},
+			price:         9,
+			stockType:     "DAILY",
+			stock:         6,
+			isActive:      true,
+			available:     boolPointer(true),
+		},
+		{
+			name:          "unavailable in the branch",
+			product:       models.Product{Price: 9, IsActive: true},
+			branchProduct: &models.BranchProduct{Price: &branchPrice, StockType: "FIXED", IsActive: true},
+			reason:        NotAvailable,
+			price:         7.5,
+			stockType:     "FIXED",
+			isActive:      true,
+			available:     boolPointer(false),
+		},
+		{
+			name:          "inactive master product",
+			product:       models.Product{Price: 9},
+			branchProduct: &models.BranchProduct{StockType: "FIXED", IsAvailable: true, IsActive: true},
+			price:         9,
+			stockType:     "FIXED",
+			available:     boolPointer(true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := tt.product
+			reason, err := ProductInBranch(branchProductDB(t, tt.branchProduct), &product, branchID)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if reason != tt.reason {
+				t.Errorf("reason: got %q, want %q", reason, tt.reason)
+			}
+			if product.Price != tt.price || product.StockType != tt.stockType || product.Stock != tt.stock || product.IsActive != tt.isActive {
+				t.Errorf("got price %v, stock %s %d, active %t, want %v, %s %d, %t",
+					product.Price, product.StockType, product.Stock, product.IsActive, tt.price, tt.stockType, tt.stock, tt.isActive)
+			}
+			if (product.IsAvailable == nil) != (tt.available == nil) || (tt.available != nil && *product.IsAvailable != *tt.available) {
+				t.Errorf("available: got %v, want %v", product.IsAvailable, tt.available)
+			}
+		})
+	}
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
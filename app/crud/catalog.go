@@ -0,0 +1,589 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/search"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mediaImagePrefix marks the uploaded images in the catalogs, e.g. media:12
+const mediaImagePrefix = "media:"
+
+// maxReportedMissingSKUs caps the products reported by an export refused for missing SKUs
+const maxReportedMissingSKUs = 50
+
+// errCatalogRollback rolls back the imports that are dry runs or have errors
+var errCatalogRollback = errors.New("catalog import rolled back")
+
+// ImportCatalog creates or updates the products of a branch by SKU. The import is all or nothing: every row
+// is checked and saved in one transaction, which is only committed when no row has an error and it isn't a
+// dry run. rowErrors are the rows ParseCatalog couldn't read, they are reported with the others.
+func ImportCatalog(db *gorm.DB, branchID uint, rows []schemas.CatalogProductSchema, rowErrors []schemas.CatalogRowErrorSchema, dryRun bool) (schemas.CatalogImportResultSchema, error) {
+	result := schemas.CatalogImportResultSchema{DryRun: dryRun, Errors: rowErrors}
+	if _, err := GetBranchByID(db, branchID); err != nil {
+		return result, err
+	}
+
+	skipped := make(map[int]bool, len(rowErrors))
+	for _, rowError := range rowErrors {
+		skipped[rowError.Row] = true
+	}
+	skuRows := make(map[string]int, len(rows))
+	for i, row := range rows {
+		if skipped[i+1] {
+			continue
+		}
+		if err := binding.Validator.ValidateStruct(&row); err != nil {
+			result.Errors = append(result.Errors, schemas.CatalogRowErrorSchema{Row: i + 1, SKU: row.SKU, Errors: core.ValidationMessages(err)})
+			skipped[i+1] = true
+			continue
+		}
+		if first, ok := skuRows[row.SKU]; ok {
+			result.Errors = append(result.Errors, schemas.CatalogRowErrorSchema{
+				Row:    i + 1,
+				SKU:    row.SKU,
+				Errors: map[string]interface{}{"SKU": fmt.Sprintf("SKU %s is already used by row %d", row.SKU, first)},
+			})
+			skipped[i+1] = true
+			continue
+		}
+		skuRows[row.SKU] = i + 1
+	}
+
+	var valid []int
+	for i := range rows {
+		if !skipped[i+1] {
+			valid = append(valid, i)
+		}
+	}
+	err := saveCatalogRows(db, &result, valid, func(tx *gorm.DB, i int) (models.Product, bool, error) {
+		return importCatalogProduct(tx, branchID, rows[i])
+	}, func(i int, err error) schemas.CatalogRowErrorSchema {
+		return catalogRowError(i+1, rows[i].SKU, err)
+	})
+	return result, err
+}
+
+// CopyCatalog copies the products of a branch, with their variations, options, addons and images, to another
+// branch. Like the imports it is all or nothing, the errors are reported by source product.
+func CopyCatalog(db *gorm.DB, request schemas.CatalogCopySchema) (schemas.CatalogImportResultSchema, error) {
+	result := schemas.CatalogImportResultSchema{DryRun: request.DryRun}
+	if _, err := GetBranchByID(db, request.SourceBranchID); err != nil {
+		return result, err
+	}
+	if _, err := GetBranchByID(db, request.TargetBranchID); err != nil {
+		return result, err
+	}
+
+	var sources []models.Product
+	query := preloadCatalogProduct(db).Where("branch_id = ?", request.SourceBranchID)
+	if len(request.ProductIDs) > 0 {
+		query = query.Where("id IN ?", request.ProductIDs)
+	}
+	if err := query.Order("id").Find(&sources).Error; err != nil {
+		return result, catalogError(err)
+	}
+	if len(request.ProductIDs) > 0 && len(sources) != len(uniqueIDs(request.ProductIDs)) {
+		return result, &core.ValidationError{Field: "ProductIDs", Message: "Some products don't exist in the source branch"}
+	}
+	copied := make(map[uint]bool, len(sources))
+	for _, source := range sources {
+		copied[source.ID] = true
+	}
+	overrides := make(map[uint]float64, len(request.PriceOverrides))
+	for _, override := range request.PriceOverrides {
+		if !copied[override.ProductID] {
+			return result, &core.ValidationError{
+				Field:   "PriceOverrides",
+				Message: fmt.Sprintf("Product %d isn't copied from the source branch", override.ProductID),
+			}
+		}
+		overrides[override.ProductID] = override.Price
+	}
+
+	rows := make([]int, len(sources))
+	for i := range sources {
+		rows[i] = i
+	}
+	err := saveCatalogRows(db, &result, rows, func(tx *gorm.DB, i int) (models.Product, bool, error) {
+		return copyCatalogProduct(tx, request, sources[i], overrides)
+	}, func(i int, err error) schemas.CatalogRowErrorSchema {
+		rowError := catalogRowError(i+1, "", err)
+		rowError.ProductID = sources[i].ID
+		if sources[i].SKU != nil {
+			rowError.SKU = *sources[i].SKU
+		}
+		return rowError
+	})
+	return result, err
+}
+
+// copyCatalogProduct copies a product to the target branch, or updates its copy. The copy is found by its link to
+// the source, or else by SKU, and keeps its stock.
+func copyCatalogProduct(tx *gorm.DB, request schemas.CatalogCopySchema, source models.Product, overrides map[uint]float64) (models.Product, bool, error) {
+	row := catalogProduct(source)
+	adjust := func(price float64) float64 {
+		return models.RoundMoney(price * (100 + request.PriceAdjustmentPercent) / 100)
+	}
+	row.Price = adjust(row.Price)
+	if price, ok := overrides[source.ID]; ok {
+		row.Price = price
+	}
+	if row.DiscountType == "fixed" {
+		row.DiscountValue = math.Min(adjust(row.DiscountValue), row.Price)
+	}
+	for i := range row.Addons {
+		row.Addons[i].Price = adjust(row.Addons[i].Price)
+	}
+	for i := range row.Variations {
+		for j := range row.Variations[i].Options {
+			row.Variations[i].Options[j].Price = adjust(row.Variations[i].Options[j].Price)
+		}
+	}
+
+	var product models.Product
+	err := tx.Preload("Images").Where("branch_id = ? AND source_product_id = ?", request.TargetBranchID, source.ID).First(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && source.SKU != nil {
+		err = tx.Preload("Images").Where("branch_id = ? AND sku = ?", request.TargetBranchID, *source.SKU).First(&product).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return product, false, productError(err)
+	}
+	created := product.ID == 0
+	if !created {
+		row.Stock = product.Stock
+		row.DailyStock = product.DailyStock
+	} else if request.ResetStock {
+		row.Stock = 0
+	}
+	if request.LinkSource {
+		product.SourceProductID = &source.ID
+	}
+	return product, created, saveCatalogProduct(tx, &product, request.TargetBranchID, row)
+}
+
+// saveCatalogRows saves the given rows in one transaction, every row in a nested transaction (a savepoint) so a
+// failed row doesn't abort the others. It is only committed when no row has an error and it isn't a dry run,
+// the saved products are indexed for the search then.
+func saveCatalogRows(db *gorm.DB, result *schemas.CatalogImportResultSchema, rows []int, save func(tx *gorm.DB, i int) (models.Product, bool, error), rowError func(i int, err error) schemas.CatalogRowErrorSchema) error {
+	var productIDs []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, i := range rows {
+			var product models.Product
+			var created bool
+			err := tx.Transaction(func(rowTx *gorm.DB) error {
+				var err error
+				product, created, err = save(rowTx, i)
+				return err
+			})
+			if err != nil {
+				result.Errors = append(result.Errors, rowError(i, err))
+				continue
+			}
+			if created {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+			productIDs = append(productIDs, product.ID)
+		}
+		if result.DryRun || len(result.Errors) > 0 {
+			return errCatalogRollback
+		}
+		return nil
+	})
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	if err != nil {
+		if errors.Is(err, errCatalogRollback) {
+			return nil
+		}
+		return catalogError(err)
+	}
+	for _, productID := range productIDs {
+		if err := search.Index(db, productID); err != nil {
+			log.Printf("Error indexing product %d: %v", productID, err)
+		}
+	}
+	return nil
+}
+
+// ExportCatalog gives the products of a branch in the import format
+func ExportCatalog(db *gorm.DB, branchID uint) ([]schemas.CatalogProductSchema, error) {
+	if _, err := GetBranchByID(db, branchID); err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	if err := preloadCatalogProduct(db).Where("branch_id = ?", branchID).Order("id").Find(&products).Error; err != nil {
+		return nil, catalogError(err)
+	}
+
+	// the imports match the products by SKU, a catalog with products without one wouldn't import back
+	var missingSKUs []string
+	for _, product := range products {
+		if product.SKU == nil && len(missingSKUs) < maxReportedMissingSKUs {
+			missingSKUs = append(missingSKUs, strconv.FormatUint(uint64(product.ID), 10))
+		}
+	}
+	if len(missingSKUs) > 0 {
+		return nil, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("Products without SKU can not be exported, give a SKU to the products %s", strings.Join(missingSKUs, ", ")),
+		}
+	}
+
+	catalog := make([]schemas.CatalogProductSchema, len(products))
+	for i, product := range products {
+		catalog[i] = catalogProduct(product)
+	}
+	return catalog, nil
+}
+
+// preloadCatalogProduct loads what the catalogs carry, in a stable order
+func preloadCatalogProduct(query *gorm.DB) *gorm.DB {
+	return query.Preload("Category").Preload("Categories").Preload("Addons").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Variations", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Variations.Options", func(db *gorm.DB) *gorm.DB { return db.Order("variation_options.id") })
+}
+
+// importCatalogProduct creates or updates the product of a row, matched by SKU
+func importCatalogProduct(tx *gorm.DB, branchID uint, row schemas.CatalogProductSchema) (models.Product, bool, error) {
+	var product models.Product
+	err := tx.Preload("Images").Where("branch_id = ? AND sku = ?", branchID, row.SKU).First(&product).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return product, false, productError(err)
+	}
+	created := product.ID == 0
+	return product, created, saveCatalogProduct(tx, &product, branchID, row)
+}
+
+// saveCatalogProduct creates or updates a product from a catalog row, through the checks of the product endpoints.
+// The product images must be loaded, they keep their alt text.
+func saveCatalogProduct(tx *gorm.DB, product *models.Product, branchID uint, row schemas.CatalogProductSchema) error {
+	created := product.ID == 0
+
+	categoryID, err := catalogCategoryID(tx, "Category", row.Category)
+	if err != nil {
+		return err
+	}
+	categoryIDs := make([]uint, len(row.Categories))
+	for i, reference := range row.Categories {
+		if categoryIDs[i], err = catalogCategoryID(tx, "Categories", reference); err != nil {
+			return err
+		}
+	}
+	addonIDs, err := importCatalogAddons(tx, row.Addons)
+	if err != nil {
+		return err
+	}
+	images, err := catalogImages(product.Images, row.Images)
+	if err != nil {
+		return err
+	}
+
+	productData := schemas.ProductSchema{
+		Title:         row.Title,
+		SKU:           row.SKU,
+		Barcode:       row.Barcode,
+		Price:         row.Price,
+		Description:   row.Description,
+		Tags:          row.Tags,
+		Images:        images,
+		Attributes:    row.Attributes,
+		IsActive:      row.IsActive,
+		PublishFrom:   row.PublishFrom,
+		PublishUntil:  row.PublishUntil,
+		StockType:     row.StockType,
+		Stock:         row.Stock,
+		DailyStock:    row.DailyStock,
+		DiscountType:  row.DiscountType,
+		DiscountValue: row.DiscountValue,
+		Weight:        row.Weight,
+		TaxCategoryID: row.TaxCategoryID,
+		CategoryID:    categoryID,
+		CategoryIDs:   categoryIDs,
+		BranchID:      &branchID,
+		AddonIDs:      addonIDs,
+	}
+	// the catalogs don't carry the slugs (they must be unique across the branches) nor the legacy subcategories,
+	// the updated products keep theirs
+	if created {
+		product.IsActive = true
+	} else {
+		if product.Slug != nil {
+			productData.Slug = *product.Slug
+		}
+		if product.CategoryID == categoryID {
+			productData.SubCategoryID = product.SubCategoryID
+		}
+	}
+
+	if err := applyProductData(tx, product, productData); err != nil {
+		return err
+	}
+	if err := tx.Omit("Images", "Addons").Save(product).Error; err != nil {
+		return productError(err)
+	}
+	if err := saveProductRelations(tx, product, productData); err != nil {
+		return err
+	}
+	return importCatalogVariations(tx, product, row.Variations)
+}
+
+// catalogCategoryID finds a category by slug, or by id for the categories without slug
+func catalogCategoryID(tx *gorm.DB, field string, reference string) (uint, error) {
+	var category models.Category
+	err := tx.Where("slug = ?", reference).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if id, parseErr := strconv.ParseUint(reference, 10, 32); parseErr == nil {
+			err = tx.First(&category, id).Error
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, &core.ValidationError{Field: field, Message: fmt.Sprintf("Category %s doesn't exist", reference)}
+	}
+	if err != nil {
+		return 0, categoryError(err)
+	}
+	return category.ID, nil
+}
+
+// importCatalogAddons finds the addons with the same title, price and tax category, and creates the missing ones
+func importCatalogAddons(tx *gorm.DB, catalogAddons []schemas.CatalogAddonSchema) ([]uint, error) {
+	addonIDs := make([]uint, len(catalogAddons))
+	for i, catalogAddon := range catalogAddons {
+		query := tx.Where("title = ? AND price = ?", catalogAddon.Title, catalogAddon.Price)
+		if catalogAddon.TaxCategoryID != nil {
+			if err := tx.First(&models.TaxCategory{}, *catalogAddon.TaxCategoryID).Error; err != nil {
+				return nil, &core.ValidationError{
+					Field:   "Addons",
+					Message: fmt.Sprintf("Tax category %d doesn't exist", *catalogAddon.TaxCategoryID),
+				}
+			}
+			query = query.Where("tax_category_id = ?", *catalogAddon.TaxCategoryID)
+		} else {
+			query = query.Where("tax_category_id IS NULL")
+		}
+
+		addon := models.Addon{Title: catalogAddon.Title, Price: catalogAddon.Price, TaxCategoryID: catalogAddon.TaxCategoryID}
+		if err := query.Order("id").FirstOrCreate(&addon).Error; err != nil {
+			return nil, productError(err)
+		}
+		addonIDs[i] = addon.ID
+	}
+	return addonIDs, nil
+}
+
+// importCatalogVariations replaces the variations of a product. The variations and the options are matched by
+// title and updated in place, so the past orders keep pointing at them, the variations no longer in the catalog
+// are deleted.
+func importCatalogVariations(tx *gorm.DB, product *models.Product, catalogVariations []schemas.CatalogVariationSchema) error {
+	var current []models.ProductVariation
+	if err := tx.Preload("Options").Where("product_id = ?", product.ID).Find(&current).Error; err != nil {
+		return productError(err)
+	}
+	currentByTitle := make(map[string]models.ProductVariation, len(current))
+	for _, variation := range current {
+		currentByTitle[variation.Title] = variation
+	}
+
+	kept := make(map[uint]bool, len(catalogVariations))
+	variationTitles := make(map[string]bool, len(catalogVariations))
+	product.Variations = make([]models.ProductVariation, len(catalogVariations))
+	for i, catalogVariation := range catalogVariations {
+		if catalogVariation.MaxSelections > 0 && catalogVariation.MinSelections > catalogVariation.MaxSelections {
+			return &core.ValidationError{
+				Field:   "Variations",
+				Message: fmt.Sprintf("The min selections of %s must not be above its max selections", catalogVariation.Title),
+			}
+		}
+		if variationTitles[catalogVariation.Title] {
+			return &core.ValidationError{Field: "Variations", Message: fmt.Sprintf("Variation %s is given more than once", catalogVariation.Title)}
+		}
+		variationTitles[catalogVariation.Title] = true
+		variation, ok := currentByTitle[catalogVariation.Title]
+		if !ok {
+			variation = models.ProductVariation{ProductID: product.ID}
+		}
+		currentOptions := make(map[string]models.VariationOption, len(variation.Options))
+		for _, option := range variation.Options {
+			currentOptions[option.Title] = option
+		}
+
+		variation.Title = catalogVariation.Title
+		variation.Type = catalogVariation.Type
+		variation.MinSelections = catalogVariation.MinSelections
+		variation.MaxSelections = catalogVariation.MaxSelections
+		variation.Required = catalogVariation.Required
+		if err := tx.Omit("Product", "Options").Save(&variation).Error; err != nil {
+			return productError(err)
+		}
+		kept[variation.ID] = true
+
+		options := make([]models.VariationOption, len(catalogVariation.Options))
+		optionTitles := make(map[string]bool, len(catalogVariation.Options))
+		for j, catalogOption := range catalogVariation.Options {
+			if optionTitles[catalogOption.Title] {
+				return &core.ValidationError{
+					Field:   "Variations",
+					Message: fmt.Sprintf("Option %s of %s is given more than once", catalogOption.Title, catalogVariation.Title),
+				}
+			}
+			optionTitles[catalogOption.Title] = true
+			option := currentOptions[catalogOption.Title]
+			option.Title = catalogOption.Title
+			option.Price = catalogOption.Price
+			if err := tx.Omit("Variations").Save(&option).Error; err != nil {
+				return productError(err)
+			}
+			options[j] = option
+		}
+		if err := tx.Model(&variation).Association("Options").Replace(options); err != nil {
+			return productError(err)
+		}
+		variation.Options = options
+		product.Variations[i] = variation
+	}
+
+	for _, variation := range current {
+		if !kept[variation.ID] {
+			if err := tx.Delete(&variation).Error; err != nil {
+				return productError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// catalogImages reads the image references of a row, the images already on the product keep their alt text
+func catalogImages(current []models.ProductImage, references []string) ([]schemas.ProductImageSchema, error) {
+	altTexts := make(map[string]string, len(current))
+	for _, image := range current {
+		altTexts[catalogImageReference(image)] = image.AltText
+	}
+
+	images := make([]schemas.ProductImageSchema, len(references))
+	for i, reference := range references {
+		images[i].AltText = altTexts[reference]
+		if value, ok := strings.CutPrefix(reference, mediaImagePrefix); ok {
+			mediaID, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, &core.ValidationError{Field: "Images", Message: fmt.Sprintf("Invalid media image %s", reference)}
+			}
+			id := uint(mediaID)
+			images[i].MediaID = &id
+			continue
+		}
+		parsed, err := url.ParseRequestURI(reference)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, &core.ValidationError{Field: "Images", Message: fmt.Sprintf("Invalid image URL %s", reference)}
+		}
+		images[i].URL = reference
+	}
+	return images, nil
+}
+
+func catalogImageReference(image models.ProductImage) string {
+	if image.MediaID != nil {
+		return fmt.Sprintf("%s%d", mediaImagePrefix, *image.MediaID)
+	}
+	return image.URL
+}
+
+func catalogProduct(product models.Product) schemas.CatalogProductSchema {
+	catalogProduct := schemas.CatalogProductSchema{
+		Title:         product.Title,
+		Price:         product.Price,
+		Description:   product.Description,
+		Tags:          product.Tags,
+		Category:      catalogCategoryReference(product.Category),
+		StockType:     product.StockType,
+		Stock:         product.Stock,
+		DailyStock:    product.DailyStock,
+		DiscountType:  product.DiscountType,
+		DiscountValue: product.DiscountValue,
+		Weight:        product.Weight,
+		TaxCategoryID: product.TaxCategoryID,
+		IsActive:      &product.IsActive,
+		PublishFrom:   product.PublishFrom,
+		PublishUntil:  product.PublishUntil,
+		Attributes:    product.Attributes,
+	}
+	if product.SKU != nil {
+		catalogProduct.SKU = *product.SKU
+	}
+	if product.Barcode != nil {
+		catalogProduct.Barcode = *product.Barcode
+	}
+	for _, category := range product.Categories {
+		if category.ID != product.CategoryID {
+			catalogProduct.Categories = append(catalogProduct.Categories, catalogCategoryReference(category))
+		}
+	}
+	for _, image := range product.Images {
+		catalogProduct.Images = append(catalogProduct.Images, catalogImageReference(image))
+	}
+	for _, addon := range product.Addons {
+		catalogProduct.Addons = append(catalogProduct.Addons, schemas.CatalogAddonSchema{
+			Title:         addon.Title,
+			Price:         addon.Price,
+			TaxCategoryID: addon.TaxCategoryID,
+		})
+	}
+	for _, variation := range product.Variations {
+		options := make([]schemas.CatalogVariationOptionSchema, len(variation.Options))
+		for i, option := range variation.Options {
+			options[i] = schemas.CatalogVariationOptionSchema{Title: option.Title, Price: option.Price}
+		}
+		catalogProduct.Variations = append(catalogProduct.Variations, schemas.CatalogVariationSchema{
+			Title:         variation.Title,
+			Type:          variation.Type,
+			MinSelections: variation.MinSelections,
+			MaxSelections: variation.MaxSelections,
+			Required:      variation.Required,
+			Options:       options,
+		})
+	}
+	return catalogProduct
+}
+
+func catalogCategoryReference(category models.Category) string {
+	if category.Slug != nil {
+		return *category.Slug
+	}
+	return strconv.FormatUint(uint64(category.ID), 10)
+}
+
+func catalogRowError(row int, sku string, err error) schemas.CatalogRowErrorSchema {
+	rowError := schemas.CatalogRowErrorSchema{Row: row, SKU: sku, Errors: map[string]interface{}{}}
+	var validationErr *core.ValidationError
+	var httpErr *core.HTTPError
+	switch {
+	case errors.As(err, &validationErr):
+		rowError.Errors[validationErr.Field] = validationErr.Message
+	case errors.As(err, &httpErr):
+		rowError.Errors["general"] = httpErr.Message
+	default:
+		rowError.Errors["general"] = err.Error()
+	}
+	return rowError
+}
+
+func catalogError(err error) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    fmt.Sprintf("Error with the catalog: %s", err),
+	}
+}
@@ -0,0 +1,315 @@
+package crud
+
+import (
+	"bytes"
+	"ecommerce/app/core"
+	"ecommerce/app/schemas"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CatalogCSV  = "csv"
+	CatalogJSON = "json"
+
+	maxCatalogRows = 5000
+	// catalogListSeparator joins the values of the list columns of the CSV files
+	catalogListSeparator = "|"
+)
+
+// catalogColumns are the columns of the CSV catalogs, the nested values (attributes, addons and variations) are JSON cells
+var catalogColumns = []string{
+	"sku", "title", "barcode", "price", "description", "tags", "category", "categories",
+	"stock_type", "stock", "daily_stock", "discount_type", "discount_value", "weight", "tax_category_id",
+	"is_active", "publish_from", "publish_until", "images", "attributes", "addons", "variations",
+}
+
+// CatalogFormat gives the format of a catalog file, the requested one or else the one of the file extension
+func CatalogFormat(requested string, filename string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CatalogCSV, nil
+	case ".json":
+		return CatalogJSON, nil
+	}
+	return "", &core.ValidationError{Field: "format", Message: "This field is required when the file is not a .csv or .json file"}
+}
+
+// ParseCatalog reads a catalog file. The rows that can't be read are returned as row errors so they are
+// reported together with the other errors, an error is only returned when the file itself can't be read.
+func ParseCatalog(r io.Reader, format string) ([]schemas.CatalogProductSchema, []schemas.CatalogRowErrorSchema, error) {
+	if format == CatalogJSON {
+		return parseJSONCatalog(r)
+	}
+	return parseCSVCatalog(r)
+}
+
+// WriteCatalog writes a catalog in the format read by ParseCatalog
+func WriteCatalog(w io.Writer, format string, products []schemas.CatalogProductSchema) error {
+	if format == CatalogJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(schemas.CatalogSchema{Products: products})
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(catalogColumns); err != nil {
+		return err
+	}
+	for _, product := range products {
+		record, err := catalogRecord(product)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func parseJSONCatalog(r io.Reader) ([]schemas.CatalogProductSchema, []schemas.CatalogRowErrorSchema, error) {
+	var catalog struct {
+		Products []json.RawMessage `json:"products"`
+	}
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return nil, nil, &core.ValidationError{Field: "file", Message: fmt.Sprintf("Invalid JSON catalog: %s", err)}
+	}
+	if len(catalog.Products) > maxCatalogRows {
+		return nil, nil, tooManyCatalogRows()
+	}
+
+	products := make([]schemas.CatalogProductSchema, len(catalog.Products))
+	var rowErrors []schemas.CatalogRowErrorSchema
+	for i, raw := range catalog.Products {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&products[i]); err != nil {
+			rowErrors = append(rowErrors, schemas.CatalogRowErrorSchema{
+				Row:    i + 1,
+				SKU:    products[i].SKU,
+				Errors: core.ValidationMessages(err),
+			})
+		}
+	}
+	return products, rowErrors, nil
+}
+
+func parseCSVCatalog(r io.Reader) ([]schemas.CatalogProductSchema, []schemas.CatalogRowErrorSchema, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, &core.ValidationError{Field: "file", Message: fmt.Sprintf("Invalid CSV catalog: %s", err)}
+	}
+	// spreadsheet programs often start their CSV exports with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	known := make(map[string]bool, len(catalogColumns))
+	for _, column := range catalogColumns {
+		known[column] = true
+	}
+	seen := make(map[string]bool, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !known[column] || seen[column] {
+			return nil, nil, &core.ValidationError{Field: "file", Message: fmt.Sprintf("Unknown or repeated column %q", column)}
+		}
+		seen[column] = true
+		header[i] = column
+	}
+
+	var products []schemas.CatalogProductSchema
+	var rowErrors []schemas.CatalogRowErrorSchema
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(products) == maxCatalogRows {
+			return nil, nil, tooManyCatalogRows()
+		}
+		// a row with a wrong number of fields is still read, the following rows can be checked
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, nil, &core.ValidationError{Field: "file", Message: fmt.Sprintf("Invalid CSV catalog: %s", err)}
+		}
+		var product schemas.CatalogProductSchema
+		var errs map[string]interface{}
+		if err != nil {
+			errs = map[string]interface{}{"general": fmt.Sprintf("The row has %d fields instead of %d", len(record), len(header))}
+		} else {
+			product, errs = parseCatalogRecord(header, record)
+		}
+		products = append(products, product)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, schemas.CatalogRowErrorSchema{Row: len(products), SKU: product.SKU, Errors: errs})
+		}
+	}
+	return products, rowErrors, nil
+}
+
+// parseCatalogRecord reads a CSV row, the errors are given by column
+func parseCatalogRecord(header []string, record []string) (schemas.CatalogProductSchema, map[string]interface{}) {
+	var product schemas.CatalogProductSchema
+	errs := make(map[string]interface{})
+	for i, column := range header {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+		var err error
+		switch column {
+		case "sku":
+			product.SKU = value
+		case "title":
+			product.Title = value
+		case "barcode":
+			product.Barcode = value
+		case "price":
+			product.Price, err = strconv.ParseFloat(value, 64)
+		case "description":
+			product.Description = value
+		case "tags":
+			product.Tags = splitCatalogList(value)
+		case "category":
+			product.Category = value
+		case "categories":
+			product.Categories = splitCatalogList(value)
+		case "stock_type":
+			product.StockType = value
+		case "stock":
+			product.Stock, err = parseCatalogUint(value)
+		case "daily_stock":
+			product.DailyStock, err = parseCatalogUint(value)
+		case "discount_type":
+			product.DiscountType = value
+		case "discount_value":
+			product.DiscountValue, err = strconv.ParseFloat(value, 64)
+		case "weight":
+			product.Weight, err = strconv.ParseFloat(value, 64)
+		case "tax_category_id":
+			var id uint
+			id, err = parseCatalogUint(value)
+			product.TaxCategoryID = &id
+		case "is_active":
+			var active bool
+			active, err = strconv.ParseBool(value)
+			product.IsActive = &active
+		case "publish_from":
+			product.PublishFrom, err = parseCatalogTime(value)
+		case "publish_until":
+			product.PublishUntil, err = parseCatalogTime(value)
+		case "images":
+			product.Images = splitCatalogList(value)
+		case "attributes":
+			err = json.Unmarshal([]byte(value), &product.Attributes)
+		case "addons":
+			err = json.Unmarshal([]byte(value), &product.Addons)
+		case "variations":
+			err = json.Unmarshal([]byte(value), &product.Variations)
+		}
+		if err != nil {
+			errs[column] = fmt.Sprintf("Invalid value %q", value)
+		}
+	}
+	return product, errs
+}
+
+// catalogRecord writes a product as a CSV row in the order of catalogColumns
+func catalogRecord(product schemas.CatalogProductSchema) ([]string, error) {
+	attributes, err := catalogJSONCell(len(product.Attributes), product.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	addons, err := catalogJSONCell(len(product.Addons), product.Addons)
+	if err != nil {
+		return nil, err
+	}
+	variations, err := catalogJSONCell(len(product.Variations), product.Variations)
+	if err != nil {
+		return nil, err
+	}
+	taxCategoryID := ""
+	if product.TaxCategoryID != nil {
+		taxCategoryID = strconv.FormatUint(uint64(*product.TaxCategoryID), 10)
+	}
+	isActive := ""
+	if product.IsActive != nil {
+		isActive = strconv.FormatBool(*product.IsActive)
+	}
+	return []string{
+		product.SKU,
+		product.Title,
+		product.Barcode,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		product.Description,
+		strings.Join(product.Tags, catalogListSeparator),
+		product.Category,
+		strings.Join(product.Categories, catalogListSeparator),
+		product.StockType,
+		strconv.FormatUint(uint64(product.Stock), 10),
+		strconv.FormatUint(uint64(product.DailyStock), 10),
+		product.DiscountType,
+		strconv.FormatFloat(product.DiscountValue, 'f', -1, 64),
+		strconv.FormatFloat(product.Weight, 'f', -1, 64),
+		taxCategoryID,
+		isActive,
+		formatCatalogTime(product.PublishFrom),
+		formatCatalogTime(product.PublishUntil),
+		strings.Join(product.Images, catalogListSeparator),
+		attributes,
+		addons,
+		variations,
+	}, nil
+}
+
+func catalogJSONCell(length int, value interface{}) (string, error) {
+	if length == 0 {
+		return "", nil
+	}
+	cell, err := json.Marshal(value)
+	return string(cell), err
+}
+
+func splitCatalogList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, catalogListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func parseCatalogUint(value string) (uint, error) {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	return uint(parsed), err
+}
+
+func parseCatalogTime(value string) (*time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func formatCatalogTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.Format(time.RFC3339)
+}
+
+func tooManyCatalogRows() error {
+	return &core.ValidationError{Field: "file", Message: fmt.Sprintf("A catalog can have at most %d products", maxCatalogRows)}
+}
@@ -2,34 +2,23 @@ package crud
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/models"
+	"ecommerce/app/schemas"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"net/http"
 )
 
-func ListCategories(db *gorm.DB) ([]models.Category, error) {
-	var dbCategories []models.Category
-
-	if err := db.Preload("SubCategories").Find(&dbCategories).Error; err != nil {
-		return nil, &core.HTTPError{
-			Message:    "Error getting categories",
-			StatusCode: http.StatusInternalServerError,
-		}
-	}
-	return dbCategories, nil
+func ListCategories(db *gorm.DB, pageParams pagination.Params) (pagination.Page[models.Category], error) {
+	return pagination.Paginate(db.Model(&models.Category{}).Preload("SubCategories"), pageParams, pagination.ByID("id", false),
+		func(category models.Category) ([]interface{}, uint) { return nil, category.ID })
 }
 
-func ListSubCategories(db *gorm.DB) ([]models.SubCategory, error) {
-	var dbSubCategories []models.SubCategory
-
-	if err := db.Find(&dbSubCategories).Error; err != nil {
-		return nil, &core.HTTPError{
-			Message:    "Error getting subCategories",
-			StatusCode: http.StatusInternalServerError,
-		}
-	}
-	return dbSubCategories, nil
+func ListSubCategories(db *gorm.DB, pageParams pagination.Params) (pagination.Page[models.SubCategory], error) {
+	return pagination.Paginate(db.Model(&models.SubCategory{}), pageParams, pagination.ByID("id", false),
+		func(subCategory models.SubCategory) ([]interface{}, uint) { return nil, subCategory.ID })
 }
 
 func GetCategoryByID(db *gorm.DB, id uint) (models.Category, error) {
@@ -65,3 +54,317 @@ func GetSubCategoryByID(db *gorm.DB, id uint) (models.SubCategory, error) {
 	}
 	return dbSubCategory, nil
 }
+
+func GetCategoryBySlug(db *gorm.DB, slug string) (models.Category, error) {
+	var dbCategory models.Category
+	if err := db.Preload("Media").Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Where("slug = ?", slug).First(&dbCategory).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Category{}, &core.HTTPError{
+				Message:    "Category not found",
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return models.Category{}, categoryError(err)
+	}
+	return dbCategory, nil
+}
+
+// CategoryTree returns the whole category tree, siblings in their position order
+func CategoryTree(db *gorm.DB) ([]schemas.CategoryTreeSchema, error) {
+	var categories []models.Category
+	if err := db.Preload("Media").Order("position, id").Find(&categories).Error; err != nil {
+		return nil, categoryError(err)
+	}
+
+	// every category counts the published products of its subtree, a product linked to several
+	// categories of the same subtree is counted once
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	if err := db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id AS root_id, id AS category_id FROM categories WHERE deleted_at IS NULL
+			UNION SELECT subtree.root_id, categories.id FROM categories
+			JOIN subtree ON categories.parent_id = subtree.category_id WHERE categories.deleted_at IS NULL
+		)
+		SELECT subtree.root_id AS category_id, count(DISTINCT products.id) AS count
+		FROM subtree
+		JOIN (` + productCategoriesSQL + `) AS product_links ON product_links.category_id = subtree.category_id
+		JOIN products ON products.id = product_links.product_id AND products.deleted_at IS NULL AND ` + models.PublishedProductSQL + `
+		GROUP BY subtree.root_id`).Scan(&counts).Error; err != nil {
+		return nil, categoryError(err)
+	}
+	productCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		productCounts[count.CategoryID] = count.Count
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	var build func(nodes []models.Category) []schemas.CategoryTreeSchema
+	build = func(nodes []models.Category) []schemas.CategoryTreeSchema {
+		tree := make([]schemas.CategoryTreeSchema, len(nodes))
+		for i, node := range nodes {
+			tree[i] = schemas.CategoryTreeSchema{
+				CategoryResponseSchema: node.ToResponse(),
+				ProductCount:           productCounts[node.ID],
+				Children:               build(children[node.ID]),
+			}
+		}
+		return tree
+	}
+	return build(roots), nil
+}
+
+func CreateCategory(db *gorm.DB, categoryData schemas.CategorySchema) (models.Category, error) {
+	category := models.Category{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := applyCategoryData(tx, &category, categoryData); err != nil {
+			return err
+		}
+		if categoryData.Position == nil {
+			position, err := nextCategoryPosition(tx, category.ParentID)
+			if err != nil {
+				return err
+			}
+			category.Position = position
+		}
+		if err := tx.Omit("Media", "Parent").Create(&category).Error; err != nil {
+			return categoryError(err)
+		}
+		return nil
+	})
+	return category, err
+}
+
+func UpdateCategory(db *gorm.DB, categoryID uint, categoryData schemas.CategorySchema) (models.Category, error) {
+	var category models.Category
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockCategoryTree(tx); err != nil {
+			return err
+		}
+		if err := tx.First(&category, categoryID).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Category %d not found", categoryID),
+			}
+		}
+		moved := !sameParent(category.ParentID, categoryData.ParentID)
+		if err := applyCategoryData(tx, &category, categoryData); err != nil {
+			return err
+		}
+		if moved && categoryData.Position == nil {
+			position, err := nextCategoryPosition(tx, category.ParentID)
+			if err != nil {
+				return err
+			}
+			category.Position = position
+		}
+		if err := tx.Omit("Media", "Parent").Save(&category).Error; err != nil {
+			return categoryError(err)
+		}
+		return nil
+	})
+	return category, err
+}
+
+// DeleteCategory deletes a category without children, the products keep their other categories
+func DeleteCategory(db *gorm.DB, categoryID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, categoryID).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Category %d not found", categoryID),
+			}
+		}
+		var children, products int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return categoryError(err)
+		}
+		if children > 0 {
+			return &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    "The category has subcategories, move or delete them first",
+			}
+		}
+		if err := tx.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&products).Error; err != nil {
+			return categoryError(err)
+		}
+		if products > 0 {
+			return &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    "The category is the main category of products, move them first",
+			}
+		}
+		if err := tx.Exec("DELETE FROM product_categories WHERE category_id = ?", category.ID).Error; err != nil {
+			return categoryError(err)
+		}
+		if err := tx.Delete(&category).Error; err != nil {
+			return categoryError(err)
+		}
+		return nil
+	})
+}
+
+// ReorderCategories moves the categories under a parent (the root when not set) in the given order,
+// the other children of the parent are kept after them in their current order
+func ReorderCategories(db *gorm.DB, reorderData schemas.CategoryReorderSchema) ([]models.Category, error) {
+	var siblings []models.Category
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(uniqueIDs(reorderData.CategoryIDs)) != len(reorderData.CategoryIDs) {
+			return &core.ValidationError{Field: "CategoryIDs", Message: "A category is given more than once"}
+		}
+		if err := lockCategoryTree(tx); err != nil {
+			return err
+		}
+		var categories []models.Category
+		if err := tx.Find(&categories, reorderData.CategoryIDs).Error; err != nil {
+			return categoryError(err)
+		}
+		if len(categories) != len(reorderData.CategoryIDs) {
+			return &core.ValidationError{Field: "CategoryIDs", Message: "Some categories don't exist"}
+		}
+		for _, category := range categories {
+			if err := checkCategoryParent(tx, category.ID, reorderData.ParentID); err != nil {
+				return err
+			}
+		}
+
+		var others []models.Category
+		query := tx.Where("id NOT IN ?", reorderData.CategoryIDs).Order("position, id")
+		if reorderData.ParentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *reorderData.ParentID)
+		}
+		if err := query.Find(&others).Error; err != nil {
+			return categoryError(err)
+		}
+
+		ids := append(append([]uint{}, reorderData.CategoryIDs...), categoryIDs(others)...)
+		for position, id := range ids {
+			if err := tx.Model(&models.Category{}).Where("id = ?", id).
+				Updates(map[string]interface{}{"parent_id": reorderData.ParentID, "position": position}).Error; err != nil {
+				return categoryError(err)
+			}
+		}
+		return tx.Where("id IN ?", ids).Order("position").Find(&siblings).Error
+	})
+	return siblings, err
+}
+
+func applyCategoryData(tx *gorm.DB, category *models.Category, categoryData schemas.CategorySchema) error {
+	if err := checkCategoryParent(tx, category.ID, categoryData.ParentID); err != nil {
+		return err
+	}
+	if categoryData.MediaID != nil {
+		var media models.MediaFile
+		if err := tx.First(&media, *categoryData.MediaID).Error; err != nil {
+			return &core.ValidationError{Field: "MediaID", Message: fmt.Sprintf("Media file %d doesn't exist", *categoryData.MediaID)}
+		}
+		category.Media = &media
+	} else {
+		category.Media = nil
+	}
+	// an update without slug keeps the current one so the links to the category keep working
+	requestedSlug := categoryData.Slug
+	if requestedSlug == "" && category.ID != 0 && category.Slug != nil {
+		requestedSlug = *category.Slug
+	}
+	slug, err := uniqueSlug(tx, &models.Category{}, category.ID, requestedSlug, categoryData.Title, "category")
+	if err != nil {
+		return err
+	}
+
+	category.Title = categoryData.Title
+	category.Slug = &slug
+	category.ParentID = categoryData.ParentID
+	if categoryData.Position != nil {
+		category.Position = *categoryData.Position
+	}
+	category.Image = categoryData.Image
+	category.MediaID = categoryData.MediaID
+	return nil
+}
+
+// categoryTreeLock is the advisory lock key of the category moves
+const categoryTreeLock = 470001
+
+// lockCategoryTree serializes the category moves until the transaction ends, two concurrent moves could
+// otherwise each pass checkCategoryParent and together put a category under its own descendant
+func lockCategoryTree(tx *gorm.DB) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", categoryTreeLock).Error; err != nil {
+		return categoryError(err)
+	}
+	return nil
+}
+
+// checkCategoryParent checks the parent exists and isn't the category itself or one of its descendants
+func checkCategoryParent(tx *gorm.DB, categoryID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := GetCategoryByID(tx, *parentID); err != nil {
+		return err
+	}
+	if categoryID == 0 {
+		return nil
+	}
+	var loops int64
+	if err := tx.Raw("SELECT count(*) FROM ("+categorySubtreeSQL+") AS descendants WHERE id = ?",
+		[]uint{categoryID}, *parentID).Scan(&loops).Error; err != nil {
+		return categoryError(err)
+	}
+	if loops > 0 {
+		return &core.ValidationError{Field: "ParentID", Message: "A category can't be moved under itself or its descendants"}
+	}
+	return nil
+}
+
+func nextCategoryPosition(tx *gorm.DB, parentID *uint) (int, error) {
+	var position *int
+	query := tx.Model(&models.Category{}).Select("max(position)")
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	if err := query.Scan(&position).Error; err != nil {
+		return 0, categoryError(err)
+	}
+	if position == nil {
+		return 0, nil
+	}
+	return *position + 1, nil
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func categoryIDs(categories []models.Category) []uint {
+	ids := make([]uint, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+	return ids
+}
+
+func categoryError(err error) error {
+	return &core.HTTPError{
+		Message:    fmt.Sprintf("Error with categories: %s", err),
+		StatusCode: http.StatusInternalServerError,
+	}
+}
@@ -36,3 +36,13 @@ func CouponIsValid(db *gorm.DB, couponCode string) (models.Coupon, error) {
 	}
 	return dbCoupon, nil
 }
+
+// ReleaseCouponUsage gives back the use of a coupon taken by a cancelled order
+func ReleaseCouponUsage(db *gorm.DB, couponCode string) error {
+	if couponCode == "" {
+		return nil
+	}
+	return db.Model(&models.Coupon{}).
+		Where("code = ? AND usage_count > 0", couponCode).
+		UpdateColumn("usage_count", gorm.Expr("usage_count - 1")).Error
+}
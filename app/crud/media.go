@@ -0,0 +1,198 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"ecommerce/app/core"
+	"ecommerce/app/core/imaging"
+	"ecommerce/app/core/storage"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// thumbnailSizes are the longest sides of the thumbnails made for every uploaded image
+var thumbnailSizes = map[string]int{
+	"small":  160,
+	"medium": 480,
+	"large":  1024,
+}
+
+const defaultMaxUploadMB = 10
+
+// MaxUploadBytes is the largest file that can be uploaded, MEDIA_MAX_UPLOAD_MB overrides the default of 10MB
+func MaxUploadBytes() int64 {
+	if value := os.Getenv("MEDIA_MAX_UPLOAD_MB"); value != "" {
+		if megabytes, err := strconv.Atoi(value); err == nil && megabytes > 0 {
+			return int64(megabytes) << 20
+		}
+	}
+	return defaultMaxUploadMB << 20
+}
+
+// UploadMedia stores an uploaded image and its thumbnails. The type is sniffed from the content,
+// the file name and the declared content type are ignored.
+func UploadMedia(ctx context.Context, db *gorm.DB, user models.User, fileHeader *multipart.FileHeader) (models.MediaFile, error) {
+	maxBytes := MaxUploadBytes()
+	if fileHeader.Size > maxBytes {
+		return models.MediaFile{}, uploadTooLarge(maxBytes)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return models.MediaFile{}, mediaError(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return models.MediaFile{}, mediaError(err)
+	}
+	if int64(len(content)) > maxBytes {
+		return models.MediaFile{}, uploadTooLarge(maxBytes)
+	}
+
+	contentType := imaging.Sniff(content)
+	extension, ok := imaging.Extensions[contentType]
+	if !ok {
+		return models.MediaFile{}, &core.HTTPError{
+			StatusCode: http.StatusUnsupportedMediaType,
+			Message:    fmt.Sprintf("Unsupported file type %s, upload a JPEG, PNG or GIF image", contentType),
+		}
+	}
+	img, err := imaging.Decode(content)
+	if err != nil {
+		return models.MediaFile{}, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Invalid image: %s", err),
+		}
+	}
+
+	base := fmt.Sprintf("media/%s/%s", time.Now().UTC().Format("2006/01"), uuid.NewString())
+	media := models.MediaFile{
+		Key:          base + extension,
+		ContentType:  contentType,
+		Size:         int64(len(content)),
+		Width:        img.Bounds().Dx(),
+		Height:       img.Bounds().Dy(),
+		Thumbnails:   map[string]string{},
+		UploadedByID: user.ID,
+	}
+	if err := storage.Put(ctx, media.Key, bytes.NewReader(content), media.Size, contentType); err != nil {
+		return media, mediaError(err)
+	}
+	for name, size := range thumbnailSizes {
+		if media.Width <= size && media.Height <= size {
+			continue
+		}
+		var thumbnail bytes.Buffer
+		thumbnailType, err := imaging.Encode(&thumbnail, imaging.Fit(img, size), contentType)
+		if err == nil {
+			key := fmt.Sprintf("%s_%s%s", base, name, imaging.Extensions[thumbnailType])
+			err = storage.Put(ctx, key, &thumbnail, int64(thumbnail.Len()), thumbnailType)
+			media.Thumbnails[name] = key
+		}
+		if err != nil {
+			discardBlobs(media.Keys())
+			return media, mediaError(err)
+		}
+	}
+
+	if err := db.Create(&media).Error; err != nil {
+		discardBlobs(media.Keys())
+		return media, mediaError(err)
+	}
+	return media, nil
+}
+
+// DeleteMedia deletes a media file and its blobs, the files still shown by a product can't be deleted
+func DeleteMedia(ctx context.Context, db *gorm.DB, mediaID uint) error {
+	var media models.MediaFile
+	if err := db.First(&media, mediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Media file %d not found", mediaID),
+			}
+		}
+		return mediaError(err)
+	}
+	var used int64
+	if err := db.Model(&models.ProductImage{}).Where("media_id = ?", media.ID).Count(&used).Error; err != nil {
+		return mediaError(err)
+	}
+	if used > 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    "The media file is used by product images",
+		}
+	}
+	if err := db.Delete(&media).Error; err != nil {
+		return mediaError(err)
+	}
+	if err := storage.Delete(ctx, media.Keys()...); err != nil {
+		log.Printf("Error deleting the blobs of media file %d: %v", media.ID, err)
+	}
+	return nil
+}
+
+// AddProductImage uploads an image and appends it to the product images
+func AddProductImage(ctx context.Context, db *gorm.DB, user models.User, productID uint, fileHeader *multipart.FileHeader, altText string) (models.ProductImage, error) {
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		return models.ProductImage{}, &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Product %d not found", productID),
+		}
+	}
+	media, err := UploadMedia(ctx, db, user, fileHeader)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+
+	image := models.ProductImage{ProductID: product.ID, MediaID: &media.ID, AltText: altText}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var position *int
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).
+			Select("max(position)").Scan(&position).Error; err != nil {
+			return err
+		}
+		if position != nil {
+			image.Position = *position + 1
+		}
+		return tx.Create(&image).Error
+	})
+	if err != nil {
+		return image, mediaError(err)
+	}
+	image.Media = &media
+	return image, nil
+}
+
+// discardBlobs removes the blobs of an upload that failed
+func discardBlobs(keys []string) {
+	if err := storage.Delete(context.Background(), keys...); err != nil {
+		log.Printf("Error discarding uploaded blobs %v: %v", keys, err)
+	}
+}
+
+func uploadTooLarge(maxBytes int64) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Message:    fmt.Sprintf("The file is larger than %dMB", maxBytes>>20),
+	}
+}
+
+func mediaError(err error) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    fmt.Sprintf("Error storing media: %s", err),
+	}
+}
@@ -0,0 +1,11 @@
+package crud
+
+import (
+	"ecommerce/app/models"
+	"gorm.io/gorm"
+)
+
+// CreateNotification stores an in-app notification for a user
+func CreateNotification(db *gorm.DB, userID uint, title, message string) error {
+	return db.Create(&models.Notification{UserID: userID, Title: title, Message: message}).Error
+}
@@ -0,0 +1,169 @@
+package crud
+
+import (
+	"context"
+	"ecommerce/app/core"
+	"ecommerce/app/core/security"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+const oidcStateExpiry = 10 * time.Minute
+
+func StartOIDCLogin(db *gorm.DB, providerName string) (string, error) {
+	provider, err := security.GetOIDCProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := security.RandomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := security.RandomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := security.RandomURLToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	// clean up abandoned login attempts
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCAuthState{}).Error; err != nil {
+		return "", fmt.Errorf("error deleting expired states: %w", err)
+	}
+	authState := models.OIDCAuthState{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcStateExpiry),
+	}
+	if err := db.Create(&authState).Error; err != nil {
+		return "", fmt.Errorf("error creating state: %w", err)
+	}
+	return provider.AuthCodeURL(state, nonce, codeVerifier), nil
+}
+
+func CompleteOIDCLogin(ctx context.Context, db *gorm.DB, providerName, state, code string) (string, string, error) {
+	provider, err := security.GetOIDCProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the state is single use, so consume it before talking to the provider
+	var authState models.OIDCAuthState
+	if err := db.First(&authState, "state = ?", state).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", fmt.Errorf("invalid or expired state")
+		}
+		return "", "", fmt.Errorf("error finding state: %w", err)
+	}
+	if err := db.Delete(&authState).Error; err != nil {
+		return "", "", fmt.Errorf("error deleting state: %w", err)
+	}
+	if authState.Provider != provider.Name || authState.ExpiresAt.Before(time.Now()) {
+		return "", "", fmt.Errorf("invalid or expired state")
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, authState.CodeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, authState.Nonce)
+	if err != nil {
+		return "", "", err
+	}
+
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var linkErr error
+		user, linkErr = findOrLinkIdentityUser(tx, provider.Name, claims)
+		return linkErr
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := UpdateUserLastLogin(db, user.ID); err != nil {
+		return "", "", err
+	}
+	return security.CreateJwtDefaultTokens(user.ID)
+}
+
+// findOrLinkIdentityUser resolves the user behind an external identity, linking it to an existing
+// account when both sides verified the email or registering a new account otherwise
+func findOrLinkIdentityUser(tx *gorm.DB, provider string, claims *security.OIDCClaims) (models.User, error) {
+	var user models.User
+
+	var identity models.UserIdentity
+	err := tx.Preload("User").Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		return identity.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error finding identity: %s", err),
+		}
+	}
+
+	if claims.Email == "" {
+		return user, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("%s account has no email address", provider),
+		}
+	}
+
+	err = tx.Where("email = ?", claims.Email).First(&user).Error
+	switch {
+	case err == nil:
+		// never link on an email either side didn't verify, whoever registered it first could take over the
+		// account. The owner logs in with their password and verifies their email first.
+		if !claims.IsEmailVerified() || !user.IsVerified {
+			return models.User{}, &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    fmt.Sprintf("An account already exists for this email, log in with your password and verify your email to sign in with %s", provider),
+			}
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user = models.User{
+			Email:      claims.Email,
+			FirstName:  claims.GivenName,
+			LastName:   claims.FamilyName,
+			IsVerified: claims.IsEmailVerified(),
+			LastLogin:  time.Now(),
+		}
+		// social accounts have no phone number yet, leave it NULL so the unique index is not hit
+		if err := tx.Omit("PhoneNumber").Create(&user).Error; err != nil {
+			return user, &core.HTTPError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("Error creating user: %s", err),
+			}
+		}
+	default:
+		return user, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error finding user: %s", err),
+		}
+	}
+
+	identity = models.UserIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		UserID:   user.ID,
+	}
+	if err := tx.Create(&identity).Error; err != nil {
+		return user, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error linking identity: %s", err),
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,95 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func ListFavouriteOrders(db *gorm.DB, user models.User, pageParams pagination.Params) (pagination.Page[models.FavouriteOrder], error) {
+	keyset := pagination.Keyset{Name: "name", Keys: []pagination.SortKey{{Column: "name"}}}
+	return pagination.Paginate(db.Model(&models.FavouriteOrder{}).Where("user_id = ?", user.ID), pageParams, keyset,
+		func(favourite models.FavouriteOrder) ([]interface{}, uint) {
+			return []interface{}{favourite.Name}, favourite.ID
+		})
+}
+
+// CreateFavouriteOrder saves a named favourite order, either from the given items or from a past order of the user
+func CreateFavouriteOrder(db *gorm.DB, user models.User, data schemas.FavouriteOrderSchema) (models.FavouriteOrder, error) {
+	favourite := models.FavouriteOrder{
+		Name:      data.Name,
+		UserID:    user.ID,
+		BranchID:  data.BranchID,
+		OrderType: data.OrderType,
+		Products:  data.Products,
+	}
+	if data.OrderID != nil {
+		order, err := GetOrderByID(db, user, *data.OrderID)
+		if err != nil {
+			return models.FavouriteOrder{}, err
+		}
+		favourite.BranchID = order.BranchID
+		favourite.OrderType = order.Type
+		favourite.Products = orderItemsToSchema(order.Products)
+	}
+	if len(favourite.Products) == 0 {
+		return models.FavouriteOrder{}, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "A favourite order needs at least one product",
+		}
+	}
+
+	var count int64
+	if err := db.Model(&models.FavouriteOrder{}).Where("user_id = ? AND name = ?", user.ID, data.Name).Count(&count).Error; err != nil {
+		return models.FavouriteOrder{}, err
+	}
+	if count > 0 {
+		return models.FavouriteOrder{}, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("A favourite order named %s already exists", data.Name),
+		}
+	}
+	if err := db.Create(&favourite).Error; err != nil {
+		return models.FavouriteOrder{}, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error saving favourite order: %s", err),
+		}
+	}
+	return favourite, nil
+}
+
+func DeleteFavouriteOrder(db *gorm.DB, user models.User, favouriteID uint) error {
+	favourite, err := getFavouriteOrder(db, user, favouriteID)
+	if err != nil {
+		return err
+	}
+	if err := db.Delete(&favourite).Error; err != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error deleting favourite order: %s", err),
+		}
+	}
+	return nil
+}
+
+func getFavouriteOrder(db *gorm.DB, user models.User, favouriteID uint) (models.FavouriteOrder, error) {
+	var favourite models.FavouriteOrder
+	if err := db.Where("user_id = ?", user.ID).First(&favourite, favouriteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.FavouriteOrder{}, &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Favourite order not found",
+			}
+		}
+		return models.FavouriteOrder{}, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    err.Error(),
+		}
+	}
+	return favourite, nil
+}
@@ -0,0 +1,148 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"net/http"
+	"time"
+)
+
+// CancelOrder cancels an order of the customer when the branch cancellation policy still allows it,
+// gives back the stock, the coupon use and the scheduled slot, then refunds the payment
+func CancelOrder(db *gorm.DB, user models.User, orderID uint, reason string) error {
+	var order models.Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &core.HTTPError{
+					StatusCode: http.StatusNotFound,
+					Message:    "Order not found",
+				}
+			}
+			return err
+		}
+		if order.UserID != user.ID {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Order not found",
+			}
+		}
+		branch, err := crud.GetBranchByID(tx, order.BranchID)
+		if err != nil {
+			return err
+		}
+		if !branch.CanCustomerCancel(order, time.Now()) {
+			return &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    fmt.Sprintf("Order %d can no longer be cancelled", order.ID),
+			}
+		}
+		if err := tx.Where("order_id = ?", order.ID).First(&order.Payment).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if reason == "" {
+			reason = "Cancelled by the customer"
+		}
+		if err := cancelOrder(tx, &order, reason, &user.ID); err != nil {
+			return err
+		}
+		return crud.CreateNotification(tx, order.UserID, "Your order was cancelled",
+			fmt.Sprintf("Order #%d was cancelled. Any amount charged will be refunded.", order.ID))
+	})
+	if err != nil {
+		var httpErr *core.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error cancelling order: %s", err),
+		}
+	}
+	log.Printf("Order cancelled by customer. Order ID: %d", order.ID)
+	publishStatusChange(db, order)
+	refundAfterCancel(db, order)
+	return nil
+}
+
+// cancelOrder moves a locked order to cancelled and gives back everything it held, Payment must be loaded.
+// The caller publishes the status change and refunds the payment once the transaction commits.
+func cancelOrder(tx *gorm.DB, order *models.Order, reason string, changedByID *uint) error {
+	if err := crud.ReleaseOrderSlot(tx, order); err != nil {
+		return err
+	}
+	if err := releaseOrderStock(tx, order.ID, order.BranchID); err != nil {
+		return err
+	}
+	if err := crud.ReleaseCouponUsage(tx, order.Coupon); err != nil {
+		return err
+	}
+	if err := refundOrderPayment(tx, order); err != nil {
+		return err
+	}
+
+	fromStatus := order.Status
+	order.Status = "cancelled"
+	if err := tx.Model(order).Select("Status", "ReleasedAt", "SlotStart").Updates(order).Error; err != nil {
+		return err
+	}
+	return recordStatusChange(tx, order.ID, fromStatus, order.Status, reason, changedByID)
+}
+
+// refundOrderPayment marks a succeeded payment of an order for refund, the gateway is only called by RefundPayment
+// once the cancellation is committed so a rolled back cancellation never refunds. The payments that never
+// succeeded captured nothing and are only cancelled.
+func refundOrderPayment(tx *gorm.DB, order *models.Order) error {
+	payment := order.Payment
+	if payment.ID == 0 || payment.Status == "refunded" || payment.Status == "refund_pending" || payment.Status == "cancelled" {
+		return nil
+	}
+	status := "cancelled"
+	if payment.Status == "succeeded" {
+		status = "refund_pending"
+		if payment.PaymentIntentID == "" {
+			status = "refunded"
+		}
+	}
+	order.Payment.Status = status
+	return tx.Model(&order.Payment).Update("status", status).Error
+}
+
+// releaseOrderStock puts the quantities of an order back in the limited stocks, the branch stock for the shared products
+func releaseOrderStock(tx *gorm.DB, orderID uint, branchID uint) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return err
+	}
+	limited := []string{"FIXED", "DAILY"}
+	for _, item := range items {
+		if err := tx.Model(&models.Product{}).
+			Where("id = ? AND branch_id IS NOT NULL AND stock_type IN ?", item.ProductID, limited).
+			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.BranchProduct{}).
+			Where("product_id = ? AND branch_id = ? AND stock_type IN ?", item.ProductID, branchID, limited).
+			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordStatusChange(tx *gorm.DB, orderID uint, fromStatus, toStatus, reason string, changedByID *uint) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:     orderID,
+		FromStatus:  fromStatus,
+		ToStatus:    toStatus,
+		Reason:      reason,
+		ChangedByID: changedByID,
+	}).Error
+}
@@ -2,6 +2,7 @@ package orders
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/realtime"
 	"ecommerce/app/crud"
 	"ecommerce/app/models"
 	"ecommerce/app/schemas"
@@ -9,6 +10,7 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"net/http"
+	"time"
 )
 
 // helper functions
@@ -51,34 +53,62 @@ func checkOrderType(orderType string) error {
 
 // Order Creation Functions
 
-func CreateOrder(tx *gorm.DB, user models.User, orderData schemas.OrderCreationSchema) error {
+// CreateOrder creates an order in the transaction tx, PublishOrderCreated announces it once tx commits
+func CreateOrder(tx *gorm.DB, user models.User, orderData schemas.OrderCreationSchema) (models.Order, error) {
 	log.Printf("Starting order creation for user ID: %d", user.ID)
 
 	if err := checkOrderType(orderData.OrderType); err != nil {
 		log.Printf("Invalid order type: %s", err)
-		return err
+		return models.Order{}, err
+	}
+
+	var scheduleAt *time.Time
+	if orderData.IsScheduled {
+		scheduleAt = &orderData.ScheduleAt
+	}
+	if err := crud.CheckBranchAcceptsOrder(tx, orderData.BranchID, orderData.OrderType, scheduleAt); err != nil {
+		log.Printf("Branch %d does not accept the order: %s", orderData.BranchID, err)
+		return models.Order{}, err
 	}
 
 	newOrder, err := createInitialOrder(tx, user, orderData)
 	if err != nil {
-		return err
+		return models.Order{}, err
 	}
 
-	totalPrice, err := processOrderItems(tx, newOrder, orderData)
+	if newOrder.IsScheduled {
+		if err := crud.BookOrderSlot(tx, newOrder); err != nil {
+			log.Printf("Slot booking failed. Order ID: %d, Error: %s", newOrder.ID, err)
+			return models.Order{}, err
+		}
+	}
+
+	totalPrice, taxLines, err := processOrderItems(tx, newOrder, orderData)
 	if err != nil {
-		return err
+		return models.Order{}, err
 	}
 
-	if err := createNewPayment(tx, user.ID, newOrder, orderData.Payment); err != nil {
-		return err
+	if err := finalizeOrder(tx, newOrder, totalPrice, taxLines, orderData); err != nil {
+		return models.Order{}, err
 	}
 
-	if err := finalizeOrder(tx, newOrder, totalPrice, orderData); err != nil {
-		return err
+	if err := createNewPayment(tx, user.ID, newOrder, orderData.Payment); err != nil {
+		return models.Order{}, err
 	}
 
-	log.Printf("Order created successfully. Order ID: %d, Total Price: %.2f", newOrder.ID, totalPrice)
-	return nil
+	log.Printf("Order created successfully. Order ID: %d, Total Price: %.2f", newOrder.ID, newOrder.Total)
+	return *newOrder, nil
+}
+
+// PublishOrderCreated pushes a committed new order to the customer and the branch staff
+func PublishOrderCreated(db *gorm.DB, order models.Order) {
+	realtime.Publish(db, realtime.Event{
+		Type:     realtime.OrderCreated,
+		OrderID:  order.ID,
+		UserID:   order.UserID,
+		BranchID: order.BranchID,
+		Status:   order.Status,
+	})
 }
 
 func createInitialOrder(tx *gorm.DB, user models.User, orderData schemas.OrderCreationSchema) (*models.Order, error) {
@@ -106,42 +136,66 @@ func createInitialOrder(tx *gorm.DB, user models.User, orderData schemas.OrderCr
 	return &newOrder, nil
 }
 
-func processOrderItems(tx *gorm.DB, newOrder *models.Order, orderData schemas.OrderCreationSchema) (float64, error) {
+func processOrderItems(tx *gorm.DB, newOrder *models.Order, orderData schemas.OrderCreationSchema) (float64, []schemas.TaxLineSchema, error) {
 	var totalPrice float64
+	var taxLines []schemas.TaxLineSchema
+
+	branch, err := crud.GetBranchByID(tx, orderData.BranchID)
+	if err != nil {
+		return 0, nil, err
+	}
+	newOrder.PricesIncludeTax = branch.PricesIncludeTax
 
 	for _, product := range orderData.Products {
-		itemTotalPrice, err := processOrderItem(tx, newOrder, product, orderData.BranchID)
+		itemTotalPrice, itemTaxLines, err := processOrderItem(tx, newOrder, product, branch)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		totalPrice += itemTotalPrice
+		taxLines = append(taxLines, itemTaxLines...)
 	}
 
 	log.Printf("All order items processed. Total Price: %.2f", totalPrice)
-	return totalPrice, nil
+	return totalPrice, taxLines, nil
 }
 
-func processOrderItem(tx *gorm.DB, newOrder *models.Order, product schemas.OrderItemSchema, branchID uint) (float64, error) {
+func processOrderItem(tx *gorm.DB, newOrder *models.Order, product schemas.OrderItemSchema, branch models.Branch) (float64, []schemas.TaxLineSchema, error) {
 	var dbProduct models.Product
 	if err := tx.Preload("Addons").Preload("Variations").First(&dbProduct, product.ProductID).Error; err != nil {
 		log.Printf("Product not found. ID: %d", product.ProductID)
-		return 0, &core.HTTPError{
+		return 0, nil, &core.HTTPError{
 			StatusCode: http.StatusNotFound,
 			Message:    fmt.Sprintf("Product %d not found", product.ProductID),
 		}
 	}
+	reason, err := crud.ProductInBranch(tx, &dbProduct, branch.ID)
+	if err != nil {
+		return 0, nil, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error loading product %d: %s", product.ProductID, err),
+		}
+	}
+	if reason != "" {
+		log.Printf("Product not sold. Product ID: %d, Branch ID: %d, Reason: %s", product.ProductID, branch.ID, reason)
+		return 0, nil, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Product %d is %s", product.ProductID, reason),
+		}
+	}
+	if !dbProduct.IsPublished(time.Now()) {
+		return 0, nil, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Product %d is not available", product.ProductID),
+		}
+	}
 	if !checkProductStocks(dbProduct, product.Quantity) {
-		return 0, &core.HTTPError{
+		return 0, nil, &core.HTTPError{
 			StatusCode: http.StatusNotFound,
 			Message:    fmt.Sprintf("Product %d incefficient stocks", product.ProductID),
 		}
 	}
-	if dbProduct.BranchID != branchID {
-		log.Printf("Product branch mismatch. Product ID: %d, Branch ID: %d", product.ProductID, branchID)
-		return 0, &core.HTTPError{
-			StatusCode: http.StatusBadRequest,
-			Message:    fmt.Sprintf("Product %d Branch ID does not match", product.ProductID),
-		}
+	if err := reserveProductStock(tx, dbProduct, branch.ID, product.Quantity); err != nil {
+		return 0, nil, err
 	}
 
 	newOrderItem := models.OrderItem{
@@ -152,57 +206,82 @@ func processOrderItem(tx *gorm.DB, newOrder *models.Order, product schemas.Order
 
 	if err := tx.Create(&newOrderItem).Error; err != nil {
 		log.Printf("Error creating order item. Order ID: %d, Error: %s", newOrder.ID, err)
-		return 0, &core.HTTPError{
+		return 0, nil, &core.HTTPError{
 			StatusCode: http.StatusBadRequest,
 			Message:    fmt.Sprintf("Error creating order item %d: %s", newOrder.ID, err),
 		}
 	}
 
-	itemTotalPrice, err := processAddonsAndVariations(tx, &newOrderItem, product, dbProduct)
+	variationsPrice, addonParts, err := processAddonsAndVariations(tx, &newOrderItem, product, dbProduct)
+	if err != nil {
+		return 0, nil, err
+	}
 
+	// the product and its options are taxed with the product category, addons with their own
+	quantity := float64(product.Quantity)
+	unitPrice := dbProduct.Price + variationsPrice
+	parts := []crud.TaxablePart{{TaxCategoryID: dbProduct.TaxCategoryID, Amount: unitPrice * quantity}}
+	for _, part := range addonParts {
+		unitPrice += part.Amount
+		parts = append(parts, crud.TaxablePart{TaxCategoryID: part.TaxCategoryID, Amount: part.Amount * quantity})
+	}
+
+	taxLines, err := crud.CalculateTaxes(tx, branch, parts)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+	newOrderItem.UnitPrice = unitPrice
+	newOrderItem.TotalPrice = unitPrice * quantity
+	for _, line := range taxLines {
+		newOrderItem.TaxAmount += line.Amount
+		newOrderItem.Taxes = append(newOrderItem.Taxes, models.OrderItemTax{
+			OrderItemID:   newOrderItem.ID,
+			Name:          line.Name,
+			Rate:          line.Rate,
+			TaxableAmount: line.TaxableAmount,
+			Amount:        line.Amount,
+		})
 	}
 
 	if err := tx.Save(&newOrderItem).Error; err != nil {
 		log.Printf("Error updating order item. ID: %d, Error: %s", newOrderItem.ID, err)
-		return 0, &core.HTTPError{
+		return 0, nil, &core.HTTPError{
 			StatusCode: http.StatusInternalServerError,
 			Message:    fmt.Sprintf("Error updating order item : %s", err),
 		}
 	}
 
-	log.Printf("Order item processed. Item ID: %d, Total Price: %.2f", newOrderItem.ID, itemTotalPrice)
-	return itemTotalPrice, nil
+	log.Printf("Order item processed. Item ID: %d, Total Price: %.2f, Tax: %.2f", newOrderItem.ID, newOrderItem.TotalPrice, newOrderItem.TaxAmount)
+	return newOrderItem.TotalPrice, taxLines, nil
 }
 
-func processAddonsAndVariations(tx *gorm.DB, newOrderItem *models.OrderItem, product schemas.OrderItemSchema, dbProduct models.Product) (float64, error) {
-	var itemTotalPrice float64
+// processAddonsAndVariations returns the options price of one unit and the addon prices of one unit with their tax category
+func processAddonsAndVariations(tx *gorm.DB, newOrderItem *models.OrderItem, product schemas.OrderItemSchema, dbProduct models.Product) (float64, []crud.TaxablePart, error) {
+	var addonParts []crud.TaxablePart
 
 	// Process addons
 	for _, addon := range product.Addons {
-		addonPrice, err := processAddon(tx, newOrderItem, addon, dbProduct)
+		addonPart, err := processAddon(tx, newOrderItem, addon, dbProduct)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
-		itemTotalPrice += addonPrice
+		addonParts = append(addonParts, addonPart)
 	}
 
 	// Process variations
 	variationPrice, err := processVariations(tx, newOrderItem, product.Variations, dbProduct)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	itemTotalPrice += variationPrice
 
-	return itemTotalPrice, nil
+	return variationPrice, addonParts, nil
 }
 
-func processAddon(tx *gorm.DB, newOrderItem *models.OrderItem, addon schemas.AddonSchema, dbProduct models.Product) (float64, error) {
+func processAddon(tx *gorm.DB, newOrderItem *models.OrderItem, addon schemas.AddonSchema, dbProduct models.Product) (crud.TaxablePart, error) {
 	var dbAddon models.Addon
 	if err := tx.First(&dbAddon, addon.AddonID).Error; err != nil {
 		log.Printf("Addon not found. ID: %d", addon.AddonID)
-		return 0, &core.HTTPError{
+		return crud.TaxablePart{}, &core.HTTPError{
 			StatusCode: http.StatusNotFound,
 			Message:    fmt.Sprintf("Addon %d not found", addon.AddonID),
 		}
@@ -210,7 +289,7 @@ func processAddon(tx *gorm.DB, newOrderItem *models.OrderItem, addon schemas.Add
 
 	if !contains(dbProduct.Addons, dbAddon, addonComparer) {
 		log.Printf("Addon not available for product. Addon ID: %d, Product ID: %d", addon.AddonID, dbProduct.ID)
-		return 0, &core.HTTPError{
+		return crud.TaxablePart{}, &core.HTTPError{
 			StatusCode: http.StatusBadRequest,
 			Message:    fmt.Sprintf("Addon %d not found in product available addons", addon.AddonID),
 		}
@@ -223,9 +302,14 @@ func processAddon(tx *gorm.DB, newOrderItem *models.OrderItem, addon schemas.Add
 	}
 	newOrderItem.SelectedAddons = append(newOrderItem.SelectedAddons, newOrderItemAddon)
 
-	addonPrice := dbAddon.Price + dbAddon.Tax
+	// addons without their own tax category are taxed like the product
+	taxCategoryID := dbAddon.TaxCategoryID
+	if taxCategoryID == nil {
+		taxCategoryID = dbProduct.TaxCategoryID
+	}
+	addonPrice := dbAddon.Price * float64(addon.Quantity)
 	log.Printf("Addon processed. Addon ID: %d, Price: %.2f", addon.AddonID, addonPrice)
-	return addonPrice, nil
+	return crud.TaxablePart{TaxCategoryID: taxCategoryID, Amount: addonPrice}, nil
 }
 
 func processVariations(tx *gorm.DB, newOrderItem *models.OrderItem, variations []schemas.ProductVariationSchema, dbProduct models.Product) (float64, error) {
@@ -313,7 +397,8 @@ func checkRequiredVariations(dbProduct models.Product, processedVariations []uin
 	return nil
 }
 
-func finalizeOrder(tx *gorm.DB, newOrder *models.Order, totalPrice float64, orderData schemas.OrderCreationSchema) error {
+func finalizeOrder(tx *gorm.DB, newOrder *models.Order, totalPrice float64, taxLines []schemas.TaxLineSchema, orderData schemas.OrderCreationSchema) error {
+	newOrder.SubTotal = totalPrice
 	newOrder.Total = totalPrice
 
 	if orderData.CouponCode != "" {
@@ -327,8 +412,13 @@ func finalizeOrder(tx *gorm.DB, newOrder *models.Order, totalPrice float64, orde
 		log.Printf("Coupon applied. Coupon Code: %s, Discount: %.2f", orderData.CouponCode, newOrder.Discount)
 	}
 
+	processOrderTaxes(newOrder, taxLines)
+
 	if orderData.OrderType == "shipping" {
-		if err := processShippingAddress(tx, newOrder, orderData.ShippingAddress); err != nil {
+		if err := processShippingAddress(tx, newOrder, orderData); err != nil {
+			return err
+		}
+		if err := processShippingFee(tx, newOrder); err != nil {
 			return err
 		}
 	}
@@ -340,28 +430,49 @@ func finalizeOrder(tx *gorm.DB, newOrder *models.Order, totalPrice float64, orde
 		}
 	}
 
-	log.Printf("Order finalized. Order ID: %d, Total Price: %.2f", newOrder.ID, totalPrice)
+	log.Printf("Order finalized. Order ID: %d, Total Price: %.2f", newOrder.ID, newOrder.Total)
 	return nil
 }
 
-func processShippingAddress(tx *gorm.DB, newOrder *models.Order, shippingAddress schemas.ShippingAddressSchema) error {
-	var newShippingAddress models.ShippingAddress
+// processOrderTaxes stores the order tax breakdown, the coupon discount lowers the taxable amounts proportionally
+func processOrderTaxes(newOrder *models.Order, taxLines []schemas.TaxLineSchema) {
+	factor := 1.0
+	if newOrder.SubTotal > 0 {
+		factor = (newOrder.SubTotal - newOrder.Discount) / newOrder.SubTotal
+	}
 
-	result := tx.Where(models.ShippingAddress{
-		AddressLine1: shippingAddress.AddressLine1,
-		AddressLine2: shippingAddress.AddressLine2,
-		City:         shippingAddress.City,
-		Country:      shippingAddress.Country,
-		Postcode:     shippingAddress.Postcode,
-		State:        shippingAddress.State,
-		OrderID:      newOrder.ID,
-	}).FirstOrCreate(&newShippingAddress)
+	newOrder.TaxTotal = 0
+	for _, line := range crud.MergeTaxLines(taxLines, factor) {
+		newOrder.TaxTotal += line.Amount
+		newOrder.Taxes = append(newOrder.Taxes, models.OrderTax{
+			OrderID:       newOrder.ID,
+			Name:          line.Name,
+			Rate:          line.Rate,
+			TaxableAmount: line.TaxableAmount,
+			Amount:        line.Amount,
+		})
+	}
+	newOrder.TaxTotal = models.RoundMoney(newOrder.TaxTotal)
 
-	if result.Error != nil {
-		log.Printf("Error getting or creating shipping address. Order ID: %d, Error: %s", newOrder.ID, result.Error)
+	// inclusive prices already contain the tax
+	if !newOrder.PricesIncludeTax {
+		newOrder.Total += newOrder.TaxTotal
+	}
+	log.Printf("Taxes applied. Order ID: %d, Tax Total: %.2f, Inclusive: %t", newOrder.ID, newOrder.TaxTotal, newOrder.PricesIncludeTax)
+}
+
+func processShippingAddress(tx *gorm.DB, newOrder *models.Order, orderData schemas.OrderCreationSchema) error {
+	newShippingAddress, err := resolveShippingAddress(tx, newOrder, orderData)
+	if err != nil {
+		return err
+	}
+
+	// the address is copied onto the order, later address book changes never alter it
+	if err := tx.Create(&newShippingAddress).Error; err != nil {
+		log.Printf("Error creating shipping address. Order ID: %d, Error: %s", newOrder.ID, err)
 		return &core.HTTPError{
 			StatusCode: http.StatusInternalServerError,
-			Message:    fmt.Sprintf("Error getting or creating shipping address: %s", result.Error),
+			Message:    fmt.Sprintf("Error creating shipping address: %s", err),
 		}
 	}
 
@@ -370,6 +481,63 @@ func processShippingAddress(tx *gorm.DB, newOrder *models.Order, shippingAddress
 	return nil
 }
 
+// processShippingFee rejects addresses outside the branch delivery zones and adds the shipping fee to the total
+func processShippingFee(tx *gorm.DB, newOrder *models.Order) error {
+	weight, err := crud.OrderWeight(tx, newOrder.ID)
+	if err != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error computing order weight: %s", err),
+		}
+	}
+
+	destination := crud.ShippingDestinationFromAddress(newOrder.ShippingAddress)
+	quote, err := crud.QuoteShipping(tx, newOrder.BranchID, destination, newOrder.SubTotal-newOrder.Discount, weight)
+	if err != nil {
+		log.Printf("Shipping quote failed. Order ID: %d, Error: %s", newOrder.ID, err)
+		return err
+	}
+
+	newOrder.DeliveryZoneID = &quote.DeliveryZoneID
+	newOrder.ShippingFee = quote.ShippingFee
+	newOrder.Total += quote.ShippingFee
+	log.Printf("Shipping fee applied. Order ID: %d, Zone ID: %d, Fee: %.2f", newOrder.ID, quote.DeliveryZoneID, quote.ShippingFee)
+	return nil
+}
+
+func resolveShippingAddress(tx *gorm.DB, newOrder *models.Order, orderData schemas.OrderCreationSchema) (models.ShippingAddress, error) {
+	if orderData.ShippingAddressID != nil {
+		var savedAddress models.Address
+		if err := tx.Where("user_id = ?", newOrder.UserID).First(&savedAddress, *orderData.ShippingAddressID).Error; err != nil {
+			log.Printf("Saved address not found. ID: %d, User ID: %d", *orderData.ShippingAddressID, newOrder.UserID)
+			return models.ShippingAddress{}, &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Address %d not found", *orderData.ShippingAddressID),
+			}
+		}
+		return savedAddress.ToShippingAddress(newOrder.ID), nil
+	}
+
+	if orderData.ShippingAddress == nil {
+		return models.ShippingAddress{}, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Shipping address is required for shipping orders",
+		}
+	}
+	shippingAddress := orderData.ShippingAddress
+	return models.ShippingAddress{
+		AddressLine1: shippingAddress.AddressLine1,
+		AddressLine2: shippingAddress.AddressLine2,
+		City:         shippingAddress.City,
+		Country:      shippingAddress.Country,
+		Postcode:     shippingAddress.Postcode,
+		State:        shippingAddress.State,
+		Latitude:     shippingAddress.Latitude,
+		Longitude:    shippingAddress.Longitude,
+		OrderID:      newOrder.ID,
+	}, nil
+}
+
 func checkProductStocks(product models.Product, quantity uint) bool {
 	// TODO : Check for last daily stock update
 	switch product.StockType {
@@ -386,12 +554,39 @@ func checkProductStocks(product models.Product, quantity uint) bool {
 	}
 }
 
+// reserveProductStock takes the ordered quantity out of a limited stock, the conditional update
+// keeps concurrent orders from selling more than the stock. The shared products take it out of the branch stock.
+func reserveProductStock(tx *gorm.DB, product models.Product, branchID uint, quantity uint) error {
+	if product.StockType != "FIXED" && product.StockType != "DAILY" {
+		return nil
+	}
+	stock := tx.Model(&models.Product{}).Where("id = ?", product.ID)
+	if product.BranchID == nil {
+		stock = tx.Model(&models.BranchProduct{}).Where("product_id = ? AND branch_id = ?", product.ID, branchID)
+	}
+	result := stock.Where("stock >= ?", quantity).UpdateColumn("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error reserving stock of product %d: %s", product.ID, result.Error),
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Product %d incefficient stocks", product.ID),
+		}
+	}
+	return nil
+}
+
+// createNewPayment creates the pending payment of a finalized order, ConfirmOrderPayment completes it
 func createNewPayment(tx *gorm.DB, userID uint, newOrder *models.Order, paymentData schemas.NewPaymentSchema) error {
 	newPayment := models.Payment{
 		UserID:              userID,
-		Amount:              paymentData.Amount,
+		Amount:              newOrder.Total,
 		Currency:            paymentData.Currency,
-		Status:              paymentData.Status,
+		Status:              "pending",
 		Gateway:             paymentData.Gateway,
 		PaymentIntentID:     paymentData.PaymentIntentID,
 		PaymentClientSecret: paymentData.PaymentClientSecret,
@@ -0,0 +1,81 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"net/http"
+)
+
+// ConfirmOrderPayment asks the gateway whether the payment of an order went through and marks it succeeded,
+// the only way an order becomes paid. Confirming a succeeded payment again does nothing.
+func ConfirmOrderPayment(db *gorm.DB, user models.User, orderID uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &core.HTTPError{
+					StatusCode: http.StatusNotFound,
+					Message:    "Order not found",
+				}
+			}
+			return err
+		}
+		if order.UserID != user.ID {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Order not found",
+			}
+		}
+		if err := tx.Where("order_id = ?", order.ID).First(&order.Payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &core.HTTPError{
+					StatusCode: http.StatusNotFound,
+					Message:    fmt.Sprintf("Order %d has no payment", order.ID),
+				}
+			}
+			return err
+		}
+		if order.Payment.Status == "succeeded" {
+			return nil
+		}
+		if order.Status == "cancelled" || order.Payment.Status != "pending" {
+			return &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    fmt.Sprintf("The payment of order %d can no longer be confirmed", order.ID),
+			}
+		}
+
+		payment := order.Payment
+		confirmed, err := core.ConfirmPayment(payment.PaymentIntentID, payment.Amount, payment.Currency)
+		if err != nil {
+			return fmt.Errorf("confirming payment %d: %w", payment.ID, err)
+		}
+		if !confirmed {
+			return &core.HTTPError{
+				StatusCode: http.StatusPaymentRequired,
+				Message:    fmt.Sprintf("The payment of order %d was not completed", order.ID),
+			}
+		}
+		if err := tx.Model(&order.Payment).Update("status", "succeeded").Error; err != nil {
+			return err
+		}
+		return tx.Model(&order).Update("is_paid", true).Error
+	})
+	if err != nil {
+		var httpErr *core.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error confirming the payment: %s", err),
+		}
+	}
+	log.Printf("Payment confirmed. Order ID: %d", orderID)
+	return nil
+}
@@ -0,0 +1,46 @@
+package orders
+
+import (
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"encoding/json"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestClientPaymentStatusIsNotTrusted(t *testing.T) {
+	// the statements are only built, the test needs no database
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("opening the dry run database: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "no status", body: `{"currency": "EUR", "payment_intent_id": "pi_1"}`},
+		{name: "succeeded status", body: `{"currency": "EUR", "payment_intent_id": "pi_1", "status": "succeeded"}`},
+		{name: "succeeded status and amount", body: `{"currency": "EUR", "payment_intent_id": "pi_1", "status": "succeeded", "amount": 0.01}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payment schemas.NewPaymentSchema
+			if err := json.Unmarshal([]byte(tt.body), &payment); err != nil {
+				t.Fatalf("decoding the payment: %s", err)
+			}
+			order := &models.Order{Total: 42.5}
+			if err := createNewPayment(db, 1, order, payment); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if order.Payment.Status != "pending" || order.Payment.Amount != 42.5 {
+				t.Errorf("payment: got status %q and amount %v, want pending and 42.5", order.Payment.Status, order.Payment.Amount)
+			}
+			// the guard of the move to preparing
+			if order.IsPaymentCompleted() {
+				t.Error("an order with a client created payment must not be prepared")
+			}
+		})
+	}
+}
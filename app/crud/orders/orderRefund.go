@@ -0,0 +1,57 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+)
+
+// RefundPendingPayments refunds the payments of the cancelled orders whose refund didn't go through yet
+func RefundPendingPayments(db *gorm.DB) error {
+	var paymentIDs []uint
+	if err := db.Model(&models.Payment{}).Where("status = ?", "refund_pending").Pluck("id", &paymentIDs).Error; err != nil {
+		return err
+	}
+	for _, paymentID := range paymentIDs {
+		if err := RefundPayment(db, paymentID); err != nil {
+			log.Printf("Error refunding payment %d: %s", paymentID, err)
+		}
+	}
+	return nil
+}
+
+// RefundPayment refunds a payment marked for refund through the gateway. The payment stays locked during the
+// call so it is refunded once, and stays pending when the call fails so RefundPendingPayments tries again.
+func RefundPayment(db *gorm.DB, paymentID uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		// skip payments another instance is already refunding
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", "refund_pending").
+			First(&payment, paymentID).Error; err != nil {
+			return err
+		}
+		if err := core.RefundPayment(payment.PaymentIntentID, payment.Amount, payment.Currency); err != nil {
+			return fmt.Errorf("refunding payment %d: %w", payment.ID, err)
+		}
+		return tx.Model(&payment).Update("status", "refunded").Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// refundAfterCancel refunds the payment of a committed cancellation right away, failed refunds are left to the worker
+func refundAfterCancel(db *gorm.DB, order models.Order) {
+	if order.Payment.Status != "refund_pending" {
+		return
+	}
+	if err := RefundPayment(db, order.Payment.ID); err != nil {
+		log.Printf("Error refunding payment %d of order %d, it will be retried: %s", order.Payment.ID, order.ID, err)
+	}
+}
@@ -0,0 +1,101 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// ReleaseDueScheduledOrders sends the scheduled orders reaching their branch release lead time to the
+// preparation queue. Orders whose payment never completed are cancelled and refunded instead.
+func ReleaseDueScheduledOrders(db *gorm.DB) error {
+	var dueOrderIDs []uint
+	if err := db.Model(&models.Order{}).
+		Joins("JOIN branches ON branches.id = orders.branch_id").
+		Where("orders.is_scheduled = ? AND orders.released_at IS NULL AND orders.status IN ?", true, []string{"pending", "paid"}).
+		Where("orders.schedule_time <= ?::timestamptz + branches.release_lead_minutes * interval '1 minute'", time.Now()).
+		Pluck("orders.id", &dueOrderIDs).Error; err != nil {
+		return err
+	}
+
+	for _, orderID := range dueOrderIDs {
+		if err := releaseScheduledOrder(db, orderID); err != nil {
+			log.Printf("Error releasing scheduled order %d: %s", orderID, err)
+		}
+	}
+	return nil
+}
+
+func releaseScheduledOrder(db *gorm.DB, orderID uint) error {
+	var order models.Order
+	var branch models.Branch
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// skip orders another instance is already processing
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("released_at IS NULL AND status IN ?", []string{"pending", "paid"}).
+			First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("order_id = ?", order.ID).First(&order.Payment).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.First(&branch, order.BranchID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		order.ReleasedAt = &now
+		if !order.IsPaymentCompleted() {
+			return cancelUnpaidOrder(tx, &order)
+		}
+
+		fromStatus := order.Status
+		order.Status = "preparing"
+		if err := tx.Model(&order).Select("Status", "ReleasedAt").Updates(&order).Error; err != nil {
+			return err
+		}
+		if err := recordStatusChange(tx, order.ID, fromStatus, order.Status, "Scheduled order released", nil); err != nil {
+			return err
+		}
+		return crud.CreateNotification(tx, order.UserID, "Your order is being prepared",
+			fmt.Sprintf("Order #%d scheduled for %s is now being prepared by %s.", order.ID, formatScheduleTime(order, branch), branch.Name))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	publishStatusChange(db, order)
+	if order.Status == "cancelled" {
+		refundAfterCancel(db, order)
+	}
+	if order.Status == "preparing" && branch.Email != "" {
+		message := fmt.Sprintf("Scheduled order #%d for %s is ready to be prepared.", order.ID, formatScheduleTime(order, branch))
+		if err := core.SendEmail(branch.Email, "Scheduled Order Released", message); err != nil {
+			log.Printf("Error notifying branch %d of order %d: %s", branch.ID, order.ID, err)
+		}
+	}
+	log.Printf("Scheduled order processed. Order ID: %d, Status: %s", order.ID, order.Status)
+	return nil
+}
+
+// cancelUnpaidOrder cancels a scheduled order at release time because it was never paid
+func cancelUnpaidOrder(tx *gorm.DB, order *models.Order) error {
+	if err := cancelOrder(tx, order, "Payment not completed before preparation", nil); err != nil {
+		return err
+	}
+	return crud.CreateNotification(tx, order.UserID, "Your order was cancelled",
+		fmt.Sprintf("Order #%d was cancelled because its payment was not completed before preparation. Any amount charged will be refunded.", order.ID))
+}
+
+func formatScheduleTime(order models.Order, branch models.Branch) string {
+	return order.ScheduleTime.In(branch.Location()).Format("2006-01-02 15:04")
+}
@@ -2,44 +2,118 @@ package orders
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/realtime"
+	"ecommerce/app/crud"
 	"ecommerce/app/models"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"net/http"
+	"time"
 )
 
-func UpdateOrderStatus(db *gorm.DB, user models.User, orderId uint, status string) error {
-	var dbOrder models.Order
-	if err := db.First(&dbOrder, orderId).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+// UpdateBranchOrdersStatus moves several orders of a branch to a status at once,
+// nothing is changed when one of the orders can not make the transition
+func UpdateBranchOrdersStatus(db *gorm.DB, staff models.User, branchID uint, orderIDs []uint, status string) ([]models.Order, error) {
+	var branchOrders []models.Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("branch_id = ? AND id IN ?", branchID, orderIDs).
+			Find(&branchOrders).Error; err != nil {
+			return err
+		}
+		if len(branchOrders) != len(uniqueIDs(orderIDs)) {
 			return &core.HTTPError{
 				StatusCode: http.StatusNotFound,
-				Message:    "Order not found",
+				Message:    fmt.Sprintf("Some orders were not found in branch %d", branchID),
 			}
 		}
-		return &core.HTTPError{
-			StatusCode: http.StatusInternalServerError,
-			Message:    err.Error(),
-		}
-	}
-	if dbOrder.UserID != user.ID {
-		return &core.HTTPError{
-			StatusCode: http.StatusUnauthorized,
-			Message:    "User not authorized to update this order",
+
+		now := time.Now()
+		for i := range branchOrders {
+			order := &branchOrders[i]
+			if !order.CanTransitionTo(status) {
+				return &core.HTTPError{
+					StatusCode: http.StatusConflict,
+					Message:    fmt.Sprintf("Order %d can not go from %s to %s", order.ID, order.Status, status),
+				}
+			}
+			if status == "cancelled" || status == "preparing" {
+				if err := tx.Where("order_id = ?", order.ID).First(&order.Payment).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+			}
+			if status == "cancelled" {
+				if err := cancelOrder(tx, order, "Cancelled by the branch", &staff.ID); err != nil {
+					return err
+				}
+				if err := crud.CreateNotification(tx, order.UserID, "Your order was cancelled",
+					fmt.Sprintf("Order #%d was cancelled by the branch. Any amount charged will be refunded.", order.ID)); err != nil {
+					return err
+				}
+				continue
+			}
+			if status == "preparing" {
+				// only paid orders are prepared, the unpaid scheduled ones are cancelled at release
+				if !order.IsPaymentCompleted() {
+					return &core.HTTPError{
+						StatusCode: http.StatusConflict,
+						Message:    fmt.Sprintf("Order %d is not paid", order.ID),
+					}
+				}
+				if order.ReleasedAt == nil {
+					order.ReleasedAt = &now
+				}
+			}
+			fromStatus := order.Status
+			order.Status = status
+			if err := tx.Model(order).Select("Status", "ReleasedAt").Updates(order).Error; err != nil {
+				return err
+			}
+			if err := recordStatusChange(tx, order.ID, fromStatus, status, "", &staff.ID); err != nil {
+				return err
+			}
+			if err := crud.CreateNotification(tx, order.UserID, "Order update",
+				fmt.Sprintf("Order #%d is now %s.", order.ID, status)); err != nil {
+				return err
+			}
 		}
-	}
-	if !dbOrder.ValidateStatus(status) {
-		return &core.HTTPError{
-			StatusCode: http.StatusBadRequest,
-			Message:    "Invalid status",
+		return nil
+	})
+	if err != nil {
+		var httpErr *core.HTTPError
+		if errors.As(err, &httpErr) {
+			return nil, httpErr
 		}
-	}
-	dbOrder.Status = status
-	if err := db.Save(&dbOrder).Error; err != nil {
-		return &core.HTTPError{
+		return nil, &core.HTTPError{
 			StatusCode: http.StatusInternalServerError,
 			Message:    err.Error(),
 		}
 	}
-	return nil
+	// the events and the refunds only go out once every change is committed
+	for _, order := range branchOrders {
+		publishStatusChange(db, order)
+		refundAfterCancel(db, order)
+	}
+	return branchOrders, nil
+}
+
+// publishStatusChange pushes the committed new status to the customer and the branch staff
+func publishStatusChange(db *gorm.DB, order models.Order) {
+	realtime.Publish(db, realtime.Event{
+		Type:     realtime.OrderStatusChanged,
+		OrderID:  order.ID,
+		UserID:   order.UserID,
+		BranchID: order.BranchID,
+		Status:   order.Status,
+	})
+}
+
+func uniqueIDs(ids []uint) map[uint]struct{} {
+	unique := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return unique
 }
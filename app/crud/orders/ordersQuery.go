@@ -2,26 +2,27 @@ package orders
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/models"
+	"ecommerce/app/schemas"
 	"fmt"
 	"gorm.io/gorm"
 	"net/http"
+	"strings"
 )
 
-func ListUserOrders(db *gorm.DB, user models.User) ([]models.Order, error) {
-	var userOrders []models.Order
-	if err := db.Where("user_id = ?", user.ID).
+// ListUserOrders lists the orders of a user, newest first
+func ListUserOrders(db *gorm.DB, user models.User, pageParams pagination.Params) (pagination.Page[models.Order], error) {
+	query := db.Model(&models.Order{}).Where("user_id = ?", user.ID).
 		Preload("Products.SelectedVariations.ProductVariation").
 		Preload("Products.SelectedVariations.SelectedOptions").
 		Preload("Products.SelectedAddons.Addon").
-		Preload("ShippingAddress").
-		Find(&userOrders).Error; err != nil {
-		return nil, &core.HTTPError{
-			Message:    fmt.Sprintf("cannot list user orders: %v", err),
-			StatusCode: http.StatusInternalServerError,
-		}
-	}
-	return userOrders, nil
+		Preload("Products.Taxes").
+		Preload("Taxes").
+		Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("ShippingAddress")
+	return pagination.Paginate(query, pageParams, pagination.ByID("id", true),
+		func(order models.Order) ([]interface{}, uint) { return nil, order.ID })
 }
 
 func GetOrderByID(db *gorm.DB, user models.User, orderID uint) (models.Order, error) {
@@ -29,6 +30,9 @@ func GetOrderByID(db *gorm.DB, user models.User, orderID uint) (models.Order, er
 	if err := db.Preload("Products.SelectedVariations.ProductVariation").
 		Preload("Products.SelectedVariations.SelectedOptions").
 		Preload("Products.SelectedAddons.Addon").
+		Preload("Products.Taxes").
+		Preload("Taxes").
+		Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
 		Preload("ShippingAddress").
 		First(&order, orderID).Error; err != nil {
 		return models.Order{}, &core.HTTPError{
@@ -44,3 +48,46 @@ func GetOrderByID(db *gorm.DB, user models.User, orderID uint) (models.Order, er
 	}
 	return order, nil
 }
+
+// ListBranchOrders lists the orders of a branch for its staff, scheduled orders first by their scheduled time
+func ListBranchOrders(db *gorm.DB, branchID uint, filters schemas.BranchOrdersQuerySchema, pageParams pagination.Params) (pagination.Page[models.Order], error) {
+	query := db.Model(&models.Order{}).Where("branch_id = ?", branchID)
+	if filters.Status != "" {
+		query = query.Where("status IN ?", strings.Split(filters.Status, ","))
+	}
+	if filters.Type != "" {
+		query = query.Where("type = ?", filters.Type)
+	}
+	if !filters.From.IsZero() {
+		query = query.Where("created_at >= ?", filters.From)
+	}
+	if !filters.To.IsZero() {
+		query = query.Where("created_at < ?", filters.To)
+	}
+	if filters.IsScheduled != nil {
+		query = query.Where("is_scheduled = ?", *filters.IsScheduled)
+	}
+	if !filters.ScheduledFrom.IsZero() {
+		query = query.Where("is_scheduled = ? AND schedule_time >= ?", true, filters.ScheduledFrom)
+	}
+	if !filters.ScheduledTo.IsZero() {
+		query = query.Where("is_scheduled = ? AND schedule_time < ?", true, filters.ScheduledTo)
+	}
+
+	query = query.
+		Preload("User").
+		Preload("Products.SelectedVariations.ProductVariation").
+		Preload("Products.SelectedVariations.SelectedOptions").
+		Preload("Products.SelectedAddons.Addon").
+		Preload("ShippingAddress")
+	keyset := pagination.Keyset{
+		Name: "queue",
+		Keys: []pagination.SortKey{{Column: "CASE WHEN is_scheduled THEN schedule_time ELSE created_at END"}},
+	}
+	return pagination.Paginate(query, pageParams, keyset, func(order models.Order) ([]interface{}, uint) {
+		if order.IsScheduled {
+			return []interface{}{order.ScheduleTime}, order.ID
+		}
+		return []interface{}{order.CreatedAt}, order.ID
+	})
+}
@@ -0,0 +1,158 @@
+package orders
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"time"
+)
+
+// BuildReorder rebuilds the creation data of a past order of the user, the items that can not be
+// ordered anymore are left out and reported with the reason
+func BuildReorder(db *gorm.DB, user models.User, orderID uint) (schemas.ReorderResponseSchema, error) {
+	order, err := GetOrderByID(db, user, orderID)
+	if err != nil {
+		return schemas.ReorderResponseSchema{}, err
+	}
+	return checkItemsAvailability(db, order.BranchID, order.Type, orderItemsToSchema(order.Products))
+}
+
+// BuildFavouriteOrder rebuilds the creation data of a favourite order of the user like BuildReorder
+func BuildFavouriteOrder(db *gorm.DB, user models.User, favouriteID uint) (schemas.ReorderResponseSchema, error) {
+	favourite, err := getFavouriteOrder(db, user, favouriteID)
+	if err != nil {
+		return schemas.ReorderResponseSchema{}, err
+	}
+	return checkItemsAvailability(db, favourite.BranchID, favourite.OrderType, favourite.Products)
+}
+
+// PlaceAgain creates an order from rebuilt creation data, prices, stocks and branch rules are
+// checked again by the normal order creation
+func PlaceAgain(tx *gorm.DB, user models.User, reorder schemas.ReorderResponseSchema, request schemas.PlaceAgainSchema) (models.Order, error) {
+	if len(reorder.UnavailableItems) > 0 && !request.SkipUnavailable {
+		return models.Order{}, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("%d items are no longer available", len(reorder.UnavailableItems)),
+		}
+	}
+	if len(reorder.Order.Products) == 0 {
+		return models.Order{}, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    "None of the items are available anymore",
+		}
+	}
+
+	orderData := reorder.Order
+	if request.OrderType != "" {
+		orderData.OrderType = request.OrderType
+	}
+	orderData.IsScheduled = request.IsScheduled
+	orderData.ScheduleAt = request.ScheduleAt
+	orderData.ShippingAddressID = request.ShippingAddressID
+	orderData.ShippingAddress = request.ShippingAddress
+	orderData.Payment = request.Payment
+	orderData.CouponCode = request.CouponCode
+	return CreateOrder(tx, user, orderData)
+}
+
+func orderItemsToSchema(items []models.OrderItem) []schemas.OrderItemSchema {
+	itemSchemas := make([]schemas.OrderItemSchema, 0, len(items))
+	for _, item := range items {
+		itemSchemas = append(itemSchemas, item.ToCreationSchema())
+	}
+	return itemSchemas
+}
+
+func checkItemsAvailability(db *gorm.DB, branchID uint, orderType string, items []schemas.OrderItemSchema) (schemas.ReorderResponseSchema, error) {
+	reorder := schemas.ReorderResponseSchema{
+		Order: schemas.OrderCreationSchema{
+			BranchID:  branchID,
+			OrderType: orderType,
+			Products:  []schemas.OrderItemSchema{},
+		},
+		UnavailableItems: []schemas.UnavailableItemSchema{},
+	}
+	for _, item := range items {
+		reason, err := checkItemAvailability(db, branchID, item)
+		if err != nil {
+			return schemas.ReorderResponseSchema{}, &core.HTTPError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("Error checking product %d: %s", item.ProductID, err),
+			}
+		}
+		if reason != "" {
+			log.Printf("Item not available anymore. Product ID: %d, Reason: %s", item.ProductID, reason)
+			reorder.UnavailableItems = append(reorder.UnavailableItems, schemas.UnavailableItemSchema{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Reason:    reason,
+			})
+			continue
+		}
+		reorder.Order.Products = append(reorder.Order.Products, item)
+	}
+	return reorder, nil
+}
+
+// checkItemAvailability returns why an item can not be ordered anymore, or an empty reason when it can
+func checkItemAvailability(db *gorm.DB, branchID uint, item schemas.OrderItemSchema) (string, error) {
+	var product models.Product
+	if err := db.Preload("Addons").Preload("Variations.Options").First(&product, item.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "Product is no longer sold", nil
+		}
+		return "", err
+	}
+	reason, err := crud.ProductInBranch(db, &product, branchID)
+	if err != nil {
+		return "", err
+	}
+	if reason != "" {
+		return "Product is " + reason, nil
+	}
+	if !product.IsPublished(time.Now()) {
+		return "Product is not available", nil
+	}
+	if !checkProductStocks(product, item.Quantity) {
+		return "Not enough stock", nil
+	}
+
+	selected := make([]uint, 0, len(item.Variations))
+	for _, variation := range item.Variations {
+		var productVariation *models.ProductVariation
+		for i := range product.Variations {
+			if product.Variations[i].ID == variation.ProductVariationID {
+				productVariation = &product.Variations[i]
+			}
+		}
+		if productVariation == nil {
+			return fmt.Sprintf("Variation %d is no longer available", variation.ProductVariationID), nil
+		}
+		for _, option := range variation.Options {
+			found := false
+			for _, productOption := range productVariation.Options {
+				found = found || productOption.ID == option.VariationOptionID
+			}
+			if !found {
+				return fmt.Sprintf("Option %d is no longer available", option.VariationOptionID), nil
+			}
+		}
+		selected = append(selected, variation.ProductVariationID)
+	}
+	if err := checkRequiredVariations(product, selected); err != nil {
+		return "Product requires new choices", nil
+	}
+
+	for _, addon := range item.Addons {
+		if !contains(product.Addons, models.Addon{Model: gorm.Model{ID: addon.AddonID}}, addonComparer) {
+			return fmt.Sprintf("Addon %d is no longer available", addon.AddonID), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,135 @@
+package crud
+
+import (
+	"crypto/rand"
+	"ecommerce/app/core"
+	"ecommerce/app/core/security"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"time"
+)
+
+const (
+	otpLength         = 6
+	otpExpiry         = 10 * time.Minute
+	otpMaxAttempts    = 5
+	otpResendCooldown = time.Minute
+)
+
+func generateOTP() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(otpLength), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpLength, n), nil
+}
+
+func RequestPhoneVerification(db *gorm.DB, user models.User) error {
+	if user.PhoneNumber == "" {
+		return fmt.Errorf("user has no phone number")
+	}
+	if user.PhoneVerified {
+		return fmt.Errorf("phone number already verified")
+	}
+
+	var pending models.PhoneVerificationCode
+	err := db.First(&pending, "user_id = ?", user.ID).Error
+	if err == nil && time.Since(pending.LastSentAt) < otpResendCooldown {
+		wait := otpResendCooldown - time.Since(pending.LastSentAt)
+		return fmt.Errorf("please wait %d seconds before requesting a new code", int(wait.Seconds())+1)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("error finding code: %w", err)
+	}
+	exists := err == nil
+
+	code, err := generateOTP()
+	if err != nil {
+		return err
+	}
+	codeHash, err := security.HashPassword(code)
+	if err != nil {
+		return err
+	}
+
+	// a new code replaces the previous one and resets the attempts. The writes are conditional so concurrent
+	// requests send one code per cooldown.
+	now := time.Now()
+	var result *gorm.DB
+	if exists {
+		result = db.Model(&models.PhoneVerificationCode{}).
+			Where("user_id = ? AND last_sent_at <= ?", user.ID, now.Add(-otpResendCooldown)).
+			Updates(map[string]interface{}{
+				"phone_number": user.PhoneNumber,
+				"code_hash":    codeHash,
+				"attempts":     0,
+				"expires_at":   now.Add(otpExpiry),
+				"last_sent_at": now,
+			})
+	} else {
+		result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PhoneVerificationCode{
+			UserID:      user.ID,
+			PhoneNumber: user.PhoneNumber,
+			CodeHash:    codeHash,
+			Attempts:    0,
+			ExpiresAt:   now.Add(otpExpiry),
+			LastSentAt:  now,
+		})
+	}
+	if result.Error != nil {
+		return fmt.Errorf("error creating code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("please wait %d seconds before requesting a new code", int(otpResendCooldown.Seconds()))
+	}
+
+	message := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(otpExpiry.Minutes()))
+	if err := core.SendSMS(user.PhoneNumber, message); err != nil {
+		return err
+	}
+	return nil
+}
+
+func VerifyPhoneNumber(db *gorm.DB, user models.User, code string) error {
+	var pending models.PhoneVerificationCode
+	if err := db.First(&pending, "user_id = ?", user.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("invalid or expired code")
+		}
+		return fmt.Errorf("error finding code: %w", err)
+	}
+
+	// the phone number changed since the code was sent
+	if pending.PhoneNumber != user.PhoneNumber || pending.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("invalid or expired code")
+	}
+
+	// the attempt is claimed before the code is checked, concurrent guesses can't go over the limit
+	result := db.Model(&models.PhoneVerificationCode{}).
+		Where("user_id = ? AND attempts < ?", user.ID, otpMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("error counting the attempt: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return fmt.Errorf("too many attempts, please request a new code")
+	}
+	if !security.CheckPasswordHash(code, pending.CodeHash) {
+		return fmt.Errorf("invalid or expired code")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("phone_verified", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PhoneVerificationCode{}).Error; err != nil {
+			return fmt.Errorf("error deleting code: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,459 @@
+package crud
+
+import (
+	"archive/zip"
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	dataExportExpiry           = 7 * 24 * time.Hour
+	accountDeletionGracePeriod = 14 * 24 * time.Hour
+	// an export processing for longer was left behind by a stopped instance and is generated again
+	dataExportStaleAfter = 30 * time.Minute
+)
+
+func dataExportsDir() string {
+	if dir := os.Getenv("DATA_EXPORTS_DIR"); dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+func RequestDataExport(db *gorm.DB, user models.User, format string) (models.DataExport, error) {
+	if format == "" {
+		format = "json"
+	}
+
+	var count int64
+	if err := db.Model(&models.DataExport{}).
+		Where("user_id = ? AND status IN ?", user.ID, []string{"pending", "processing"}).
+		Count(&count).Error; err != nil {
+		return models.DataExport{}, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error checking exports: %s", err),
+		}
+	}
+	if count > 0 {
+		return models.DataExport{}, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    "An export is already being generated",
+		}
+	}
+
+	export := models.DataExport{
+		UserID: user.ID,
+		Status: "pending",
+		Format: format,
+	}
+	if err := db.Create(&export).Error; err != nil {
+		return models.DataExport{}, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error creating export: %s", err),
+		}
+	}
+	return export, nil
+}
+
+// ProcessPendingDataExports generates the pending exports, and the exports left processing by a stopped instance
+func ProcessPendingDataExports(db *gorm.DB) error {
+	for {
+		export, err := claimDataExport(db)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		generateDataExport(db, export)
+	}
+}
+
+// claimDataExport moves the next export to generate to processing, skipping the exports another instance is claiming
+func claimDataExport(db *gorm.DB) (models.DataExport, error) {
+	var export models.DataExport
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)", "pending", "processing", time.Now().Add(-dataExportStaleAfter)).
+			Order("id").
+			First(&export).Error; err != nil {
+			return err
+		}
+		return tx.Model(&export).Update("status", "processing").Error
+	})
+	return export, err
+}
+
+// generateDataExport writes a claimed export and records the outcome on the export row
+func generateDataExport(db *gorm.DB, export models.DataExport) {
+	filePath, err := writeDataExport(db, export)
+	if err != nil {
+		log.Printf("Error generating data export %d: %s", export.ID, err)
+		db.Model(&export).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return
+	}
+
+	db.Model(&export).Updates(map[string]interface{}{
+		"status":     "ready",
+		"file_path":  filePath,
+		"expires_at": time.Now().Add(dataExportExpiry),
+	})
+	log.Printf("Data export %d ready for user %d", export.ID, export.UserID)
+}
+
+func writeDataExport(db *gorm.DB, export models.DataExport) (string, error) {
+	data, err := collectUserData(db, export.UserID)
+	if err != nil {
+		return "", err
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dataExportsDir(), 0o700); err != nil {
+		return "", err
+	}
+	baseName := fmt.Sprintf("user-%d-export-%d", export.UserID, export.ID)
+
+	if export.Format != "zip" {
+		filePath := filepath.Join(dataExportsDir(), baseName+".json")
+		return filePath, os.WriteFile(filePath, content, 0o600)
+	}
+
+	filePath := filepath.Join(dataExportsDir(), baseName+".zip")
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	entry, err := archive.Create(baseName + ".json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := entry.Write(content); err != nil {
+		return "", err
+	}
+	return filePath, archive.Close()
+}
+
+func collectUserData(db *gorm.DB, userID uint) (schemas.UserDataExportSchema, error) {
+	var data schemas.UserDataExportSchema
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return data, err
+	}
+	data.GeneratedAt = time.Now()
+	data.Profile = schemas.ExportProfileSchema{
+		ID:            user.ID,
+		Email:         user.Email,
+		PhoneNumber:   user.PhoneNumber,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		IsVerified:    user.IsVerified,
+		PhoneVerified: user.PhoneVerified,
+		LastLogin:     user.LastLogin,
+		CreatedAt:     user.CreatedAt,
+	}
+
+	var orders []models.Order
+	if err := db.Where("user_id = ?", userID).
+		Preload("Products.SelectedVariations.SelectedOptions").
+		Preload("Products.SelectedAddons").
+		Find(&orders).Error; err != nil {
+		return data, err
+	}
+	orderIDs := make([]uint, len(orders))
+	for i, order := range orders {
+		data.Orders = append(data.Orders, order.ToResponse())
+		orderIDs[i] = order.ID
+	}
+
+	var payments []models.Payment
+	if err := db.Where("user_id = ?", userID).Find(&payments).Error; err != nil {
+		return data, err
+	}
+	for _, payment := range payments {
+		data.Payments = append(data.Payments, schemas.ExportPaymentSchema{
+			ID:              payment.ID,
+			OrderID:         payment.OrderID,
+			Amount:          payment.Amount,
+			Currency:        payment.Currency,
+			Status:          payment.Status,
+			Gateway:         payment.Gateway,
+			PaymentIntentID: payment.PaymentIntentID,
+			ReceiptEmail:    payment.ReceiptEmail,
+			CreatedAt:       payment.CreatedAt,
+		})
+	}
+
+	var reviews []models.Review
+	if err := db.Where("user_id = ?", userID).Find(&reviews).Error; err != nil {
+		return data, err
+	}
+	for _, review := range reviews {
+		data.Reviews = append(data.Reviews, schemas.ExportReviewSchema{
+			ID:        review.ID,
+			ProductID: review.ProductID,
+			Rating:    review.Rating,
+			Comment:   review.Comment,
+			CreatedAt: review.CreatedAt,
+		})
+	}
+
+	var addresses []models.ShippingAddress
+	if err := db.Where("order_id IN ?", orderIDs).Find(&addresses).Error; err != nil {
+		return data, err
+	}
+	for _, address := range addresses {
+		data.Addresses = append(data.Addresses, schemas.ExportAddressSchema{
+			ID:           address.ID,
+			OrderID:      address.OrderID,
+			AddressLine1: address.AddressLine1,
+			AddressLine2: address.AddressLine2,
+			City:         address.City,
+			Country:      address.Country,
+			Postcode:     address.Postcode,
+			State:        address.State,
+		})
+	}
+
+	var savedAddresses []models.Address
+	if err := db.Where("user_id = ?", userID).Find(&savedAddresses).Error; err != nil {
+		return data, err
+	}
+	for _, address := range savedAddresses {
+		data.Addresses = append(data.Addresses, schemas.ExportAddressSchema{
+			ID:           address.ID,
+			Label:        address.Label,
+			AddressLine1: address.AddressLine1,
+			AddressLine2: address.AddressLine2,
+			City:         address.City,
+			Country:      address.Country,
+			Postcode:     address.Postcode,
+			State:        address.State,
+		})
+	}
+
+	var notifications []models.Notification
+	if err := db.Where("user_id = ?", userID).Find(&notifications).Error; err != nil {
+		return data, err
+	}
+	for _, notification := range notifications {
+		data.Notifications = append(data.Notifications, schemas.ExportNotificationSchema{
+			ID:        notification.ID,
+			Title:     notification.Title,
+			Message:   notification.Message,
+			IsRead:    notification.IsRead,
+			CreatedAt: notification.CreatedAt,
+		})
+	}
+
+	return data, nil
+}
+
+func GetLatestDataExport(db *gorm.DB, user models.User) (models.DataExport, error) {
+	var export models.DataExport
+	if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").First(&export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return export, &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    "No data export found",
+			}
+		}
+		return export, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error getting export: %s", err),
+		}
+	}
+	return export, nil
+}
+
+func GetReadyDataExport(db *gorm.DB, user models.User, exportID uint) (models.DataExport, error) {
+	var export models.DataExport
+	if err := db.Where("user_id = ?", user.ID).First(&export, exportID).Error; err != nil {
+		return export, &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    "Data export not found",
+		}
+	}
+	if export.Status != "ready" || export.ExpiresAt.Before(time.Now()) {
+		return export, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Data export is not available (status: %s)", export.Status),
+		}
+	}
+	return export, nil
+}
+
+// CleanupExpiredDataExports removes archives that are past their download window
+func CleanupExpiredDataExports(db *gorm.DB) error {
+	var exports []models.DataExport
+	if err := db.Where("status = ? AND expires_at < ?", "ready", time.Now()).Find(&exports).Error; err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := db.Model(&export).Updates(map[string]interface{}{"status": "expired", "file_path": ""}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RequestAccountDeletion(db *gorm.DB, user models.User) (models.AccountDeletionRequest, error) {
+	var deletionRequest models.AccountDeletionRequest
+	err := db.Where("user_id = ? AND cancelled_at IS NULL AND processed_at IS NULL", user.ID).First(&deletionRequest).Error
+	if err == nil {
+		return deletionRequest, &core.HTTPError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("Account deletion already scheduled for %s", deletionRequest.ScheduledAt.Format(time.RFC3339)),
+		}
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return deletionRequest, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error checking deletion requests: %s", err),
+		}
+	}
+
+	deletionRequest = models.AccountDeletionRequest{
+		UserID:      user.ID,
+		ScheduledAt: time.Now().Add(accountDeletionGracePeriod),
+	}
+	if err := db.Create(&deletionRequest).Error; err != nil {
+		return deletionRequest, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error creating deletion request: %s", err),
+		}
+	}
+	message := fmt.Sprintf("Your account will be deleted on %s. You can cancel this until then.", deletionRequest.ScheduledAt.Format(time.RFC1123))
+	if err := core.SendEmail(user.Email, "Account Deletion Scheduled", message); err != nil {
+		log.Printf("Error sending deletion email to user %d: %s", user.ID, err)
+	}
+	return deletionRequest, nil
+}
+
+func CancelAccountDeletion(db *gorm.DB, user models.User) error {
+	result := db.Model(&models.AccountDeletionRequest{}).
+		Where("user_id = ? AND cancelled_at IS NULL AND processed_at IS NULL", user.ID).
+		Update("cancelled_at", time.Now())
+	if result.Error != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error cancelling deletion: %s", result.Error),
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    "No pending account deletion",
+		}
+	}
+	return nil
+}
+
+// ProcessDueAccountDeletions anonymises the users whose grace period is over
+func ProcessDueAccountDeletions(db *gorm.DB) error {
+	var dueRequests []models.AccountDeletionRequest
+	if err := db.Where("cancelled_at IS NULL AND processed_at IS NULL AND scheduled_at <= ?", time.Now()).
+		Find(&dueRequests).Error; err != nil {
+		return err
+	}
+
+	for _, deletionRequest := range dueRequests {
+		var exportFiles []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if exportFiles, err = anonymiseUser(tx, deletionRequest.UserID); err != nil {
+				return err
+			}
+			return tx.Model(&deletionRequest).Update("processed_at", time.Now()).Error
+		})
+		if err != nil {
+			log.Printf("Error deleting account of user %d: %s", deletionRequest.UserID, err)
+			continue
+		}
+		// the files go once the rows pointing to them are gone for good
+		for _, filePath := range exportFiles {
+			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error removing data export %s of user %d: %s", filePath, deletionRequest.UserID, err)
+			}
+		}
+		log.Printf("Account of user %d anonymised", deletionRequest.UserID)
+	}
+	return nil
+}
+
+// anonymiseUser wipes personal data but keeps orders and payments for accounting,
+// it returns the data export files to remove once the transaction commits
+func anonymiseUser(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":           fmt.Sprintf("deleted-%d@deleted.invalid", userID),
+		"phone_number":    gorm.Expr("NULL"),
+		"first_name":      "",
+		"last_name":       "",
+		"hashed_password": "",
+		"is_verified":     false,
+		"phone_verified":  false,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	orderIDs := tx.Model(&models.Order{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Model(&models.ShippingAddress{}).Where("order_id IN (?)", orderIDs).Updates(map[string]interface{}{
+		"address_line1": "",
+		"address_line2": "",
+		"postcode":      "",
+		"latitude":      gorm.Expr("NULL"),
+		"longitude":     gorm.Expr("NULL"),
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.Payment{}).Where("user_id = ?", userID).Update("receipt_email", "").Error; err != nil {
+		return nil, err
+	}
+
+	// credentials and pending flows tied to the account
+	for _, model := range []interface{}{
+		&models.Address{},
+		&models.UserIdentity{},
+		&models.EmailVerificationToken{},
+		&models.PasswordResetToken{},
+		&models.EmailChangeRequest{},
+		&models.PhoneVerificationCode{},
+		&models.Notification{},
+	} {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var exportFiles []string
+	if err := tx.Model(&models.DataExport{}).Where("user_id = ? AND file_path <> ''", userID).
+		Pluck("file_path", &exportFiles).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.DataExport{}).Error; err != nil {
+		return nil, err
+	}
+
+	// the soft delete invalidates every issued token since the auth middleware no longer finds the user
+	return exportFiles, tx.Delete(&models.User{}, userID).Error
+}
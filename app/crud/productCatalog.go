@@ -0,0 +1,445 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/search"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// maxSlugLength leaves room for the suffix added to taken slugs
+const maxSlugLength = 240
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// preloadProduct loads what the product responses show, the images in their order
+func preloadProduct(query *gorm.DB) *gorm.DB {
+	return query.Preload("Addons").Preload("Variations").Preload("Categories").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).Preload("Images.Media")
+}
+
+// GetProductBySlug returns a published product by its slug
+func GetProductBySlug(db *gorm.DB, slug string) (schemas.ProductResponseSchema, error) {
+	var dbProduct models.Product
+	err := preloadProduct(db).Where("slug = ?", slug).Where(models.PublishedProductSQL).First(&dbProduct).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return schemas.ProductResponseSchema{}, &core.HTTPError{
+			Message:    "Product not found",
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if err != nil {
+		return schemas.ProductResponseSchema{}, &core.HTTPError{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return dbProduct.ToResponse(), nil
+}
+
+func CreateProduct(db *gorm.DB, productData schemas.ProductSchema) (models.Product, error) {
+	product := models.Product{IsActive: true}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := applyProductData(tx, &product, productData); err != nil {
+			return err
+		}
+		if err := tx.Omit("Images", "Addons").Create(&product).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("Error creating product: %s", err),
+			}
+		}
+		return saveProductRelations(tx, &product, productData)
+	})
+	if err != nil {
+		return product, err
+	}
+	if err := search.Index(db, product.ID); err != nil {
+		log.Printf("Error indexing product %d: %v", product.ID, err)
+	}
+	return product, nil
+}
+
+func UpdateProduct(db *gorm.DB, productID uint, productData schemas.ProductSchema) (models.Product, error) {
+	var product models.Product
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&product, productID).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Product %d not found", productID),
+			}
+		}
+		if err := applyProductData(tx, &product, productData); err != nil {
+			return err
+		}
+		// past orders keep their own copy of the prices they were charged
+		if err := tx.Omit("Images", "Addons").Save(&product).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("Error updating product: %s", err),
+			}
+		}
+		return saveProductRelations(tx, &product, productData)
+	})
+	if err != nil {
+		return product, err
+	}
+	if err := search.Index(db, product.ID); err != nil {
+		log.Printf("Error indexing product %d: %v", product.ID, err)
+	}
+	return product, nil
+}
+
+func DeleteProduct(db *gorm.DB, productID uint) error {
+	result := db.Delete(&models.Product{}, productID)
+	if result.Error != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error deleting product: %s", result.Error),
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Product %d not found", productID),
+		}
+	}
+	if err := search.Remove(db, productID); err != nil {
+		log.Printf("Error removing product %d from the search index: %v", productID, err)
+	}
+	return nil
+}
+
+// applyProductData checks the product data and copies it to the product, the relations are saved by saveProductRelations
+func applyProductData(tx *gorm.DB, product *models.Product, productData schemas.ProductSchema) error {
+	if productData.PublishFrom != nil && productData.PublishUntil != nil && !productData.PublishUntil.After(*productData.PublishFrom) {
+		return &core.ValidationError{Field: "PublishUntil", Message: "This field must be after publish_from"}
+	}
+	if err := validateProductAttributes(productData.Attributes); err != nil {
+		return err
+	}
+	if productData.BranchID != nil {
+		if _, err := GetBranchByID(tx, *productData.BranchID); err != nil {
+			return err
+		}
+	}
+	if _, err := GetCategoryByID(tx, productData.CategoryID); err != nil {
+		return err
+	}
+	if productData.SubCategoryID != nil {
+		subCategory, err := GetSubCategoryByID(tx, *productData.SubCategoryID)
+		if err != nil {
+			return err
+		}
+		if subCategory.CategoryID != productData.CategoryID {
+			return &core.ValidationError{Field: "SubCategoryID", Message: "The subcategory must belong to the category"}
+		}
+	}
+	if productData.TaxCategoryID != nil {
+		if err := tx.First(&models.TaxCategory{}, *productData.TaxCategoryID).Error; err != nil {
+			return &core.HTTPError{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Tax category %d not found", *productData.TaxCategoryID),
+			}
+		}
+	}
+
+	// an update without slug keeps the current one so the links to the product keep working
+	requestedSlug := productData.Slug
+	if requestedSlug == "" && product.ID != 0 && product.Slug != nil {
+		requestedSlug = *product.Slug
+	}
+	slug, err := uniqueSlug(tx, &models.Product{}, product.ID, requestedSlug, productData.Title, "product")
+	if err != nil {
+		return err
+	}
+	sku := optionalString(productData.SKU)
+	if sku != nil {
+		// the SKUs are unique within a branch, and among the shared products
+		query := tx.Model(&models.Product{}).Where("sku = ? AND id <> ?", *sku, product.ID)
+		if productData.BranchID != nil {
+			query = query.Where("branch_id = ?", *productData.BranchID)
+		} else {
+			query = query.Where("branch_id IS NULL")
+		}
+		var taken int64
+		if err := query.Count(&taken).Error; err != nil {
+			return productError(err)
+		}
+		if taken > 0 {
+			message := fmt.Sprintf("SKU %s is already used in this branch", *sku)
+			if productData.BranchID == nil {
+				message = fmt.Sprintf("SKU %s is already used by a shared product", *sku)
+			}
+			return &core.HTTPError{StatusCode: http.StatusConflict, Message: message}
+		}
+	}
+
+	product.Title = strings.TrimSpace(productData.Title)
+	product.Slug = &slug
+	product.SKU = sku
+	product.Barcode = optionalString(productData.Barcode)
+	product.Price = productData.Price
+	product.Description = productData.Description
+	product.Tags = productData.Tags
+	product.Attributes = productData.Attributes
+	if productData.IsActive != nil {
+		product.IsActive = *productData.IsActive
+	}
+	product.PublishFrom = productData.PublishFrom
+	product.PublishUntil = productData.PublishUntil
+	product.StockType = productData.StockType
+	product.Stock = productData.Stock
+	product.DailyStock = productData.DailyStock
+	product.DiscountType = productData.DiscountType
+	product.DiscountValue = productData.DiscountValue
+	product.Weight = productData.Weight
+	product.TaxCategoryID = productData.TaxCategoryID
+	product.CategoryID = productData.CategoryID
+	product.SubCategoryID = productData.SubCategoryID
+	product.BranchID = productData.BranchID
+	product.Image = ""
+	if len(productData.Images) > 0 {
+		product.Image = productData.Images[0].URL
+	}
+	return nil
+}
+
+// saveProductRelations replaces the images, the addons and the categories of a product
+func saveProductRelations(tx *gorm.DB, product *models.Product, productData schemas.ProductSchema) error {
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductImage{}).Error; err != nil {
+		return productError(err)
+	}
+	product.Images = make([]models.ProductImage, len(productData.Images))
+	for i, image := range productData.Images {
+		product.Images[i] = models.ProductImage{
+			ProductID: product.ID,
+			MediaID:   image.MediaID,
+			URL:       image.URL,
+			AltText:   image.AltText,
+			Position:  i,
+		}
+		if image.MediaID != nil {
+			var media models.MediaFile
+			if err := tx.First(&media, *image.MediaID).Error; err != nil {
+				return &core.ValidationError{Field: "Images", Message: fmt.Sprintf("Media file %d doesn't exist", *image.MediaID)}
+			}
+			product.Images[i].URL = ""
+			product.Images[i].Media = &media
+		}
+	}
+	if len(product.Images) > 0 {
+		if err := tx.Omit("Media").Create(&product.Images).Error; err != nil {
+			return productError(err)
+		}
+	}
+
+	var addons []models.Addon
+	if len(productData.AddonIDs) > 0 {
+		if err := tx.Find(&addons, productData.AddonIDs).Error; err != nil {
+			return productError(err)
+		}
+		if len(addons) != len(uniqueIDs(productData.AddonIDs)) {
+			return &core.ValidationError{Field: "AddonIDs", Message: "Some addons don't exist"}
+		}
+	}
+	if err := tx.Model(product).Association("Addons").Replace(addons); err != nil {
+		return productError(err)
+	}
+	product.Addons = addons
+
+	// the main category is linked too, like the other categories
+	categoryIDs := uniqueIDs(append([]uint{productData.CategoryID}, productData.CategoryIDs...))
+	var categories []models.Category
+	ids := make([]uint, 0, len(categoryIDs))
+	for id := range categoryIDs {
+		ids = append(ids, id)
+	}
+	if err := tx.Find(&categories, ids).Error; err != nil {
+		return productError(err)
+	}
+	if len(categories) != len(categoryIDs) {
+		return &core.ValidationError{Field: "CategoryIDs", Message: "Some categories don't exist"}
+	}
+	if err := tx.Model(product).Association("Categories").Replace(categories); err != nil {
+		return productError(err)
+	}
+	product.Categories = categories
+
+	// only the shared products are sold through branch products
+	if product.BranchID != nil {
+		if err := tx.Where("product_id = ?", product.ID).Delete(&models.BranchProduct{}).Error; err != nil {
+			return productError(err)
+		}
+	}
+	return nil
+}
+
+// uniqueSlug checks the requested slug is free in the table of model, or makes a free one from the title
+func uniqueSlug(tx *gorm.DB, model interface{}, id uint, requested string, title string, fallback string) (string, error) {
+	if requested != "" {
+		if !slugPattern.MatchString(requested) {
+			return "", &core.ValidationError{
+				Field:   "Slug",
+				Message: "This field must only contain lowercase letters and digits separated by dashes",
+			}
+		}
+		taken, err := slugTaken(tx, model, id, requested)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", &core.HTTPError{
+				StatusCode: http.StatusConflict,
+				Message:    fmt.Sprintf("Slug %s is already used", requested),
+			}
+		}
+		return requested, nil
+	}
+
+	base := Slugify(title)
+	if base == "" {
+		base = fallback
+	}
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := slugTaken(tx, model, id, slug)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func slugTaken(tx *gorm.DB, model interface{}, id uint, slug string) (bool, error) {
+	var taken int64
+	err := tx.Model(model).Where("slug = ? AND id <> ?", slug, id).Count(&taken).Error
+	if err != nil {
+		return false, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error checking slug: %s", err),
+		}
+	}
+	return taken > 0, nil
+}
+
+// Slugify lowercases a text and joins its letters and digits with dashes, e.g. "Café Latte (Large)" gives "cafe-latte-large"
+func Slugify(text string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		r = foldAccent(r)
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			dash = true
+		}
+		if slug.Len() >= maxSlugLength {
+			break
+		}
+	}
+	return strings.Trim(slug.String(), "-")
+}
+
+// foldAccent maps the common accented latin letters to their plain letter
+func foldAccent(r rune) rune {
+	switch {
+	case strings.ContainsRune("àáâãäå", r):
+		return 'a'
+	case strings.ContainsRune("çć", r):
+		return 'c'
+	case strings.ContainsRune("èéêë", r):
+		return 'e'
+	case strings.ContainsRune("ìíîï", r):
+		return 'i'
+	case strings.ContainsRune("ñń", r):
+		return 'n'
+	case strings.ContainsRune("òóôõöø", r):
+		return 'o'
+	case strings.ContainsRune("ùúûü", r):
+		return 'u'
+	case strings.ContainsRune("ýÿ", r):
+		return 'y'
+	}
+	return r
+}
+
+// validateProductAttributes checks the attribute names are unique and the values match their type
+func validateProductAttributes(attributes []schemas.ProductAttributeSchema) error {
+	names := make(map[string]bool, len(attributes))
+	for _, attribute := range attributes {
+		if names[attribute.Name] {
+			return &core.ValidationError{Field: "Attributes", Message: fmt.Sprintf("Attribute %s is given more than once", attribute.Name)}
+		}
+		names[attribute.Name] = true
+
+		valid := false
+		switch value := attribute.Value.(type) {
+		case string:
+			valid = attribute.Type == "text"
+		case float64:
+			valid = attribute.Type == "number"
+		case bool:
+			valid = attribute.Type == "boolean"
+		case []interface{}:
+			valid = attribute.Type == "list"
+			for _, item := range value {
+				if _, ok := item.(string); !ok {
+					valid = false
+				}
+			}
+		}
+		if !valid {
+			return &core.ValidationError{
+				Field:   "Attributes",
+				Message: fmt.Sprintf("The value of %s must be a %s", attribute.Name, attributeTypeNames[attribute.Type]),
+			}
+		}
+	}
+	return nil
+}
+
+var attributeTypeNames = map[string]string{
+	"text":    "string",
+	"number":  "number",
+	"boolean": "boolean",
+	"list":    "list of strings",
+}
+
+func optionalString(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
+
+func productError(err error) error {
+	return &core.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    fmt.Sprintf("Error saving product: %s", err),
+	}
+}
@@ -0,0 +1,232 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/search"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"fmt"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// facets of the product list, the filter of a facet is left out when counting its own values
+// so the other values of a multi-select filter keep their counts
+const (
+	categoryFacet = "category"
+	tagFacet      = "tag"
+	branchFacet   = "branch"
+	priceFacet    = "price"
+)
+
+// priceBucketLimits are the upper limits of the price facet buckets, the last bucket has no upper limit
+var priceBucketLimits = []float64{10, 25, 50, 100, 250}
+
+// maxTagFacets caps the tags returned by the tag facet, the most used first
+const maxTagFacets = 30
+
+// productCategoriesSQL links the products to their main category and to their other categories,
+// the products saved before the links existed only have their main category
+const productCategoriesSQL = `SELECT id AS product_id, category_id FROM products
+	UNION SELECT product_id, category_id FROM product_categories`
+
+// productBranchesSQL links the products to the branches selling them, their own branch or the branches of
+// their branch products for the shared products
+const productBranchesSQL = `SELECT id AS product_id, branch_id FROM products WHERE branch_id IS NOT NULL
+	UNION SELECT product_id, branch_id FROM branch_products WHERE is_active AND deleted_at IS NULL`
+
+// branchProductColumns are the product columns the branch products override in the products of a branch
+var branchProductColumns = map[string]string{
+	"price":                   "coalesce(branch_products.price, products.price)",
+	"stock_type":              "coalesce(branch_products.stock_type, products.stock_type)",
+	"stock":                   "coalesce(branch_products.stock, products.stock)",
+	"daily_stock":             "coalesce(branch_products.daily_stock, products.daily_stock)",
+	"last_daily_stock_update": "coalesce(branch_products.last_daily_stock_update, products.last_daily_stock_update)",
+	"is_active":               "products.is_active AND coalesce(branch_products.is_active, true)",
+}
+
+// categorySubtreeSQL selects the ids of the given categories and of all their descendants
+const categorySubtreeSQL = `WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE id IN ? AND deleted_at IS NULL
+		UNION SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+		WHERE categories.deleted_at IS NULL
+	) SELECT id FROM subtree`
+
+// productsTable is the products table of a list. The list of a single branch reads the products as the branch sells
+// them, with the values of their branch product for the shared products, from a table standing in for the products
+// table so the filters and the sorts apply to the branch values.
+func productsTable(db *gorm.DB, params schemas.ProductListQuerySchema) (*gorm.DB, error) {
+	query := db.Model(&models.Product{})
+	if len(params.BranchIDs) != 1 {
+		return query, nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&models.Product{}); err != nil {
+		return nil, facetError(err)
+	}
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		if column, ok := branchProductColumns[field.DBName]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", column, field.DBName))
+		} else {
+			columns = append(columns, "products."+field.DBName)
+		}
+	}
+	columns = append(columns, "coalesce(branch_products.is_available, true) AS is_available")
+	branchProducts := db.Session(&gorm.Session{NewDB: true}).Table("products").
+		Select(strings.Join(columns, ", ")).
+		Joins(`LEFT JOIN branch_products ON branch_products.product_id = products.id AND products.branch_id IS NULL
+			AND branch_products.branch_id = ? AND branch_products.deleted_at IS NULL`, params.BranchIDs[0])
+	return query.Table("(?) AS products", branchProducts), nil
+}
+
+// filterProducts applies the list filters to a products query, except the filter of the facet named except
+func filterProducts(query *gorm.DB, params schemas.ProductListQuerySchema, searchIDs []int64, except string) *gorm.DB {
+	query = query.Where(models.PublishedProductSQL)
+	if len(params.CategoryIDs) > 0 && except != categoryFacet {
+		query = query.Where("products.id IN (SELECT product_id FROM ("+productCategoriesSQL+") AS product_links WHERE category_id IN ("+categorySubtreeSQL+"))",
+			params.CategoryIDs)
+	}
+	if len(params.SubCategoryIDs) > 0 {
+		query = query.Where("products.sub_category_id IN ?", params.SubCategoryIDs)
+	}
+	if len(params.BranchIDs) > 0 && except != branchFacet {
+		query = query.Where("products.id IN (SELECT product_id FROM ("+productBranchesSQL+") AS product_branches WHERE branch_id IN ?)",
+			params.BranchIDs)
+	}
+	if len(params.Tags) > 0 && except != tagFacet {
+		query = query.Where("products.tags && ?", pq.StringArray(params.Tags))
+	}
+	if except != priceFacet {
+		if params.MinPrice != nil {
+			query = query.Where("products.price >= ?", *params.MinPrice)
+		}
+		if params.MaxPrice != nil {
+			query = query.Where("products.price <= ?", *params.MaxPrice)
+		}
+	}
+	if searchIDs != nil {
+		query = query.Where("products.id IN ?", append(searchIDs, 0))
+	}
+	if params.InStock {
+		query = query.Where("products.stock_type = 'UNLIMITED' OR products.stock > 0")
+		// only the products of a branch know their availability, see productsTable
+		if len(params.BranchIDs) == 1 {
+			query = query.Where("products.is_available")
+		}
+	}
+	if params.OnSale {
+		query = query.Where("products.discount_value > 0")
+	}
+	if params.MinRating != nil {
+		query = query.Where(`(SELECT avg(reviews.rating) FROM reviews
+			WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL) >= ?`, *params.MinRating)
+	}
+	return query
+}
+
+// searchProductIDs returns the ids of the products matching the search text, best matches first,
+// nil when there is no search text
+func searchProductIDs(db *gorm.DB, text string) ([]int64, error) {
+	if text == "" {
+		return nil, nil
+	}
+	hits, err := search.Search(db, search.Query{Text: text, Limit: maxSearchResults})
+	if err != nil {
+		return nil, &core.HTTPError{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	searchIDs := make([]int64, len(hits))
+	for i, hit := range hits {
+		searchIDs[i] = int64(hit.ProductID)
+	}
+	return searchIDs, nil
+}
+
+// ProductFacets counts the products of the filtered list per category, tag, branch and price bucket
+func ProductFacets(db *gorm.DB, params schemas.ProductListQuerySchema) (schemas.ProductFacetsSchema, error) {
+	facets := schemas.ProductFacetsSchema{
+		Categories: []schemas.FacetValueSchema{},
+		Tags:       []schemas.FacetValueSchema{},
+		Branches:   []schemas.FacetValueSchema{},
+		Prices:     []schemas.PriceBucketSchema{},
+	}
+	searchIDs, err := searchProductIDs(db, params.Search)
+	if err != nil {
+		return facets, err
+	}
+	table, err := productsTable(db, params)
+	if err != nil {
+		return facets, err
+	}
+	products := func(except string) *gorm.DB {
+		return filterProducts(table.Session(&gorm.Session{}), params, searchIDs, except)
+	}
+
+	if err := products(categoryFacet).
+		Select("product_links.category_id AS id, coalesce(categories.title, '') AS value, count(DISTINCT products.id) AS count").
+		Joins("JOIN (" + productCategoriesSQL + ") AS product_links ON product_links.product_id = products.id").
+		Joins("LEFT JOIN categories ON categories.id = product_links.category_id").
+		Group("product_links.category_id, categories.title").
+		Order("count DESC, value").
+		Scan(&facets.Categories).Error; err != nil {
+		return facets, facetError(err)
+	}
+
+	if err := products(tagFacet).
+		Select("tag AS value, count(*) AS count").
+		Joins("CROSS JOIN unnest(products.tags) AS tag").
+		Group("tag").
+		Order("count DESC, value").
+		Limit(maxTagFacets).
+		Scan(&facets.Tags).Error; err != nil {
+		return facets, facetError(err)
+	}
+
+	if err := products(branchFacet).
+		Select("product_branches.branch_id AS id, coalesce(branches.name, '') AS value, count(DISTINCT products.id) AS count").
+		Joins("JOIN (" + productBranchesSQL + ") AS product_branches ON product_branches.product_id = products.id").
+		Joins("LEFT JOIN branches ON branches.id = product_branches.branch_id").
+		Group("product_branches.branch_id, branches.name").
+		Order("count DESC, value").
+		Scan(&facets.Branches).Error; err != nil {
+		return facets, facetError(err)
+	}
+
+	var buckets []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := products(priceFacet).
+		Select("width_bucket(products.price::double precision, ?::double precision[]) AS bucket, count(*) AS count", pq.Array(priceBucketLimits)).
+		Group("bucket").
+		Order("bucket").
+		Scan(&buckets).Error; err != nil {
+		return facets, facetError(err)
+	}
+	for _, bucket := range buckets {
+		priceBucket := schemas.PriceBucketSchema{Count: bucket.Count}
+		if bucket.Bucket > 0 {
+			priceBucket.Min = priceBucketLimits[bucket.Bucket-1]
+		}
+		if bucket.Bucket < len(priceBucketLimits) {
+			priceBucket.Max = &priceBucketLimits[bucket.Bucket]
+		}
+		facets.Prices = append(facets.Prices, priceBucket)
+	}
+	return facets, nil
+}
+
+func facetError(err error) error {
+	return &core.HTTPError{
+		Message:    fmt.Sprintf("Error counting product facets: %s", err),
+		StatusCode: http.StatusInternalServerError,
+	}
+}
@@ -0,0 +1,178 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"fmt"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+)
+
+// productSort is a product list order the sort_by parameter can ask for
+type productSort struct {
+	// the SQL expression sorted on, it must never be NULL and is never taken from the request
+	column string
+	// direction used when the request doesn't give one
+	desc bool
+	// the column value of a product, kept in the page cursors
+	value func(p models.Product) interface{}
+	// name the column is selected as, for the values that aren't product columns
+	selectAs string
+	// sorts by the search results order, only allowed when searching
+	relevance bool
+}
+
+const ratingSQL = `coalesce((SELECT avg(reviews.rating)::double precision FROM reviews
+	WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL), 0)`
+
+// discountSQL mirrors models.Product.DiscountPercentage
+const discountSQL = `CASE WHEN products.discount_type = 'percentage' THEN products.discount_value::double precision
+	WHEN products.discount_value > 0 AND products.price > 0
+	THEN products.discount_value::double precision / products.price::double precision * 100
+	ELSE 0 END`
+
+var productSorts = map[string]productSort{
+	"price": {
+		column: "products.price",
+		value:  func(p models.Product) interface{} { return p.Price },
+	},
+	"title": {
+		column: "products.title",
+		value:  func(p models.Product) interface{} { return p.Title },
+	},
+	"newest": {
+		column: "products.created_at",
+		desc:   true,
+		value:  func(p models.Product) interface{} { return p.CreatedAt },
+	},
+	"best_selling": {
+		column: "products.total_sales",
+		desc:   true,
+		value:  func(p models.Product) interface{} { return p.TotalSales },
+	},
+	"rating": {
+		column:   ratingSQL,
+		desc:     true,
+		value:    func(p models.Product) interface{} { return p.AverageRating },
+		selectAs: "average_rating",
+	},
+	"discount": {
+		column: discountSQL,
+		desc:   true,
+		value:  func(p models.Product) interface{} { return p.DiscountPercentage() },
+	},
+	"relevance": {
+		column:    "coalesce(array_position(?::bigint[], products.id::bigint), 0)",
+		relevance: true,
+	},
+}
+
+// maxSortKeys caps the keys of a multi-key sort
+const maxSortKeys = 3
+
+// productOrder is a parsed sort_by parameter
+type productOrder struct {
+	keyset pagination.Keyset
+	key    func(p models.Product) ([]interface{}, uint)
+	// the extra columns the sort needs selected
+	selects []string
+}
+
+// parseProductOrder parses a comma separated list of sort keys, each optionally followed by :asc or :desc
+// (e.g. "best_selling,price:asc"), sortOrder is the direction of the keys that don't give one.
+// The products are sorted by relevance when searching without sort keys, and by id otherwise.
+// The id always breaks ties so the order is stable across pages.
+func parseProductOrder(sortBy, sortOrder string, searchIDs []int64) (productOrder, error) {
+	order := productOrder{
+		keyset: pagination.ByID("products.id", false),
+		key:    func(p models.Product) ([]interface{}, uint) { return nil, p.ID },
+	}
+	sortBy = strings.TrimSpace(sortBy)
+	if sortBy == "" {
+		if searchIDs == nil {
+			return order, nil
+		}
+		sortBy = "relevance"
+	}
+
+	positions := make(map[uint]int, len(searchIDs))
+	for i, id := range searchIDs {
+		positions[uint(id)] = i + 1
+	}
+
+	fields := strings.Split(sortBy, ",")
+	if len(fields) > maxSortKeys {
+		return order, sortError(fmt.Sprintf("At most %d sort keys are allowed", maxSortKeys))
+	}
+	var names []string
+	var sorts []productSort
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		name, dir, hasDir := strings.Cut(strings.TrimSpace(field), ":")
+		option, ok := productSorts[name]
+		if !ok {
+			return order, sortError(fmt.Sprintf("Unknown sort key %q, valid keys are: %s", name, productSortNames()))
+		}
+		if seen[name] {
+			return order, sortError(fmt.Sprintf("Sort key %q is given more than once", name))
+		}
+		seen[name] = true
+		if option.relevance && searchIDs == nil {
+			return order, sortError("Sorting by relevance needs a search")
+		}
+
+		desc := option.desc
+		switch {
+		case hasDir:
+			if dir != "asc" && dir != "desc" {
+				return order, sortError(fmt.Sprintf("Invalid direction %q for %s, use asc or desc", dir, name))
+			}
+			desc = dir == "desc"
+		case sortOrder != "" && !option.relevance:
+			desc = strings.EqualFold(sortOrder, "desc")
+		}
+
+		key := pagination.SortKey{Column: option.column, Desc: desc}
+		if option.relevance {
+			key.Vars = []interface{}{pq.Array(searchIDs)}
+			option.value = func(p models.Product) interface{} { return positions[p.ID] }
+		}
+		if option.selectAs != "" {
+			order.selects = append(order.selects, fmt.Sprintf("%s AS %s", option.column, option.selectAs))
+		}
+		order.keyset.Keys = append(order.keyset.Keys, key)
+		names = append(names, name+direction(desc))
+		sorts = append(sorts, option)
+	}
+	order.keyset.Name = strings.Join(names, ",")
+	order.key = func(p models.Product) ([]interface{}, uint) {
+		values := make([]interface{}, len(sorts))
+		for i, option := range sorts {
+			values[i] = option.value(p)
+		}
+		return values, p.ID
+	}
+	return order, nil
+}
+
+func productSortNames() string {
+	names := make([]string, 0, len(productSorts))
+	for name := range productSorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func sortError(message string) error {
+	return &core.ValidationError{Field: "SortBy", Message: message}
+}
+
+func direction(desc bool) string {
+	if desc {
+		return ":desc"
+	}
+	return ":asc"
+}
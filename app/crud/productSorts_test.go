@@ -0,0 +1,167 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProductOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortBy    string
+		sortOrder string
+		searchIDs []int64
+		// expected keyset name and sort keys, the id is always the last key
+		keyset string
+		keys   []pagination.SortKey
+	}{
+		{name: "no sort", keyset: "id"},
+		{name: "blank sort", sortBy: "  ", keyset: "id"},
+		{
+			name:      "search without sort",
+			searchIDs: []int64{3, 1},
+			keyset:    "relevance:asc",
+			keys:      []pagination.SortKey{{Column: productSorts["relevance"].column}},
+		},
+		{
+			name:   "default ascending",
+			sortBy: "price",
+			keyset: "price:asc",
+			keys:   []pagination.SortKey{{Column: "products.price"}},
+		},
+		{
+			name:   "default descending",
+			sortBy: "newest",
+			keyset: "newest:desc",
+			keys:   []pagination.SortKey{{Column: "products.created_at", Desc: true}},
+		},
+		{
+			name:   "explicit direction",
+			sortBy: "price:desc",
+			keyset: "price:desc",
+			keys:   []pagination.SortKey{{Column: "products.price", Desc: true}},
+		},
+		{
+			name:      "sort order for the keys without direction",
+			sortBy:    "best_selling,price:desc",
+			sortOrder: "asc",
+			keyset:    "best_selling:asc,price:desc",
+			keys:      []pagination.SortKey{{Column: "products.total_sales"}, {Column: "products.price", Desc: true}},
+		},
+		{
+			name:      "sort order is case insensitive",
+			sortBy:    "title",
+			sortOrder: "DESC",
+			keyset:    "title:desc",
+			keys:      []pagination.SortKey{{Column: "products.title", Desc: true}},
+		},
+		{
+			name:      "relevance ignores the sort order",
+			sortBy:    "relevance,price",
+			sortOrder: "desc",
+			searchIDs: []int64{3, 1},
+			keyset:    "relevance:asc,price:desc",
+			keys:      []pagination.SortKey{{Column: productSorts["relevance"].column}, {Column: "products.price", Desc: true}},
+		},
+		{
+			name:   "spaces around the keys",
+			sortBy: " price , title:desc ",
+			keyset: "price:asc,title:desc",
+			keys:   []pagination.SortKey{{Column: "products.price"}, {Column: "products.title", Desc: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := parseProductOrder(tt.sortBy, tt.sortOrder, tt.searchIDs)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if order.keyset.Name != tt.keyset {
+				t.Errorf("keyset name: got %q, want %q", order.keyset.Name, tt.keyset)
+			}
+			if order.keyset.IDColumn != "products.id" || order.keyset.IDDesc {
+				t.Errorf("the id must break the ties in ascending order, got %q desc=%t", order.keyset.IDColumn, order.keyset.IDDesc)
+			}
+			if len(order.keyset.Keys) != len(tt.keys) {
+				t.Fatalf("keys: got %d, want %d", len(order.keyset.Keys), len(tt.keys))
+			}
+			for i, key := range order.keyset.Keys {
+				if key.Column != tt.keys[i].Column || key.Desc != tt.keys[i].Desc {
+					t.Errorf("key %d: got %s desc=%t, want %s desc=%t", i, key.Column, key.Desc, tt.keys[i].Column, tt.keys[i].Desc)
+				}
+			}
+		})
+	}
+}
+
+func TestParseProductOrderErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortBy    string
+		searchIDs []int64
+		message   string
+	}{
+		{name: "unknown key", sortBy: "stock", message: `Unknown sort key "stock"`},
+		{name: "keys are case sensitive", sortBy: "PRICE", message: `Unknown sort key "PRICE"`},
+		{name: "column name", sortBy: "products.price", message: `Unknown sort key "products.price"`},
+		{name: "injected SQL", sortBy: "price; DROP TABLE products", message: `Unknown sort key "price; DROP TABLE products"`},
+		{name: "injected direction", sortBy: "price:desc NULLS FIRST", message: `Invalid direction "desc NULLS FIRST"`},
+		{name: "unknown direction", sortBy: "price:up", message: `Invalid direction "up" for price`},
+		{name: "empty key", sortBy: "price,", message: `Unknown sort key ""`},
+		{name: "duplicate key", sortBy: "price,title,price:desc", message: `Sort key "price" is given more than once`},
+		{name: "too many keys", sortBy: "price,title,newest,rating", message: "At most 3 sort keys are allowed"},
+		{name: "relevance without search", sortBy: "relevance", message: "Sorting by relevance needs a search"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseProductOrder(tt.sortBy, "", tt.searchIDs)
+			var validationErr *core.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got %v, want a validation error", err)
+			}
+			if validationErr.Field != "SortBy" {
+				t.Errorf("field: got %q, want SortBy", validationErr.Field)
+			}
+			if !strings.Contains(validationErr.Message, tt.message) {
+				t.Errorf("message: got %q, want it to contain %q", validationErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseProductOrderCursorValues(t *testing.T) {
+	product := models.Product{Price: 9.5, TotalSales: 12}
+	product.ID = 7
+
+	order, err := parseProductOrder("best_selling,price", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	values, id := order.key(product)
+	if !reflect.DeepEqual(values, []interface{}{uint(12), 9.5}) || id != 7 {
+		t.Errorf("got %#v and id %d", values, id)
+	}
+
+	// the relevance value is the position of the product in the search results
+	order, err = parseProductOrder("", "", []int64{4, 7})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	values, _ = order.key(product)
+	if !reflect.DeepEqual(values, []interface{}{2}) {
+		t.Errorf("relevance: got %#v", values)
+	}
+
+	order, err = parseProductOrder("rating", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(order.selects) != 1 || !strings.HasSuffix(order.selects[0], " AS average_rating") {
+		t.Errorf("rating selects: got %v", order.selects)
+	}
+}
@@ -2,88 +2,108 @@ package crud
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/core/search"
 	"ecommerce/app/models"
 	"ecommerce/app/schemas"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
 	"net/http"
-	"strings"
 )
 
-func ListProducts(db *gorm.DB, limit, offset int, filters map[string]interface{}) ([]schemas.ProductResponseSchema, error) {
-	var dbProducts []models.Product
-	query := db.Model(&models.Product{})
-
-	// Apply filters
-	if categoryID, ok := filters["category_id"].(uint); ok {
-		query = query.Where("category_id = ?", categoryID)
-	}
-
-	if subcategoryID, ok := filters["subcategory_id"].(uint); ok {
-		query = query.Where("subcategory_id = ?", subcategoryID)
+func ListProducts(db *gorm.DB, params schemas.ProductListQuerySchema, pageParams pagination.Params) (pagination.Page[models.Product], error) {
+	searchIDs, err := searchProductIDs(db, params.Search)
+	if err != nil {
+		return pagination.Page[models.Product]{}, err
 	}
-
-	if branchID, ok := filters["branch_id"].(uint); ok {
-		query = query.Where("branch_id = ?", branchID)
+	table, err := productsTable(db, params)
+	if err != nil {
+		return pagination.Page[models.Product]{}, err
 	}
+	query := preloadProduct(filterProducts(table, params, searchIDs, ""))
 
-	if minPrice, ok := filters["min_price"].(float64); ok {
-		query = query.Where("price >= ?", minPrice)
+	order, err := parseProductOrder(params.SortBy, params.SortOrder, searchIDs)
+	if err != nil {
+		return pagination.Page[models.Product]{}, err
 	}
-
-	if maxPrice, ok := filters["max_price"].(float64); ok {
-		query = query.Where("price <= ?", maxPrice)
+	if len(order.selects) > 0 {
+		query = query.Select(append([]string{"products.*"}, order.selects...))
 	}
+	return pagination.Paginate(query, pageParams, order.keyset, order.key)
+}
 
-	if searchTerm, ok := filters["search"].(string); ok {
-		query = query.Where("name LIKE ? OR description LIKE ?", "%"+searchTerm+"%", "%"+searchTerm+"%")
-	}
+// maxSearchResults caps the matches a filtered product list is taken from
+const maxSearchResults = 500
 
-	if inStock, ok := filters["in_stock"].(bool); ok && inStock {
-		query = query.Where("stock > 0")
+// SearchProducts returns the products matching a search text, best matches first
+func SearchProducts(db *gorm.DB, params schemas.ProductSearchQuerySchema, pageParams pagination.Params) (pagination.Page[schemas.ProductSearchResultSchema], error) {
+	var page pagination.Page[schemas.ProductSearchResultSchema]
+	offset, err := pageParams.Offset("search")
+	if err != nil {
+		return page, err
 	}
-
-	// Apply sorting
-	if sortBy, ok := filters["sort_by"].(string); ok {
-		order := "ASC"
-		if sortOrder, ok := filters["sort_order"].(string); ok && strings.ToUpper(sortOrder) == "DESC" {
-			order = "DESC"
+	// one more hit tells whether there is a next page
+	hits, err := search.Search(db, search.Query{
+		Text:       params.Query,
+		BranchID:   params.BranchID,
+		CategoryID: params.CategoryID,
+		Limit:      pageParams.PageSize() + 1,
+		Offset:     offset,
+	})
+	if err != nil {
+		return page, &core.HTTPError{
+			Message:    fmt.Sprintf("Error searching products: %s", err),
+			StatusCode: http.StatusInternalServerError,
 		}
-		query = query.Order(fmt.Sprintf("%s %s", sortBy, order))
 	}
 
-	// Apply pagination
-	if limit > 0 {
-		query = query.Limit(limit)
-	}
-	if offset > 0 {
-		query = query.Offset(offset)
+	productIDs := make([]uint, len(hits))
+	for i, hit := range hits {
+		productIDs[i] = hit.ProductID
 	}
-
-	// Preload related data
-	query = query.Preload("Addons").Preload("Variations")
-
-	// Execute the query
-	if err := query.Find(&dbProducts).Error; err != nil {
-		return nil, &core.HTTPError{
+	var dbProducts []models.Product
+	if err := preloadProduct(db).Where("id IN ?", productIDs).Where(models.PublishedProductSQL).Find(&dbProducts).Error; err != nil {
+		return page, &core.HTTPError{
 			Message:    err.Error(),
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
+	productsByID := make(map[uint]models.Product, len(dbProducts))
+	for _, product := range dbProducts {
+		productsByID[product.ID] = product
+	}
 
-	// Convert to response schema
-	dbProductsResponse := make([]schemas.ProductResponseSchema, len(dbProducts))
-	for i, product := range dbProducts {
-		dbProductsResponse[i] = product.ToResponse()
+	results := make([]schemas.ProductSearchResultSchema, 0, len(hits))
+	for _, hit := range hits {
+		product, ok := productsByID[hit.ProductID]
+		if !ok {
+			continue
+		}
+		results = append(results, schemas.ProductSearchResultSchema{
+			Product: product.ToResponse(),
+			Rank:    hit.Rank,
+			Snippet: hit.Snippet,
+		})
 	}
+	return pagination.OffsetPage(results, pageParams, "search", offset), nil
+}
 
-	return dbProductsResponse, nil
+// AutocompleteProducts suggests product titles for a partial search text
+func AutocompleteProducts(db *gorm.DB, params schemas.AutocompleteQuerySchema) ([]string, error) {
+	suggestions, err := search.Suggest(db, params.Query, params.BranchID, params.Limit)
+	if err != nil {
+		return nil, &core.HTTPError{
+			Message:    fmt.Sprintf("Error completing search: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return suggestions, nil
 }
 
 func GetProductByID(db *gorm.DB, productID uint) (schemas.ProductResponseSchema, error) {
 	var dbProduct models.Product
-	if err := db.Preload("Addons").Preload("Variations").First(&dbProduct, productID).Error; err != nil {
+	if err := preloadProduct(db).Where(models.PublishedProductSQL).First(&dbProduct, productID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return schemas.ProductResponseSchema{}, &core.HTTPError{
 				Message:    "Product not found",
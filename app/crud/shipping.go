@@ -0,0 +1,377 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/geo"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// ShippingDestination is what the delivery zones of a branch are matched against
+type ShippingDestination struct {
+	Postcode string
+	Point    *geo.Point
+}
+
+func ShippingDestinationFromAddress(address models.ShippingAddress) ShippingDestination {
+	destination := ShippingDestination{Postcode: address.Postcode}
+	if address.Latitude != nil && address.Longitude != nil {
+		destination.Point = &geo.Point{Lat: *address.Latitude, Lng: *address.Longitude}
+	}
+	return destination
+}
+
+func ListBranchDeliveryZones(db *gorm.DB, branchID uint, pageParams pagination.Params) (pagination.Page[models.DeliveryZone], error) {
+	query := db.Model(&models.DeliveryZone{}).Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_value")
+	}).Where("branch_id = ?", branchID)
+	keyset := pagination.Keyset{Name: "priority:desc", Keys: []pagination.SortKey{{Column: "priority", Desc: true}}}
+	return pagination.Paginate(query, pageParams, keyset,
+		func(zone models.DeliveryZone) ([]interface{}, uint) { return []interface{}{zone.Priority}, zone.ID })
+}
+
+func CreateDeliveryZone(db *gorm.DB, zoneData schemas.DeliveryZoneSchema) (models.DeliveryZone, error) {
+	if _, err := GetBranchByID(db, zoneData.BranchID); err != nil {
+		return models.DeliveryZone{}, err
+	}
+	zone := models.DeliveryZone{IsActive: true}
+	if err := applyDeliveryZoneData(&zone, zoneData); err != nil {
+		return zone, err
+	}
+	if err := db.Create(&zone).Error; err != nil {
+		return zone, &core.HTTPError{
+			Message:    fmt.Sprintf("Error creating delivery zone: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return zone, nil
+}
+
+func UpdateDeliveryZone(db *gorm.DB, zoneID uint, zoneData schemas.DeliveryZoneSchema) (models.DeliveryZone, error) {
+	var zone models.DeliveryZone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		return zone, &core.HTTPError{
+			Message:    fmt.Sprintf("Delivery zone %d not found", zoneID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if err := applyDeliveryZoneData(&zone, zoneData); err != nil {
+		return zone, err
+	}
+
+	// the rate table is replaced as a whole
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("delivery_zone_id = ?", zone.ID).Delete(&models.ShippingRate{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&zone).Error
+	})
+	if err != nil {
+		return zone, &core.HTTPError{
+			Message:    fmt.Sprintf("Error updating delivery zone: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return zone, nil
+}
+
+func DeleteDeliveryZone(db *gorm.DB, zoneID uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("delivery_zone_id = ?", zoneID).Delete(&models.ShippingRate{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.DeliveryZone{}, zoneID)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Delivery zone %d not found", zoneID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error deleting delivery zone: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func applyDeliveryZoneData(zone *models.DeliveryZone, zoneData schemas.DeliveryZoneSchema) error {
+	if zoneData.Type == "polygon" && (len(zoneData.Polygon) < 6 || len(zoneData.Polygon)%2 != 0) {
+		return &core.HTTPError{
+			Message:    "Polygon must be a flat list of at least 3 lat, lng pairs",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	postcodes := make([]string, len(zoneData.Postcodes))
+	for i, postcode := range zoneData.Postcodes {
+		postcodes[i] = normalizePostcode(postcode)
+	}
+
+	zone.BranchID = zoneData.BranchID
+	zone.Name = zoneData.Name
+	zone.Type = zoneData.Type
+	zone.Postcodes = postcodes
+	zone.RadiusKm = zoneData.RadiusKm
+	zone.Polygon = zoneData.Polygon
+	zone.RateBasis = zoneData.RateBasis
+	zone.FreeShippingThreshold = zoneData.FreeShippingThreshold
+	zone.Priority = zoneData.Priority
+	if zoneData.IsActive != nil {
+		zone.IsActive = *zoneData.IsActive
+	}
+
+	zone.Rates = make([]models.ShippingRate, len(zoneData.Rates))
+	for i, rate := range zoneData.Rates {
+		zone.Rates[i] = models.ShippingRate{
+			MinValue:     rate.MinValue,
+			MaxValue:     rate.MaxValue,
+			Price:        rate.Price,
+			PricePerUnit: rate.PricePerUnit,
+		}
+	}
+	return nil
+}
+
+// QuoteShipping finds the zone of the branch covering the destination and prices the delivery.
+// orderValue is the items total after discounts and weight is in kg.
+func QuoteShipping(db *gorm.DB, branchID uint, destination ShippingDestination, orderValue, weight float64) (schemas.ShippingQuoteResponseSchema, error) {
+	var quote schemas.ShippingQuoteResponseSchema
+
+	branch, err := GetBranchByID(db, branchID)
+	if err != nil {
+		return quote, err
+	}
+	var branchPoint *geo.Point
+	if branch.Latitude != nil && branch.Longitude != nil {
+		branchPoint = &geo.Point{Lat: *branch.Latitude, Lng: *branch.Longitude}
+	}
+
+	var distanceKm float64
+	hasDistance := branchPoint != nil && destination.Point != nil
+	if hasDistance {
+		distanceKm = geo.DistanceKm(*branchPoint, *destination.Point)
+	}
+
+	var zones []models.DeliveryZone
+	if err := db.Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_value")
+	}).Where("branch_id = ? AND is_active = ?", branchID, true).Order("priority DESC, id").Find(&zones).Error; err != nil {
+		return quote, &core.HTTPError{
+			Message:    fmt.Sprintf("Error getting delivery zones: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+
+	for _, zone := range zones {
+		if !zoneCoversDestination(zone, destination, distanceKm, hasDistance) {
+			continue
+		}
+
+		quote.DeliveryZoneID = zone.ID
+		quote.ZoneName = zone.Name
+		if hasDistance {
+			quote.DistanceKm = models.RoundMoney(distanceKm)
+		}
+		if zone.FreeShippingThreshold > 0 && orderValue >= zone.FreeShippingThreshold {
+			quote.FreeShipping = true
+			return quote, nil
+		}
+
+		var measure float64
+		switch zone.RateBasis {
+		case "distance":
+			if !hasDistance {
+				return quote, &core.HTTPError{
+					Message:    "Address coordinates are required to compute the shipping fee",
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			measure = distanceKm
+		case "weight":
+			measure = weight
+		case "order_value":
+			measure = orderValue
+		}
+
+		rate, ok := findShippingRate(zone.Rates, measure)
+		if !ok {
+			return quote, &core.HTTPError{
+				Message:    fmt.Sprintf("No shipping rate of zone %s applies to this order", zone.Name),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		fee := rate.Price + rate.PricePerUnit*measure
+		quote.ShippingFee = models.RoundMoney(fee)
+		return quote, nil
+	}
+
+	return quote, &core.HTTPError{
+		Message:    fmt.Sprintf("Address is outside of the delivery zones of branch %d", branchID),
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// QuoteShippingRequest prices the delivery of a basket that is not ordered yet
+func QuoteShippingRequest(db *gorm.DB, user models.User, quoteData schemas.ShippingQuoteSchema) (schemas.ShippingQuoteResponseSchema, error) {
+	var address models.ShippingAddress
+	switch {
+	case quoteData.ShippingAddressID != nil:
+		savedAddress, err := GetUserAddress(db, user, *quoteData.ShippingAddressID)
+		if err != nil {
+			return schemas.ShippingQuoteResponseSchema{}, err
+		}
+		address = savedAddress.ToShippingAddress(0)
+	case quoteData.ShippingAddress != nil:
+		address = models.ShippingAddress{
+			Postcode:  quoteData.ShippingAddress.Postcode,
+			Latitude:  quoteData.ShippingAddress.Latitude,
+			Longitude: quoteData.ShippingAddress.Longitude,
+		}
+	default:
+		return schemas.ShippingQuoteResponseSchema{}, &core.HTTPError{
+			Message:    "Shipping address is required",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	var orderValue, weight float64
+	for _, item := range quoteData.Products {
+		unitPrice, unitWeight, err := quoteItemUnit(db, quoteData.BranchID, item)
+		if err != nil {
+			return schemas.ShippingQuoteResponseSchema{}, err
+		}
+		orderValue += unitPrice * float64(item.Quantity)
+		weight += unitWeight * float64(item.Quantity)
+	}
+
+	return QuoteShipping(db, quoteData.BranchID, ShippingDestinationFromAddress(address), orderValue, weight)
+}
+
+// quoteItemUnit prices one unit of a basket item like the orders do: the branch price of the product with its
+// selected options and addons. It fails when the branch doesn't sell the product.
+func quoteItemUnit(db *gorm.DB, branchID uint, item schemas.ShippingQuoteItemSchema) (float64, float64, error) {
+	var product models.Product
+	if err := db.Preload("Addons").Preload("Variations.Options").First(&product, item.ProductID).Error; err != nil {
+		return 0, 0, &core.HTTPError{
+			Message:    fmt.Sprintf("Product %d not found", item.ProductID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	reason, err := ProductInBranch(db, &product, branchID)
+	if err != nil {
+		return 0, 0, &core.HTTPError{
+			Message:    fmt.Sprintf("Error loading product %d: %s", item.ProductID, err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if reason != "" {
+		return 0, 0, &core.HTTPError{
+			Message:    fmt.Sprintf("Product %d is %s", item.ProductID, reason),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	unitPrice := product.Price
+	for _, selected := range item.Variations {
+		variation, ok := findByID(product.Variations, selected.ProductVariationID, func(v models.ProductVariation) uint { return v.ID })
+		if !ok {
+			return 0, 0, &core.HTTPError{
+				Message:    fmt.Sprintf("Variation %d not found in product available variations", selected.ProductVariationID),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		for _, selectedOption := range selected.Options {
+			option, ok := findByID(variation.Options, selectedOption.VariationOptionID, func(o models.VariationOption) uint { return o.ID })
+			if !ok {
+				return 0, 0, &core.HTTPError{
+					Message:    fmt.Sprintf("VariationOption %d not found in variation %d", selectedOption.VariationOptionID, variation.ID),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			unitPrice += option.Price
+		}
+	}
+	for _, selected := range item.Addons {
+		addon, ok := findByID(product.Addons, selected.AddonID, func(a models.Addon) uint { return a.ID })
+		if !ok {
+			return 0, 0, &core.HTTPError{
+				Message:    fmt.Sprintf("Addon %d not found in product available addons", selected.AddonID),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		unitPrice += addon.Price * float64(selected.Quantity)
+	}
+	return unitPrice, product.Weight, nil
+}
+
+func findByID[T any](items []T, id uint, idOf func(T) uint) (T, bool) {
+	for _, item := range items {
+		if idOf(item) == id {
+			return item, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// OrderWeight sums the weight (kg) of the items of an order
+func OrderWeight(db *gorm.DB, orderID uint) (float64, error) {
+	var weight float64
+	err := db.Model(&models.OrderItem{}).
+		Select("COALESCE(SUM(products.weight * order_items.quantity), 0)").
+		Joins("JOIN products ON products.id = order_items.product_id").
+		Where("order_items.order_id = ?", orderID).
+		Scan(&weight).Error
+	return weight, err
+}
+
+func zoneCoversDestination(zone models.DeliveryZone, destination ShippingDestination, distanceKm float64, hasDistance bool) bool {
+	switch zone.Type {
+	case "postcode":
+		postcode := normalizePostcode(destination.Postcode)
+		if postcode == "" {
+			return false
+		}
+		for _, pattern := range zone.Postcodes {
+			// "SW1*" matches every postcode starting with SW1
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+				if strings.HasPrefix(postcode, prefix) {
+					return true
+				}
+			} else if postcode == pattern {
+				return true
+			}
+		}
+	case "radius":
+		return hasDistance && distanceKm <= zone.RadiusKm
+	case "polygon":
+		return destination.Point != nil && geo.InPolygon(*destination.Point, geo.PointsFromFlat(zone.Polygon))
+	}
+	return false
+}
+
+func findShippingRate(rates []models.ShippingRate, measure float64) (models.ShippingRate, bool) {
+	for _, rate := range rates {
+		if measure >= rate.MinValue && (rate.MaxValue == 0 || measure < rate.MaxValue) {
+			return rate, true
+		}
+	}
+	return models.ShippingRate{}, false
+}
+
+func normalizePostcode(postcode string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postcode), " ", ""))
+}
@@ -0,0 +1,47 @@
+package crud
+
+import (
+	"ecommerce/app/core/geo"
+	"ecommerce/app/models"
+	"testing"
+)
+
+func TestZoneCoversDestination(t *testing.T) {
+	postcodes := models.DeliveryZone{Type: "postcode", Postcodes: []string{"SW1*", "EC1A1BB"}}
+	radius := models.DeliveryZone{Type: "radius", RadiusKm: 5}
+	// a square around central London
+	polygon := models.DeliveryZone{Type: "polygon", Polygon: []float64{51.4, -0.2, 51.6, -0.2, 51.6, 0, 51.4, 0}}
+	inside := &geo.Point{Lat: 51.5, Lng: -0.1}
+	outside := &geo.Point{Lat: 51.7, Lng: -0.1}
+
+	tests := []struct {
+		name        string
+		zone        models.DeliveryZone
+		destination ShippingDestination
+		distanceKm  float64
+		hasDistance bool
+		want        bool
+	}{
+		{name: "postcode prefix", zone: postcodes, destination: ShippingDestination{Postcode: "SW1A 2AA"}, want: true},
+		{name: "postcode prefix is case insensitive", zone: postcodes, destination: ShippingDestination{Postcode: " sw1a 2aa "}, want: true},
+		{name: "exact postcode", zone: postcodes, destination: ShippingDestination{Postcode: "EC1A 1BB"}, want: true},
+		{name: "exact postcode needs the whole postcode", zone: postcodes, destination: ShippingDestination{Postcode: "EC1A 1B"}},
+		{name: "other postcode", zone: postcodes, destination: ShippingDestination{Postcode: "SE1 7PB"}},
+		{name: "no postcode", zone: postcodes, destination: ShippingDestination{Point: inside}},
+		{name: "within the radius", zone: radius, distanceKm: 4.99, hasDistance: true, want: true},
+		{name: "on the radius", zone: radius, distanceKm: 5, hasDistance: true, want: true},
+		{name: "beyond the radius", zone: radius, distanceKm: 5.01, hasDistance: true},
+		{name: "radius without distance", zone: radius},
+		{name: "inside the polygon", zone: polygon, destination: ShippingDestination{Point: inside}, want: true},
+		{name: "outside the polygon", zone: polygon, destination: ShippingDestination{Point: outside}},
+		{name: "polygon without coordinates", zone: polygon, destination: ShippingDestination{Postcode: "SW1A 2AA"}},
+		{name: "unknown type", zone: models.DeliveryZone{Type: "city"}, destination: ShippingDestination{Postcode: "SW1A 2AA", Point: inside}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zoneCoversDestination(tt.zone, tt.destination, tt.distanceKm, tt.hasDistance); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
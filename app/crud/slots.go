@@ -0,0 +1,132 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+// BookOrderSlot books the slot of a scheduled order, failing when the slot is full.
+// It must run in the order creation transaction so a failed order gives the slot back.
+func BookOrderSlot(tx *gorm.DB, order *models.Order) error {
+	branch, err := GetBranchWithHours(tx, order.BranchID)
+	if err != nil {
+		return err
+	}
+	return bookBranchSlot(tx, branch, order)
+}
+
+// bookBranchSlot counts the order in its slot of branch. The slots of a branch without capacity are counted too,
+// so ReleaseOrderSlot always has a booking to give back and a capacity set later starts from the real count.
+func bookBranchSlot(tx *gorm.DB, branch models.Branch, order *models.Order) error {
+	slotStart := branch.SlotStart(order.ScheduleTime)
+
+	booking := models.SlotBooking{BranchID: branch.ID, SlotStart: slotStart}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&booking).Error; err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error booking slot: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	query := tx.Model(&models.SlotBooking{}).Where("branch_id = ? AND slot_start = ?", branch.ID, slotStart)
+	if branch.SlotCapacity > 0 {
+		// the conditional increment locks the row, concurrent orders can not overbook the slot
+		query = query.Where("booked < ?", branch.SlotCapacity)
+	}
+	result := query.UpdateColumn("booked", gorm.Expr("booked + 1"))
+	if result.Error != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error booking slot: %s", result.Error),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("The %s slot is fully booked", slotStart.Format("2006-01-02 15:04")),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	order.SlotStart = &slotStart
+	return nil
+}
+
+// ReleaseOrderSlot gives back the slot booked by a scheduled order
+func ReleaseOrderSlot(tx *gorm.DB, order *models.Order) error {
+	if order.SlotStart == nil {
+		return nil
+	}
+	if err := tx.Model(&models.SlotBooking{}).
+		Where("branch_id = ? AND slot_start = ? AND booked > 0", order.BranchID, *order.SlotStart).
+		UpdateColumn("booked", gorm.Expr("booked - 1")).Error; err != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error releasing slot: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	order.SlotStart = nil
+	return nil
+}
+
+// GetSlotAvailability lists the slots of a branch day with their booked and remaining capacity
+func GetSlotAvailability(db *gorm.DB, branchID uint, date string) (schemas.SlotAvailabilityResponseSchema, error) {
+	var availability schemas.SlotAvailabilityResponseSchema
+
+	branch, err := GetActiveBranchWithHours(db, branchID)
+	if err != nil {
+		return availability, err
+	}
+	loc := branch.Location()
+	day, err := time.ParseInLocation(time.DateOnly, date, loc)
+	if err != nil {
+		return availability, &core.HTTPError{
+			Message:    "date must be formatted as YYYY-MM-DD",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	booked, err := slotBookings(db, branch.ID, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return availability, err
+	}
+
+	availability.BranchID = branch.ID
+	availability.Date = date
+	availability.Timezone = loc.String()
+	availability.Capacity = branch.SlotCapacity
+	availability.Slots = []schemas.SlotSchema{}
+	for _, slotStart := range branch.DaySlots(day) {
+		slot := schemas.SlotSchema{Start: slotStart, Booked: booked[slotStart.Unix()]}
+		if branch.SlotCapacity > 0 {
+			remaining := uint(0)
+			if slot.Booked < branch.SlotCapacity {
+				remaining = branch.SlotCapacity - slot.Booked
+			}
+			slot.Remaining = &remaining
+			slot.IsFull = remaining == 0
+		}
+		availability.Slots = append(availability.Slots, slot)
+	}
+	return availability, nil
+}
+
+// slotBookings returns the booked count of the slots between from and to, keyed by unix time
+func slotBookings(db *gorm.DB, branchID uint, from, to time.Time) (map[int64]uint, error) {
+	var bookings []models.SlotBooking
+	if err := db.Where("branch_id = ? AND slot_start >= ? AND slot_start < ?", branchID, from, to).
+		Find(&bookings).Error; err != nil {
+		return nil, &core.HTTPError{
+			Message:    fmt.Sprintf("Error fetching slot bookings: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	booked := make(map[int64]uint, len(bookings))
+	for _, booking := range bookings {
+		booked[booking.SlotStart.Unix()] = booking.Booked
+	}
+	return booked, nil
+}
@@ -0,0 +1,124 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/models"
+	"errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dryRunDB builds the statements without a database and records them, the writes report rowsAffected rows
+func dryRunDB(t *testing.T, rowsAffected int64) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("opening the dry run database: %s", err)
+	}
+	var statements []string
+	record := func(db *gorm.DB) {
+		statements = append(statements, db.Statement.SQL.String())
+		db.RowsAffected = rowsAffected
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+func TestBookAndReleaseOrderSlot(t *testing.T) {
+	scheduled := time.Date(2026, 3, 2, 12, 40, 0, 0, time.UTC)
+	slotStart := time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		capacity uint
+		// the statements of the booking then of the release
+		book    []string
+		release []string
+	}{
+		{
+			name: "no capacity",
+			book: []string{
+				`INSERT INTO "slot_bookings" ("branch_id","slot_start","booked","updated_at") VALUES ($1,$2,$3,$4) ON CONFLICT DO NOTHING RETURNING "id"`,
+				`UPDATE "slot_bookings" SET "booked"=booked + 1 WHERE branch_id = $1 AND slot_start = $2`,
+			},
+			release: []string{`UPDATE "slot_bookings" SET "booked"=booked - 1 WHERE branch_id = $1 AND slot_start = $2 AND booked > 0`},
+		},
+		{
+			name:     "with capacity",
+			capacity: 2,
+			book: []string{
+				`INSERT INTO "slot_bookings" ("branch_id","slot_start","booked","updated_at") VALUES ($1,$2,$3,$4) ON CONFLICT DO NOTHING RETURNING "id"`,
+				`UPDATE "slot_bookings" SET "booked"=booked + 1 WHERE (branch_id = $1 AND slot_start = $2) AND booked < $3`,
+			},
+			release: []string{`UPDATE "slot_bookings" SET "booked"=booked - 1 WHERE branch_id = $1 AND slot_start = $2 AND booked > 0`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t, 1)
+			branch := models.Branch{Timezone: "UTC", SlotMinutes: 15, SlotCapacity: tt.capacity}
+			branch.ID = 3
+			order := &models.Order{BranchID: branch.ID, ScheduleTime: scheduled}
+
+			if err := bookBranchSlot(db, branch, order); err != nil {
+				t.Fatalf("booking: %s", err)
+			}
+			if order.SlotStart == nil || !order.SlotStart.Equal(slotStart) {
+				t.Fatalf("slot start: got %v, want %s", order.SlotStart, slotStart)
+			}
+			assertStatements(t, *statements, tt.book)
+
+			*statements = nil
+			if err := ReleaseOrderSlot(db, order); err != nil {
+				t.Fatalf("releasing: %s", err)
+			}
+			if order.SlotStart != nil {
+				t.Errorf("the released order keeps its slot %s", order.SlotStart)
+			}
+			assertStatements(t, *statements, tt.release)
+
+			// a second release gives nothing back
+			*statements = nil
+			if err := ReleaseOrderSlot(db, order); err != nil {
+				t.Fatalf("releasing again: %s", err)
+			}
+			assertStatements(t, *statements, nil)
+		})
+	}
+}
+
+func TestBookFullSlot(t *testing.T) {
+	db, _ := dryRunDB(t, 0)
+	branch := models.Branch{Timezone: "UTC", SlotMinutes: 15, SlotCapacity: 2}
+	order := &models.Order{ScheduleTime: time.Date(2026, 3, 2, 12, 40, 0, 0, time.UTC)}
+
+	err := bookBranchSlot(db, branch, order)
+	var httpErr *core.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Fatalf("got %v, want a conflict", err)
+	}
+	if order.SlotStart != nil {
+		t.Errorf("an order that didn't get its slot has the slot %s", order.SlotStart)
+	}
+}
+
+func assertStatements(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("statements: got %d, want %d\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("statement %d\n got: %s\nwant: %s", i, got[i], want[i])
+		}
+	}
+}
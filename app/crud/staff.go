@@ -0,0 +1,69 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+)
+
+func ListBranchStaff(db *gorm.DB, branchID uint, pageParams pagination.Params) (pagination.Page[models.BranchStaff], error) {
+	return pagination.Paginate(db.Model(&models.BranchStaff{}).Preload("User").Where("branch_id = ?", branchID),
+		pageParams, pagination.ByID("id", false),
+		func(member models.BranchStaff) ([]interface{}, uint) { return nil, member.ID })
+}
+
+// AddBranchStaff adds a user to a branch team, or changes their role when they already are a member
+func AddBranchStaff(db *gorm.DB, branchID uint, staffData schemas.BranchStaffSchema) (models.BranchStaff, error) {
+	member := models.BranchStaff{BranchID: branchID, UserID: staffData.UserID, Role: staffData.Role}
+	if _, err := GetBranchByID(db, branchID); err != nil {
+		return member, err
+	}
+	if err := db.First(&member.User, staffData.UserID).Error; err != nil {
+		return member, &core.HTTPError{
+			Message:    fmt.Sprintf("User %d not found", staffData.UserID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "branch_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"role": staffData.Role}),
+	}).Omit("User", "Branch").Create(&member).Error; err != nil {
+		return member, &core.HTTPError{
+			Message:    fmt.Sprintf("Error adding branch staff: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return member, nil
+}
+
+func RemoveBranchStaff(db *gorm.DB, branchID, userID uint) error {
+	// hard delete so the user can be added again
+	result := db.Unscoped().Where("branch_id = ? AND user_id = ?", branchID, userID).Delete(&models.BranchStaff{})
+	if result.Error != nil {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("Error removing branch staff: %s", result.Error),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			Message:    fmt.Sprintf("User %d is not a member of branch %d", userID, branchID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+// ListUserBranches lists the branches a user is a member of
+func ListUserBranches(db *gorm.DB, user models.User, pageParams pagination.Params) (pagination.Page[models.Branch], error) {
+	query := db.Model(&models.Branch{}).
+		Joins("JOIN branch_staffs ON branch_staffs.branch_id = branches.id").
+		Where("branch_staffs.user_id = ? AND branch_staffs.deleted_at IS NULL", user.ID)
+	return pagination.Paginate(query, pageParams, branchesByName,
+		func(branch models.Branch) ([]interface{}, uint) { return []interface{}{branch.Name}, branch.ID })
+}
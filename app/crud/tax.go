@@ -0,0 +1,198 @@
+package crud
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"sort"
+)
+
+// TaxablePart is an amount of an order line taxed with one tax category (product or addon)
+type TaxablePart struct {
+	TaxCategoryID *uint
+	Amount        float64
+}
+
+// ResolveTaxRate returns the rate of a category for a branch, falling back to the branch tax region.
+// A nil rate means the amount is not taxed.
+func ResolveTaxRate(db *gorm.DB, taxCategoryID *uint, branch models.Branch) (*models.TaxRate, error) {
+	if taxCategoryID == nil {
+		return nil, nil
+	}
+	var rate models.TaxRate
+	err := db.Where("tax_category_id = ?", *taxCategoryID).
+		Where("branch_id = ? OR (branch_id IS NULL AND region = ?)", branch.ID, branch.TaxRegion).
+		// branch specific rates win over region rates
+		Order("branch_id IS NULL").
+		First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error resolving tax rate: %s", err),
+		}
+	}
+	return &rate, nil
+}
+
+// CalculateTaxes computes the tax of each part and groups the result per rate
+func CalculateTaxes(db *gorm.DB, branch models.Branch, parts []TaxablePart) ([]schemas.TaxLineSchema, error) {
+	linesByRate := make(map[uint]*schemas.TaxLineSchema)
+	for _, part := range parts {
+		rate, err := ResolveTaxRate(db, part.TaxCategoryID, branch)
+		if err != nil {
+			return nil, err
+		}
+		if rate == nil || part.Amount == 0 {
+			continue
+		}
+		net, tax := rate.Compute(part.Amount, branch.PricesIncludeTax)
+
+		line, ok := linesByRate[rate.ID]
+		if !ok {
+			line = &schemas.TaxLineSchema{Name: rate.Name, Rate: rate.Rate}
+			linesByRate[rate.ID] = line
+		}
+		line.TaxableAmount = models.RoundMoney(line.TaxableAmount + net)
+		line.Amount = models.RoundMoney(line.Amount + tax)
+	}
+	return sortTaxLines(linesByRate), nil
+}
+
+// MergeTaxLines sums tax lines of the same rate and scales them by factor, used to apply an order discount
+func MergeTaxLines(lines []schemas.TaxLineSchema, factor float64) []schemas.TaxLineSchema {
+	merged := make(map[string]*schemas.TaxLineSchema)
+	var keys []string
+	for _, line := range lines {
+		key := fmt.Sprintf("%s|%.3f", line.Name, line.Rate)
+		total, ok := merged[key]
+		if !ok {
+			total = &schemas.TaxLineSchema{Name: line.Name, Rate: line.Rate}
+			merged[key] = total
+			keys = append(keys, key)
+		}
+		total.TaxableAmount += line.TaxableAmount
+		total.Amount += line.Amount
+	}
+
+	result := make([]schemas.TaxLineSchema, 0, len(keys))
+	for _, key := range keys {
+		line := merged[key]
+		line.TaxableAmount = models.RoundMoney(line.TaxableAmount * factor)
+		line.Amount = models.RoundMoney(line.Amount * factor)
+		result = append(result, *line)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rate > result[j].Rate })
+	return result
+}
+
+func sortTaxLines(linesByRate map[uint]*schemas.TaxLineSchema) []schemas.TaxLineSchema {
+	lines := make([]schemas.TaxLineSchema, 0, len(linesByRate))
+	for _, line := range linesByRate {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Rate > lines[j].Rate })
+	return lines
+}
+
+func ListTaxCategories(db *gorm.DB, pageParams pagination.Params) (pagination.Page[models.TaxCategory], error) {
+	return pagination.Paginate(db.Model(&models.TaxCategory{}).Preload("Rates"), pageParams, pagination.ByID("id", false),
+		func(category models.TaxCategory) ([]interface{}, uint) { return nil, category.ID })
+}
+
+func CreateTaxCategory(db *gorm.DB, categoryData schemas.TaxCategorySchema) (models.TaxCategory, error) {
+	category := models.TaxCategory{Code: categoryData.Code, Name: categoryData.Name}
+	if err := db.Create(&category).Error; err != nil {
+		return category, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Error creating tax category: %s", err),
+		}
+	}
+	return category, nil
+}
+
+func CreateTaxRate(db *gorm.DB, rateData schemas.TaxRateSchema) (models.TaxRate, error) {
+	rate := models.TaxRate{}
+	if err := applyTaxRateData(db, &rate, rateData); err != nil {
+		return rate, err
+	}
+	if err := db.Create(&rate).Error; err != nil {
+		return rate, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error creating tax rate: %s", err),
+		}
+	}
+	return rate, nil
+}
+
+func UpdateTaxRate(db *gorm.DB, rateID uint, rateData schemas.TaxRateSchema) (models.TaxRate, error) {
+	var rate models.TaxRate
+	if err := db.First(&rate, rateID).Error; err != nil {
+		return rate, &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Tax rate %d not found", rateID),
+		}
+	}
+	if err := applyTaxRateData(db, &rate, rateData); err != nil {
+		return rate, err
+	}
+	// past orders keep the tax they were charged, they store their own breakdown
+	if err := db.Save(&rate).Error; err != nil {
+		return rate, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error updating tax rate: %s", err),
+		}
+	}
+	return rate, nil
+}
+
+func DeleteTaxRate(db *gorm.DB, rateID uint) error {
+	result := db.Delete(&models.TaxRate{}, rateID)
+	if result.Error != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error deleting tax rate: %s", result.Error),
+		}
+	}
+	if result.RowsAffected == 0 {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Tax rate %d not found", rateID),
+		}
+	}
+	return nil
+}
+
+func applyTaxRateData(db *gorm.DB, rate *models.TaxRate, rateData schemas.TaxRateSchema) error {
+	var category models.TaxCategory
+	if err := db.First(&category, rateData.TaxCategoryID).Error; err != nil {
+		return &core.HTTPError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("Tax category %d not found", rateData.TaxCategoryID),
+		}
+	}
+	if rateData.BranchID == nil && rateData.Region == "" {
+		return &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "A tax rate needs a branch_id or a region",
+		}
+	}
+	if rateData.BranchID != nil {
+		if _, err := GetBranchByID(db, *rateData.BranchID); err != nil {
+			return err
+		}
+	}
+	rate.Name = rateData.Name
+	rate.Rate = rateData.Rate
+	rate.Region = rateData.Region
+	rate.BranchID = rateData.BranchID
+	rate.TaxCategoryID = rateData.TaxCategoryID
+	return nil
+}
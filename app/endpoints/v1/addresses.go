@@ -0,0 +1,215 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListAddresses
+// @Summary List saved addresses
+// @Description Retrieves the address book of the authenticated user, default address first
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.AddressResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/list [get]
+func ListAddresses(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListUserAddresses(db, user, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(address models.Address) schemas.AddressResponseSchema {
+		return address.ToResponse()
+	}))
+}
+
+// GetAddress
+// @Summary Get a saved address
+// @Description Retrieves an address of the authenticated user's address book
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} schemas.AddressResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/get/{id} [get]
+func GetAddress(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	id, ok := parseAddressID(c)
+	if !ok {
+		return
+	}
+	address, err := crud.GetUserAddress(db, user, id)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"address": address.ToResponse()})
+}
+
+// CreateAddress
+// @Summary Save a new address
+// @Description Adds an address to the authenticated user's address book
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param request body schemas.AddressSchema true "Address details"
+// @Success 201 {object} schemas.AddressResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/create [post]
+func CreateAddress(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var request schemas.AddressSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	address, err := crud.CreateUserAddress(db, user, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"address": address.ToResponse()})
+}
+
+// UpdateAddress
+// @Summary Update a saved address
+// @Description Updates an address of the authenticated user's address book, past orders are not affected
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "Address ID"
+// @Param request body schemas.AddressSchema true "Address details"
+// @Success 200 {object} schemas.AddressResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/update/{id} [put]
+func UpdateAddress(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	id, ok := parseAddressID(c)
+	if !ok {
+		return
+	}
+	var request schemas.AddressSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	address, err := crud.UpdateUserAddress(db, user, id, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"address": address.ToResponse()})
+}
+
+// SetDefaultAddress
+// @Summary Set the default address
+// @Description Marks an address as the authenticated user's default address
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/set-default/{id} [post]
+func SetDefaultAddress(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	id, ok := parseAddressID(c)
+	if !ok {
+		return
+	}
+	if err := crud.SetDefaultUserAddress(db, user, id); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Default address updated successfully"})
+}
+
+// DeleteAddress
+// @Summary Delete a saved address
+// @Description Removes an address from the authenticated user's address book
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "Address ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /addresses/delete/{id} [delete]
+func DeleteAddress(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	id, ok := parseAddressID(c)
+	if !ok {
+		return
+	}
+	if err := crud.DeleteUserAddress(db, user, id); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted successfully"})
+}
+
+func parseAddressID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid address ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func AddressesRouter(router *gin.Engine) {
+	protected := router.Group("/api/v1/addresses")
+	protected.Use(middlewares.AuthMiddleware())
+	{
+		protected.GET("/list", ListAddresses)
+		protected.GET("/get/:id", GetAddress)
+		protected.POST("/create", CreateAddress)
+		protected.PUT("/update/:id", UpdateAddress)
+		protected.POST("/set-default/:id", SetDefaultAddress)
+		protected.DELETE("/delete/:id", DeleteAddress)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"ecommerce/app/crud"
 	"ecommerce/app/models"
 	"ecommerce/app/schemas"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"net/http"
+	"path/filepath"
+	"strconv"
 )
 
 // Login
@@ -260,7 +263,7 @@ func ResetPassword(c *gin.Context) {
 
 // UpdateUser
 // @Summary Update user details
-// @Description Allows an authenticated user to update their profile details
+// @Description Allows an authenticated user to update their profile details, a new email has to be confirmed first
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -280,14 +283,286 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	if err := crud.UpdateUserInfo(DB, user.ID, request.FirstName, request.LastName, request.Email, request.PhoneNumber); err != nil {
+	// the email is only changed once the new address is confirmed
+	emailChanged := request.Email != nil && *request.Email != user.Email
+	if err := crud.UpdateUserProfile(DB, user, request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if emailChanged {
+		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully! Please confirm your new email address."})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully!"})
 
 }
 
+// ConfirmEmailChange
+// @Summary Confirm email change
+// @Description Applies a pending email change using the token sent to the new address
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token path string true "Email change token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/confirm-email-change/{token} [get]
+func ConfirmEmailChange(c *gin.Context) {
+	var DB = core.GetDB()
+
+	token, err := uuid.Parse(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := crud.ConfirmEmailChange(DB, token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed successfully"})
+}
+
+// RequestPhoneCode
+// @Summary Send phone verification code
+// @Description Sends a one-time code by SMS to the authenticated user's phone number
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/phone/request-code [post]
+func RequestPhoneCode(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	if err := crud.RequestPhoneVerification(DB, user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent successfully!"})
+}
+
+// VerifyPhone
+// @Summary Verify phone number
+// @Description Verifies the authenticated user's phone number with the code received by SMS
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body schemas.VerifyPhoneSchema true "Verification code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/phone/verify [post]
+func VerifyPhone(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var request schemas.VerifyPhoneSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	if err := crud.VerifyPhoneNumber(DB, user, request.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number verified successfully"})
+}
+
+// OIDCLogin
+// @Summary Start social login
+// @Description Starts an OpenID Connect authorization code flow (PKCE) with the given provider and returns the authorization URL
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name (e.g. google, apple)"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/oidc/{provider}/login [get]
+func OIDCLogin(c *gin.Context) {
+	var DB = core.GetDB()
+
+	authorizationURL, err := crud.StartOIDCLogin(DB, c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authorizationURL})
+}
+
+// OIDCCallback
+// @Summary Complete social login
+// @Description Handles the provider redirect, verifies the ID token and returns our own tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name (e.g. google, apple)"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State returned by the provider"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/oidc/{provider}/callback [get]
+func OIDCCallback(c *gin.Context) {
+	var DB = core.GetDB()
+
+	// providers using response_mode=form_post (e.g. Apple) send the params in the body
+	if errorCode := c.Request.FormValue("error"); errorCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errorCode})
+		return
+	}
+	code := c.Request.FormValue("code")
+	state := c.Request.FormValue("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	accessToken, refreshToken, err := crud.CompleteOIDCLogin(c.Request.Context(), DB, c.Param("provider"), state, code)
+	if err != nil {
+		var httpErr *core.HTTPError
+		if errors.As(err, &httpErr) {
+			core.CustomErrorResponse(c, httpErr)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accessToken": accessToken, "refreshToken": refreshToken})
+}
+
+// RequestDataExport
+// @Summary Request a data export
+// @Description Starts generating an archive with all the data we store about the authenticated user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body schemas.DataExportRequestSchema false "Archive format (json or zip)"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/me/export [post]
+func RequestDataExport(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var request schemas.DataExportRequestSchema
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			core.HandleValidationErrors(c, err)
+			return
+		}
+	}
+	export, err := crud.RequestDataExport(DB, user, request.Format)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"export": export})
+}
+
+// GetDataExport
+// @Summary Get data export status
+// @Description Returns the status of the latest data export of the authenticated user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/me/export [get]
+func GetDataExport(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	export, err := crud.GetLatestDataExport(DB, user)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+// DownloadDataExport
+// @Summary Download a data export
+// @Description Downloads a ready data export archive
+// @Tags auth
+// @Produce octet-stream
+// @Param id path int true "Export ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/me/export/{id}/download [get]
+func DownloadDataExport(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	export, err := crud.GetReadyDataExport(DB, user, uint(id))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.FileAttachment(export.FilePath, filepath.Base(export.FilePath))
+}
+
+// DeleteAccount
+// @Summary Delete account
+// @Description Schedules the anonymisation of the authenticated user's account after a grace period
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 202 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/me/delete [post]
+func DeleteAccount(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	deletionRequest, err := crud.RequestAccountDeletion(DB, user)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Account deletion scheduled",
+		"scheduled_at": deletionRequest.ScheduledAt,
+	})
+}
+
+// CancelDeleteAccount
+// @Summary Cancel account deletion
+// @Description Cancels a pending account deletion during the grace period
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/me/delete/cancel [post]
+func CancelDeleteAccount(c *gin.Context) {
+	var DB = core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	if err := crud.CancelAccountDeletion(DB, user); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
 func AuthRouter(router *gin.Engine) {
 	// Define the Router
 	public := router.Group("/api/v1/auth")
@@ -297,8 +572,12 @@ func AuthRouter(router *gin.Engine) {
 		public.POST("/refresh", Refresh)
 		public.POST("/logout", Logout)
 		public.GET("/verify/:token", VerifyEmail)
+		public.GET("/confirm-email-change/:token", ConfirmEmailChange)
 		public.POST("/reset-password", ResetPasswordRequest)
 		public.POST("/reset-password/:token", ResetPassword)
+		public.GET("/oidc/:provider/login", OIDCLogin)
+		public.GET("/oidc/:provider/callback", OIDCCallback)
+		public.POST("/oidc/:provider/callback", OIDCCallback)
 	}
 	protected := router.Group("/api/v1/auth")
 	protected.Use(middlewares.AuthMiddleware())
@@ -306,5 +585,12 @@ func AuthRouter(router *gin.Engine) {
 		protected.POST("/change-password", ChangePassword)
 		protected.POST("/resend-verify", ResendVerificationEmail)
 		protected.PATCH("/update-user", UpdateUser)
+		protected.POST("/phone/request-code", RequestPhoneCode)
+		protected.POST("/phone/verify", VerifyPhone)
+		protected.POST("/me/export", RequestDataExport)
+		protected.GET("/me/export", GetDataExport)
+		protected.GET("/me/export/:id/download", DownloadDataExport)
+		protected.POST("/me/delete", DeleteAccount)
+		protected.POST("/me/delete/cancel", CancelDeleteAccount)
 	}
 }
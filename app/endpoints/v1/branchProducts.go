@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListBranchProducts
+// @Summary List the branches of a shared product
+// @Description Retrieves the branch products of a shared product, with the price, stock and flags of each branch (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchProductResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/branches/{id} [get]
+func ListBranchProducts(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListBranchProducts(db, uint(id), pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(branchProduct models.BranchProduct) schemas.BranchProductResponseSchema {
+		return branchProduct.ToResponse()
+	}))
+}
+
+// SetBranchProduct
+// @Summary Sell a shared product in a branch
+// @Description Offers a shared product in a branch, or updates its branch price, stock and flags. A price left empty keeps the product price (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param request body schemas.BranchProductSchema true "Branch product"
+// @Success 200 {object} schemas.BranchProductResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/branches/{id} [put]
+func SetBranchProduct(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchProductSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	branchProduct, err := crud.SetBranchProduct(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch_product": branchProduct.ToResponse()})
+}
+
+// RemoveBranchProduct
+// @Summary Stop selling a shared product in a branch
+// @Description Removes the branch product of a shared product, past orders keep their items (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param branch_id path int true "Branch ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/branches/{id}/{branch_id} [delete]
+func RemoveBranchProduct(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	branchID, err := strconv.ParseUint(c.Param("branch_id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid branch id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.RemoveBranchProduct(db, uint(id), uint(branchID)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Branch product removed successfully"})
+}
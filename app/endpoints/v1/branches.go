@@ -2,7 +2,12 @@ package v1
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/geo"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -10,35 +15,107 @@ import (
 
 // ListBranches
 // @Summary List all branches
-// @Description Get a list of all branches
+// @Description Get a list of all active branches
 // @Tags branches
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]any
-// @Failure 500 {object} map[string]any
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
 // @Router /branches/list [get]
 func ListBranches(c *gin.Context) {
+	listBranches(c, true)
+}
+
+// ListAllBranches
+// @Summary List all branches including inactive ones
+// @Description Get a list of all branches, active or not (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/list-all [get]
+func ListAllBranches(c *gin.Context) {
+	listBranches(c, false)
+}
+
+func listBranches(c *gin.Context, activeOnly bool) {
 	db := core.GetDB()
 
-	branches, err := crud.ListBranches(db)
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListBranches(db, activeOnly, pageParams)
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"branches": branches})
+	c.JSON(http.StatusOK, pagination.Map(page, func(branch models.Branch) schemas.BranchResponseSchema {
+		return branch.ToResponse()
+	}))
+}
 
+// NearestBranches
+// @Summary Find the nearest branches
+// @Description Returns the active branches sorted by distance from a point, with the distance in km
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param latitude query number true "Latitude"
+// @Param longitude query number true "Longitude"
+// @Param radius_km query number false "Only return branches within this distance"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /branches/nearest [get]
+func NearestBranches(c *gin.Context) {
+	db := core.GetDB()
+
+	var query schemas.NearestBranchesQuerySchema
+	if err := c.ShouldBindQuery(&query); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	point := geo.Point{Lat: *query.Latitude, Lng: *query.Longitude}
+	page, err := crud.NearestBranches(db, point, query.RadiusKm, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // GetBranch
 // @Summary Get branch by ID
-// @Description Get details of a branch by its ID
+// @Description Get details of an active branch by its ID
 // @Tags branches
 // @Accept json
 // @Produce json
 // @Param id path int true "Branch ID"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} schemas.BranchResponseSchema
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
 // @Router /branches/get/{id} [get]
 func GetBranch(c *gin.Context) {
 	db := core.GetDB()
@@ -50,12 +127,318 @@ func GetBranch(c *gin.Context) {
 		})
 		return
 	}
-	branch, err := crud.GetBranchByID(db, uint(id))
+	branch, err := crud.GetActiveBranchWithHours(db, uint(id))
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"branch": branch})
+	c.JSON(http.StatusOK, gin.H{"branch": branch.ToResponse()})
+}
+
+// GetBranchSlots
+// @Summary Get the next available slots of a branch
+// @Description Returns the next pickup and delivery slots of a branch, taking opening hours, holidays, pauses and lead times into account
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param count query int false "Number of slots per order type (default 10, max 50)"
+// @Success 200 {object} schemas.BranchSlotsResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /branches/slots/{id} [get]
+func GetBranchSlots(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "10"))
+	if err != nil || count < 1 || count > 50 {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "count must be between 1 and 50",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	slots, err := crud.GetBranchSlots(db, uint(id), count)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"slots": slots})
+}
+
+// GetSlotAvailability
+// @Summary Get the slot availability of a branch day
+// @Description Lists every slot of a day of the branch calendar with its booked and remaining capacity
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param date query string true "Day of the branch calendar (YYYY-MM-DD)"
+// @Success 200 {object} schemas.SlotAvailabilityResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /branches/slots/{id}/availability [get]
+func GetSlotAvailability(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	availability, err := crud.GetSlotAvailability(db, uint(id), c.Query("date"))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"availability": availability})
+}
+
+// UpdateBranchHours
+// @Summary Update the opening hours of a branch
+// @Description Replaces the weekly opening hours, timezone, lead times, slot length and slot capacity of a branch (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BranchHoursSchema true "Opening hours"
+// @Success 200 {object} schemas.BranchResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/hours/{id} [put]
+func UpdateBranchHours(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchHoursSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	branch, err := crud.UpdateBranchHours(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch": branch.ToResponse()})
+}
+
+// CreateBranchHoliday
+// @Summary Add a holiday closure
+// @Description Closes a branch for a whole day of its calendar (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BranchHolidaySchema true "Holiday"
+// @Success 201 {object} schemas.BranchHolidayResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/holidays/{id}/create [post]
+func CreateBranchHoliday(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchHolidaySchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	holiday, err := crud.CreateBranchHoliday(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"holiday": holiday.ToResponse()})
+}
+
+// DeleteBranchHoliday
+// @Summary Remove a holiday closure
+// @Description Deletes a holiday closure of a branch (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Holiday ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/holidays/delete/{id} [delete]
+func DeleteBranchHoliday(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteBranchHoliday(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Holiday deleted successfully"})
+}
+
+// SetBranchPause
+// @Summary Pause or resume a branch
+// @Description Temporarily stops a branch from taking orders, optionally until a given time (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BranchPauseSchema true "Pause switch"
+// @Success 200 {object} schemas.BranchResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/pause/{id} [post]
+func SetBranchPause(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchPauseSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	branch, err := crud.SetBranchPause(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch": branch.ToResponse()})
+}
+
+// CreateBranch
+// @Summary Create a branch
+// @Description Creates a branch with its address, location and contact details (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param request body schemas.BranchSchema true "Branch details"
+// @Success 201 {object} schemas.BranchResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/create [post]
+func CreateBranch(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.BranchSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	branch, err := crud.CreateBranch(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"branch": branch.ToResponse()})
+}
+
+// UpdateBranch
+// @Summary Update a branch
+// @Description Updates the address, location, contact details and status of a branch (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BranchSchema true "Branch details"
+// @Success 200 {object} schemas.BranchResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/update/{id} [put]
+func UpdateBranch(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	branch, err := crud.UpdateBranch(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch": branch.ToResponse()})
+}
+
+// DeleteBranch
+// @Summary Delete a branch
+// @Description Deletes a branch, past orders keep referencing it (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/delete/{id} [delete]
+func DeleteBranch(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteBranch(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Branch deleted successfully"})
 }
 
 func BranchesRouter(router *gin.Engine) {
@@ -63,5 +446,20 @@ func BranchesRouter(router *gin.Engine) {
 	{
 		public.GET("/list", ListBranches)
 		public.GET("/get/:id", GetBranch)
+		public.GET("/slots/:id", GetBranchSlots)
+		public.GET("/slots/:id/availability", GetSlotAvailability)
+		public.GET("/nearest", NearestBranches)
+	}
+	admin := router.Group("/api/v1/branches")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.GET("/list-all", ListAllBranches)
+		admin.POST("/create", CreateBranch)
+		admin.PUT("/update/:id", UpdateBranch)
+		admin.DELETE("/delete/:id", DeleteBranch)
+		admin.PUT("/hours/:id", UpdateBranchHours)
+		admin.POST("/holidays/:id/create", CreateBranchHoliday)
+		admin.DELETE("/holidays/delete/:id", DeleteBranchHoliday)
+		admin.POST("/pause/:id", SetBranchPause)
 	}
 }
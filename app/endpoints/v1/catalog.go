@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"bytes"
+	"ecommerce/app/core"
+	"ecommerce/app/crud"
+	"ecommerce/app/schemas"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ImportCatalog
+// @Summary Import a branch catalog
+// @Description Creates or updates the products of a branch from a CSV or JSON catalog, matching them by SKU. Nothing is saved when a row has errors or for a dry run, the errors of every row are reported (admin only)
+// @Tags products
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Catalog (.csv or .json)"
+// @Param branch_id query int true "Branch ID"
+// @Param format query string false "File format, taken from the file extension when not set" Enums(csv, json)
+// @Param dry_run query bool false "Only check the catalog"
+// @Success 200 {object} schemas.CatalogImportResultSchema
+// @Failure 400 {object} schemas.CatalogImportResultSchema
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/catalog/import [post]
+func ImportCatalog(c *gin.Context) {
+	db := core.GetDB()
+
+	var query schemas.CatalogImportQuerySchema
+	if err := c.ShouldBindQuery(&query); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	fileHeader, ok := uploadedFile(c)
+	if !ok {
+		return
+	}
+	format, err := crud.CatalogFormat(query.Format, fileHeader.Filename)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    fmt.Sprintf("Error reading the catalog: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	defer file.Close()
+
+	rows, rowErrors, err := crud.ParseCatalog(file, format)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	result, err := crud.ImportCatalog(db, query.BranchID, rows, rowErrors, query.DryRun)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"result": result})
+}
+
+// ExportCatalog
+// @Summary Export a branch catalog
+// @Description Downloads the products of a branch as a CSV or JSON catalog, in the format read by the import. The export is refused while some products have no SKU, as the import matches the products by SKU (admin only)
+// @Tags products
+// @Produce text/csv,application/json
+// @Param branch_id query int true "Branch ID"
+// @Param format query string false "File format, csv by default" Enums(csv, json)
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/catalog/export [get]
+func ExportCatalog(c *gin.Context) {
+	db := core.GetDB()
+
+	var query schemas.CatalogExportQuerySchema
+	if err := c.ShouldBindQuery(&query); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	format := query.Format
+	if format == "" {
+		format = crud.CatalogCSV
+	}
+	products, err := crud.ExportCatalog(db, query.BranchID)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	var content bytes.Buffer
+	if err := crud.WriteCatalog(&content, format, products); err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    fmt.Sprintf("Error writing the catalog: %s", err),
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == crud.CatalogJSON {
+		contentType = "application/json"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog-branch-%d.%s"`, query.BranchID, format))
+	c.Data(http.StatusOK, contentType, content.Bytes())
+}
+
+// CopyCatalog
+// @Summary Copy a branch catalog to another branch
+// @Description Copies the products of a branch with their variations, options, addons and images to another branch, with adjusted or overridden prices. Copying again syncs the products copied before, they keep their stock. Nothing is saved when a product has errors or for a dry run (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param request body schemas.CatalogCopySchema true "Copy options"
+// @Success 200 {object} schemas.CatalogImportResultSchema
+// @Failure 400 {object} schemas.CatalogImportResultSchema
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/catalog/copy [post]
+func CopyCatalog(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.CatalogCopySchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	result, err := crud.CopyCatalog(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"result": result})
+}
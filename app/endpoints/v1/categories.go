@@ -2,7 +2,10 @@ package v1
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/crud"
+	"ecommerce/app/schemas"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -14,18 +17,26 @@ import (
 // @Tags categories
 // @Accept json
 // @Produce json
-// @Success 200 {array} map[string]interface{}
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Router /categories/list [get]
 func ListCategories(c *gin.Context) {
 	db := core.GetDB()
 
-	categories, err := crud.ListCategories(db)
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListCategories(db, pageParams)
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"categories": categories})
+	c.JSON(http.StatusOK, page)
 }
 
 // ListSubCategories
@@ -34,18 +45,26 @@ func ListCategories(c *gin.Context) {
 // @Tags categories
 // @Accept json
 // @Produce json
-// @Success 200 {array} map[string]interface{}
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Router /categories/list-subcategories [get]
 func ListSubCategories(c *gin.Context) {
 	db := core.GetDB()
 
-	subCategories, err := crud.ListSubCategories(db)
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListSubCategories(db, pageParams)
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"sub_categories": subCategories})
+	c.JSON(http.StatusOK, page)
 }
 
 // GetCategory
@@ -106,12 +125,196 @@ func GetSubCategory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"sub_category": category})
 }
 
+// GetCategoryTree
+// @Summary Get the category tree
+// @Description Retrieves the whole category tree in position order, every category counts the published products of its subtree
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Success 200 {array} schemas.CategoryTreeSchema
+// @Router /categories/tree [get]
+func GetCategoryTree(c *gin.Context) {
+	db := core.GetDB()
+	tree, err := crud.CategoryTree(db)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": tree})
+}
+
+// GetCategoryBySlug
+// @Summary Get category details by slug
+// @Description Retrieves a category and its children by its slug
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param slug path string true "Category slug"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /categories/by-slug/{slug} [get]
+func GetCategoryBySlug(c *gin.Context) {
+	db := core.GetDB()
+	category, err := crud.GetCategoryBySlug(db, c.Param("slug"))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	children := make([]schemas.CategoryResponseSchema, len(category.Children))
+	for i, child := range category.Children {
+		children[i] = child.ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"category": category.ToResponse(), "children": children})
+}
+
+// CreateCategory
+// @Summary Create a category
+// @Description Creates a category under its parent, or a root category without parent (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param request body schemas.CategorySchema true "Category"
+// @Success 201 {object} schemas.CategoryResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /categories/create [post]
+func CreateCategory(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.CategorySchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	category, err := crud.CreateCategory(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"category": category.ToResponse()})
+}
+
+// UpdateCategory
+// @Summary Update a category
+// @Description Updates a category, it can be moved under another parent but not under its own descendants (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param request body schemas.CategorySchema true "Category"
+// @Success 200 {object} schemas.CategoryResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /categories/update/{id} [put]
+func UpdateCategory(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.CategorySchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	category, err := crud.UpdateCategory(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"category": category.ToResponse()})
+}
+
+// DeleteCategory
+// @Summary Delete a category
+// @Description Deletes a category without subcategories that is not the main category of products (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /categories/delete/{id} [delete]
+func DeleteCategory(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteCategory(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// ReorderCategories
+// @Summary Reorder categories
+// @Description Moves categories under a parent (the root when parent_id is not set) in the given order, for drag and drop (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param request body schemas.CategoryReorderSchema true "Categories in their new order"
+// @Success 200 {array} schemas.CategoryResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /categories/reorder [put]
+func ReorderCategories(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.CategoryReorderSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	categories, err := crud.ReorderCategories(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	siblings := make([]schemas.CategoryResponseSchema, len(categories))
+	for i, category := range categories {
+		siblings[i] = category.ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": siblings})
+}
+
 func CategoriesRouter(router *gin.Engine) {
 	public := router.Group("/api/v1/categories")
 	{
 		public.GET("/list", ListCategories)
 		public.GET("/list-subcategories", ListSubCategories)
+		public.GET("/tree", GetCategoryTree)
 		public.GET("/get/:id", GetCategory)
+		public.GET("/by-slug/:slug", GetCategoryBySlug)
 		public.GET("/get-subcategory/:id", GetSubCategory)
 	}
+	admin := router.Group("/api/v1/categories")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.POST("/create", CreateCategory)
+		admin.PUT("/update/:id", UpdateCategory)
+		admin.DELETE("/delete/:id", DeleteCategory)
+		admin.PUT("/reorder", ReorderCategories)
+	}
 }
@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/realtime"
+	"ecommerce/app/models"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"strconv"
+	"time"
+)
+
+// how often a comment is sent on idle streams so proxies keep them open
+const eventsHeartbeat = 25 * time.Second
+
+// OrderEvents
+// @Summary Stream the order updates of the customer
+// @Description Server-Sent Events stream of the status changes of the authenticated user's orders. The token can be passed as access_token query parameter for EventSource clients.
+// @Tags events
+// @Produce text/event-stream
+// @Param order_id query int false "Only stream the events of this order"
+// @Param access_token query string false "Access token, when the Authorization header can not be set"
+// @Success 200 {object} realtime.Event
+// @Failure 401 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /events/orders [get]
+func OrderEvents(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	orderID, _ := strconv.ParseUint(c.Query("order_id"), 10, 64)
+
+	streamEvents(c, func(event realtime.Event) bool {
+		return event.UserID == user.ID && (orderID == 0 || event.OrderID == uint(orderID))
+	})
+}
+
+// BranchEvents
+// @Summary Stream the order events of a branch
+// @Description Server-Sent Events stream of the new orders and status changes of a branch, for its staff. The token can be passed as access_token query parameter for EventSource clients.
+// @Tags events
+// @Produce text/event-stream
+// @Param id path int true "Branch ID"
+// @Param access_token query string false "Access token, when the Authorization header can not be set"
+// @Success 200 {object} realtime.Event
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /events/branches/{id} [get]
+func BranchEvents(c *gin.Context) {
+	branchID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	streamEvents(c, func(event realtime.Event) bool {
+		return event.BranchID == uint(branchID)
+	})
+}
+
+func streamEvents(c *gin.Context, filter func(realtime.Event) bool) {
+	events, cancel := realtime.Subscribe(filter)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// disables response buffering in nginx
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func EventsRouter(router *gin.Engine) {
+	protected := router.Group("/api/v1/events")
+	protected.Use(middlewares.QueryTokenMiddleware(), middlewares.AuthMiddleware())
+	{
+		protected.GET("/orders", OrderEvents)
+	}
+	staff := router.Group("/api/v1/events/branches")
+	staff.Use(middlewares.QueryTokenMiddleware(), middlewares.AuthMiddleware(), middlewares.BranchStaffMiddleware())
+	{
+		staff.GET("/:id", BranchEvents)
+	}
+}
@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/storage"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UploadMedia
+// @Summary Upload an image
+// @Description Uploads a JPEG, PNG or GIF image and makes its thumbnails, the type is detected from the content (admin only)
+// @Tags media
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Image"
+// @Success 201 {object} schemas.MediaResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /media/upload [post]
+func UploadMedia(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	fileHeader, ok := uploadedFile(c)
+	if !ok {
+		return
+	}
+	media, err := crud.UploadMedia(c.Request.Context(), db, user, fileHeader)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"media": media.ToResponse()})
+}
+
+// DeleteMedia
+// @Summary Delete an uploaded image
+// @Description Deletes an uploaded image and its thumbnails, unless a product still shows it (admin only)
+// @Tags media
+// @Produce json
+// @Param id path int true "Media file ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /media/delete/{id} [delete]
+func DeleteMedia(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteMedia(c.Request.Context(), db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Media file deleted successfully"})
+}
+
+// ServeMedia
+// @Summary Download a stored file
+// @Description Serves a stored file, the URLs are signed and expire unless the media is public
+// @Tags media
+// @Produce image/jpeg,image/png
+// @Param key path string true "Blob key"
+// @Param expires query int false "Expiry of the signed URL (unix time)"
+// @Param signature query string false "Signature of the URL"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /media/files/{key} [get]
+func ServeMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !storage.IsPublic() && !storage.VerifySignature(key, c.Query("expires"), c.Query("signature")) {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid or expired media URL",
+			StatusCode: http.StatusForbidden,
+		})
+		return
+	}
+	content, contentType, err := storage.Open(c.Request.Context(), key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    fmt.Sprintf("Error reading media: %s", err),
+			StatusCode: status,
+		})
+		return
+	}
+	defer content.Close()
+
+	// the keys are never reused, so the files can be cached for as long as their URL is valid
+	cacheControl := "private, max-age=3600"
+	if storage.IsPublic() {
+		cacheControl = "public, max-age=31536000, immutable"
+	}
+	c.DataFromReader(http.StatusOK, -1, contentType, content, map[string]string{
+		"Cache-Control":          cacheControl,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// uploadedFile reads the file form field, the request body is capped a little above the upload limit
+func uploadedFile(c *gin.Context) (*multipart.FileHeader, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, crud.MaxUploadBytes()+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			core.CustomErrorResponse(c, &core.HTTPError{
+				Message:    fmt.Sprintf("The file is larger than %dMB", crud.MaxUploadBytes()>>20),
+				StatusCode: http.StatusRequestEntityTooLarge,
+			})
+			return nil, false
+		}
+		core.CustomErrorResponse(c, &core.ValidationError{Field: "file", Message: "This field is required"})
+		return nil, false
+	}
+	return fileHeader, true
+}
+
+func MediaRouter(router *gin.Engine) {
+	public := router.Group("/api/v1/media")
+	{
+		public.GET("/files/*key", ServeMedia)
+	}
+	admin := router.Group("/api/v1/media")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.POST("/upload", UploadMedia)
+		admin.DELETE("/delete/:id", DeleteMedia)
+	}
+}
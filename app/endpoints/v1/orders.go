@@ -3,9 +3,11 @@ package v1
 import (
 	"ecommerce/app/core"
 	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/crud/orders"
 	"ecommerce/app/models"
 	"ecommerce/app/schemas"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -34,12 +36,20 @@ func CreateOrder(c *gin.Context) {
 	}
 
 	tx := db.Begin()
-	if err := orders.CreateOrder(tx, user, request); err != nil {
+	order, err := orders.CreateOrder(tx, user, request)
+	if err != nil {
 		core.CustomErrorResponse(c, err)
 		tx.Rollback()
 		return
 	}
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error creating order: %s", err),
+		})
+		return
+	}
+	orders.PublishOrderCreated(db, order)
 	c.JSON(http.StatusCreated, gin.H{"message": "Order created successfully"})
 }
 
@@ -49,7 +59,10 @@ func CreateOrder(c *gin.Context) {
 // @Tags orders
 // @Accept json
 // @Produce json
-// @Success 200 {object} []schemas.OrderResponseSchema
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.OrderResponseSchema]
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Security BearerAuth
@@ -57,19 +70,19 @@ func CreateOrder(c *gin.Context) {
 func ListOrders(c *gin.Context) {
 	db := core.GetDB()
 	user := c.MustGet("user").(models.User)
-	userOrders, err := orders.ListUserOrders(db, user)
-
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := orders.ListUserOrders(db, user, pageParams)
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
-	userOrdersResponse := make([]schemas.OrderResponseSchema, len(userOrders))
-
-	for i, order := range userOrders {
-		userOrdersResponse[i] = order.ToResponse()
-	}
-
-	c.JSON(http.StatusOK, gin.H{"orders": userOrdersResponse})
+	c.JSON(http.StatusOK, pagination.Map(page, func(order models.Order) schemas.OrderResponseSchema {
+		return order.ToResponse()
+	}))
 }
 
 // GetOrder
@@ -108,38 +121,320 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"order": order.ToResponse()})
 }
 
-// UpdateOrder
-// @Summary Update an order status
-// @Description Updates an order status by its ID
+// CancelOrder
+// @Summary Cancel an order
+// @Description Cancels an order of the authenticated user while the branch cancellation policy allows it, a confirmed payment is refunded
 // @Tags orders
 // @Accept json
 // @Produce json
-// @Param request body schemas.UpdateOrderStatusSchema true "Order creation details"
-// @Success 200 {object} map[string]interface{}
+// @Param id path int true "Order ID"
+// @Param request body schemas.CancelOrderSchema false "Cancellation reason"
+// @Success 200 {object} schemas.OrderResponseSchema
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Security BearerAuth
-// @Router /orders/update-status [put]
-func UpdateOrder(c *gin.Context) {
+// @Router /orders/{id}/cancel [post]
+func CancelOrder(c *gin.Context) {
 	db := core.GetDB()
 	user := c.MustGet("user").(models.User)
 
-	type requestSchema struct {
-		OrderID uint   `json:"order_id" binding:"required"`
-		Status  string `json:"status" binding:"required"`
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid order ID",
+		})
+		return
+	}
+	var request schemas.CancelOrderSchema
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			core.HandleValidationErrors(c, err)
+			return
+		}
+	}
+
+	if err := orders.CancelOrder(db, user, uint(orderID), request.Reason); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
 	}
-	var request requestSchema
+	order, err := orders.GetOrderByID(db, user, uint(orderID))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order": order.ToResponse()})
+}
 
+// ConfirmOrderPayment
+// @Summary Confirm the payment of an order
+// @Description Checks with the payment gateway that the payment intent of the order went through and marks the order paid
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} schemas.OrderResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 402 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/payment/confirm [post]
+func ConfirmOrderPayment(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid order ID",
+		})
+		return
+	}
+
+	if err := orders.ConfirmOrderPayment(db, user, uint(orderID)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	order, err := orders.GetOrderByID(db, user, uint(orderID))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order": order.ToResponse()})
+}
+
+// PreviewReorder
+// @Summary Preview ordering a past order again
+// @Description Rebuilds the creation data of a past order and lists the items that can not be ordered anymore
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} schemas.ReorderResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/reorder [get]
+func PreviewReorder(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid order ID",
+		})
+		return
+	}
+	reorder, err := orders.BuildReorder(db, user, uint(orderID))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, reorder)
+}
+
+// Reorder
+// @Summary Order a past order again
+// @Description Places a new order with the items of a past order, prices and availability are checked again
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param request body schemas.PlaceAgainSchema true "Order details"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/{id}/reorder [post]
+func Reorder(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid order ID",
+		})
+		return
+	}
+	var request schemas.PlaceAgainSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	reorder, err := orders.BuildReorder(db, user, uint(orderID))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	placeAgain(c, user, reorder, request)
+}
+
+// ListFavouriteOrders
+// @Summary List favourite orders
+// @Description Retrieves the favourite orders saved by the authenticated user
+// @Tags orders
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.FavouriteOrderResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/favourites/list [get]
+func ListFavouriteOrders(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := orders.ListFavouriteOrders(db, user, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(favourite models.FavouriteOrder) schemas.FavouriteOrderResponseSchema {
+		return favourite.ToResponse()
+	}))
+}
+
+// CreateFavouriteOrder
+// @Summary Save a favourite order
+// @Description Saves a named favourite order from a list of items or from a past order
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param request body schemas.FavouriteOrderSchema true "Favourite order"
+// @Success 201 {object} schemas.FavouriteOrderResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/favourites/create [post]
+func CreateFavouriteOrder(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var request schemas.FavouriteOrderSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	favourite, err := orders.CreateFavouriteOrder(db, user, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"favourite": favourite.ToResponse()})
+}
+
+// DeleteFavouriteOrder
+// @Summary Delete a favourite order
+// @Description Deletes a favourite order of the authenticated user
+// @Tags orders
+// @Produce json
+// @Param id path int true "Favourite order ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/favourites/delete/{id} [delete]
+func DeleteFavouriteOrder(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	favouriteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid favourite order ID",
+		})
+		return
+	}
+	if err := orders.DeleteFavouriteOrder(db, user, uint(favouriteID)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Favourite order deleted successfully"})
+}
+
+// PlaceFavouriteOrder
+// @Summary Place a favourite order
+// @Description Places a new order with the items of a favourite order, prices and availability are checked again
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Favourite order ID"
+// @Param request body schemas.PlaceAgainSchema true "Order details"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /orders/favourites/{id}/place [post]
+func PlaceFavouriteOrder(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	favouriteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid favourite order ID",
+		})
+		return
+	}
+	var request schemas.PlaceAgainSchema
 	if err := c.ShouldBindJSON(&request); err != nil {
 		core.HandleValidationErrors(c, err)
 		return
 	}
+	reorder, err := orders.BuildFavouriteOrder(db, user, uint(favouriteID))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	placeAgain(c, user, reorder, request)
+}
+
+// placeAgain creates the order of a reorder, the unavailable items are reported with the response
+func placeAgain(c *gin.Context, user models.User, reorder schemas.ReorderResponseSchema, request schemas.PlaceAgainSchema) {
+	if len(reorder.UnavailableItems) > 0 && !request.SkipUnavailable {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":             "Some items are no longer available",
+			"unavailable_items": reorder.UnavailableItems,
+		})
+		return
+	}
 
-	if err := orders.UpdateOrderStatus(db, user, request.OrderID, request.Status); err != nil {
+	db := core.GetDB()
+	tx := db.Begin()
+	order, err := orders.PlaceAgain(tx, user, reorder, request)
+	if err != nil {
 		core.CustomErrorResponse(c, err)
+		tx.Rollback()
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("Error creating order: %s", err),
+		})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order updated successfully"})
+	orders.PublishOrderCreated(db, order)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "Order created successfully",
+		"unavailable_items": reorder.UnavailableItems,
+	})
 }
 
 func OrdersRouter(router *gin.Engine) {
@@ -149,6 +444,13 @@ func OrdersRouter(router *gin.Engine) {
 		protected.POST("/create", CreateOrder)
 		protected.GET("/list", ListOrders)
 		protected.GET("/get/:id", GetOrder)
-		protected.PUT("/update-status", UpdateOrder)
+		protected.POST("/:id/cancel", CancelOrder)
+		protected.POST("/:id/payment/confirm", ConfirmOrderPayment)
+		protected.GET("/:id/reorder", PreviewReorder)
+		protected.POST("/:id/reorder", Reorder)
+		protected.GET("/favourites/list", ListFavouriteOrders)
+		protected.POST("/favourites/create", CreateFavouriteOrder)
+		protected.DELETE("/favourites/delete/:id", DeleteFavouriteOrder)
+		protected.POST("/favourites/:id/place", PlaceFavouriteOrder)
 	}
 }
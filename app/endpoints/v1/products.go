@@ -2,7 +2,11 @@ package v1
 
 import (
 	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
 	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -10,65 +14,60 @@ import (
 
 // ListProducts
 // @Summary List products
-// @Description Retrieves a list of products with optional filtering and pagination
+// @Description Retrieves a list of products with optional filtering and pagination, and the facet counts of the filtered list
 // @Tags products
 // @Accept json
 // @Produce json
-// @Param limit query int false "Number of results to return" default(10)
-// @Param offset query int false "Number of results to skip" default(0)
-// @Param category_id query int false "Filter by category ID"
-// @Param subcategory_id query int false "Filter by subcategory ID"
-// @Param branch_id query int false "Filter by branch ID"
-// @Param min_price query float64 false "Filter by minimum price"
-// @Param max_price query float64 false "Filter by maximum price"
-// @Param search query string false "Search products by name or description"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Param category_id query []int false "Filter by category IDs" collectionFormat(multi)
+// @Param subcategory_id query []int false "Filter by subcategory IDs" collectionFormat(multi)
+// @Param branch_id query []int false "Filter by branch IDs, with a single branch the shared products have the branch price and stock" collectionFormat(multi)
+// @Param tag query []string false "Filter by tags" collectionFormat(multi)
+// @Param min_price query number false "Filter by minimum price"
+// @Param max_price query number false "Filter by maximum price"
+// @Param search query string false "Search products by title, tags or description"
 // @Param in_stock query bool false "Filter by in-stock products"
-// @Param sort_by query string false "Sort by field (e.g., price, name)"
-// @Param sort_order query string false "Sort order (asc or desc)" default(asc)
-// @Success 200 {array} schemas.ProductResponseSchema
+// @Param on_sale query bool false "Filter by discounted products"
+// @Param min_rating query number false "Filter by minimum average rating"
+// @Param sort_by query string false "Comma separated sort keys with an optional :asc or :desc (e.g., best_selling,price:asc), keys: price, title, newest, best_selling, rating, discount, relevance"
+// @Param sort_order query string false "Direction of the sort keys that don't give one (asc or desc)"
+// @Success 200 {object} schemas.ProductListResponseSchema
 // @Failure 400 {object} map[string]interface{}
 // @Router /products/list [get]
 func ListProducts(c *gin.Context) {
 	db := core.GetDB()
 
-	limit, _ := strconv.Atoi(c.Query("limit"))
-	offset, _ := strconv.Atoi(c.Query("offset"))
-
-	filters := make(map[string]interface{})
-
-	// Parse and add filters
-	if categoryID, err := strconv.ParseUint(c.Query("category_id"), 10, 32); err == nil {
-		filters["category_id"] = uint(categoryID)
-	}
-	if subcategoryID, err := strconv.ParseUint(c.Query("subcategory_id"), 10, 32); err == nil {
-		filters["subcategory_id"] = uint(subcategoryID)
-	}
-	if branchID, err := strconv.ParseUint(c.Query("branch_id"), 10, 32); err == nil {
-		filters["branch_id"] = uint(branchID)
-	}
-	if minPrice, err := strconv.ParseFloat(c.Query("min_price"), 64); err == nil {
-		filters["min_price"] = minPrice
-	}
-	if maxPrice, err := strconv.ParseFloat(c.Query("max_price"), 64); err == nil {
-		filters["max_price"] = maxPrice
-	}
-	if search := c.Query("search"); search != "" {
-		filters["search"] = search
+	var params schemas.ProductListQuerySchema
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&params); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
 	}
-	if inStock, err := strconv.ParseBool(c.Query("in_stock")); err == nil {
-		filters["in_stock"] = inStock
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
 	}
-	if sortBy := c.Query("sort_by"); sortBy != "" {
-		filters["sort_by"] = sortBy
-		filters["sort_order"] = c.Query("sort_order") // Default to ASC if not provided
+	page, err := crud.ListProducts(db, params, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
 	}
-	products, err := crud.ListProducts(db, limit, offset, filters)
+	facets, err := crud.ProductFacets(db, params)
 	if err != nil {
 		core.CustomErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"products": products})
+	products := pagination.Map(page, func(p models.Product) schemas.ProductResponseSchema { return p.ToResponse() })
+	c.JSON(http.StatusOK, schemas.ProductListResponseSchema{
+		Data:       products.Data,
+		NextCursor: products.NextCursor,
+		HasMore:    products.HasMore,
+		Total:      products.Total,
+		Facets:     facets,
+	})
 }
 
 // GetProduct
@@ -101,10 +100,252 @@ func GetProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"product": product})
 }
 
+// SearchProducts
+// @Summary Search products
+// @Description Full-text product search ranked by relevance, tolerant to typos, with highlighted snippets
+// @Tags products
+// @Produce json
+// @Param q query string true "Search text"
+// @Param branch_id query int false "Filter by branch ID"
+// @Param category_id query int false "Filter by category ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Success 200 {object} pagination.Page[schemas.ProductSearchResultSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Router /products/search [get]
+func SearchProducts(c *gin.Context) {
+	db := core.GetDB()
+
+	var params schemas.ProductSearchQuerySchema
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&params); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.SearchProducts(db, params, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// AutocompleteProducts
+// @Summary Autocomplete a product search
+// @Description Suggests product titles for a partial search text
+// @Tags products
+// @Produce json
+// @Param q query string true "Partial search text"
+// @Param branch_id query int false "Filter by branch ID"
+// @Param limit query int false "Number of suggestions" default(10)
+// @Success 200 {array} string
+// @Failure 400 {object} map[string]interface{}
+// @Router /products/autocomplete [get]
+func AutocompleteProducts(c *gin.Context) {
+	db := core.GetDB()
+
+	var params schemas.AutocompleteQuerySchema
+	if err := c.ShouldBindQuery(&params); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	suggestions, err := crud.AutocompleteProducts(db, params)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// GetProductBySlug
+// @Summary Get product details by slug
+// @Description Retrieves the details of a published product by its SEO slug
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param slug path string true "Product slug"
+// @Success 200 {object} schemas.ProductResponseSchema
+// @Failure 404 {object} map[string]interface{}
+// @Router /products/by-slug/{slug} [get]
+func GetProductBySlug(c *gin.Context) {
+	db := core.GetDB()
+	product, err := crud.GetProductBySlug(db, c.Param("slug"))
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"product": product})
+}
+
+// CreateProduct
+// @Summary Create a product
+// @Description Creates a product, the slug is made from the title when not given (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param request body schemas.ProductSchema true "Product"
+// @Success 201 {object} schemas.ProductResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/create [post]
+func CreateProduct(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.ProductSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	product, err := crud.CreateProduct(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"product": product.ToResponse()})
+}
+
+// UpdateProduct
+// @Summary Update a product
+// @Description Updates a product and replaces its images and addons (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param request body schemas.ProductSchema true "Product"
+// @Success 200 {object} schemas.ProductResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/update/{id} [put]
+func UpdateProduct(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.ProductSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	product, err := crud.UpdateProduct(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"product": product.ToResponse()})
+}
+
+// DeleteProduct
+// @Summary Delete a product
+// @Description Deletes a product, past orders keep their items (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/delete/{id} [delete]
+func DeleteProduct(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteProduct(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+}
+
+// UploadProductImage
+// @Summary Upload a product image
+// @Description Uploads a JPEG, PNG or GIF image with its thumbnails and adds it after the product images (admin only)
+// @Tags products
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param file formData file true "Image"
+// @Param alt_text formData string false "Alternative text"
+// @Success 201 {object} schemas.ProductImageResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /products/images/{id}/upload [post]
+func UploadProductImage(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	fileHeader, ok := uploadedFile(c)
+	if !ok {
+		return
+	}
+	altText := c.PostForm("alt_text")
+	if len(altText) > 255 {
+		core.CustomErrorResponse(c, &core.ValidationError{Field: "alt_text", Message: "This field must be at most 255 characters long"})
+		return
+	}
+	image, err := crud.AddProductImage(c.Request.Context(), db, user, uint(id), fileHeader, altText)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"image": image.ToResponse()})
+}
+
 func ProductsRouter(router *gin.Engine) {
 	public := router.Group("/api/v1/products")
 	{
 		public.GET("/list", ListProducts)
 		public.GET("/get/:id", GetProduct)
+		public.GET("/by-slug/:slug", GetProductBySlug)
+		public.GET("/search", SearchProducts)
+		public.GET("/autocomplete", AutocompleteProducts)
+	}
+	admin := router.Group("/api/v1/products")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.POST("/create", CreateProduct)
+		admin.PUT("/update/:id", UpdateProduct)
+		admin.DELETE("/delete/:id", DeleteProduct)
+		admin.POST("/images/:id/upload", UploadProductImage)
+		admin.POST("/catalog/import", ImportCatalog)
+		admin.GET("/catalog/export", ExportCatalog)
+		admin.POST("/catalog/copy", CopyCatalog)
+		admin.GET("/branches/:id", ListBranchProducts)
+		admin.PUT("/branches/:id", SetBranchProduct)
+		admin.DELETE("/branches/:id/:branch_id", RemoveBranchProduct)
 	}
 }
@@ -0,0 +1,194 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// QuoteShipping
+// @Summary Get a shipping quote
+// @Description Returns the delivery zone and shipping fee of a basket for a branch and an address
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param request body schemas.ShippingQuoteSchema true "Quote request"
+// @Success 200 {object} schemas.ShippingQuoteResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /shipping/quote [post]
+func QuoteShipping(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var request schemas.ShippingQuoteSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	quote, err := crud.QuoteShippingRequest(db, user, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+// ListDeliveryZones
+// @Summary List delivery zones of a branch
+// @Description Retrieves the delivery zones and rate tables of a branch
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param branch_id path int true "Branch ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.DeliveryZoneResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Router /shipping/zones/{branch_id} [get]
+func ListDeliveryZones(c *gin.Context) {
+	db := core.GetDB()
+	branchID, err := strconv.ParseUint(c.Param("branch_id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid branch ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListBranchDeliveryZones(db, uint(branchID), pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(zone models.DeliveryZone) schemas.DeliveryZoneResponseSchema {
+		return zone.ToResponse()
+	}))
+}
+
+// CreateDeliveryZone
+// @Summary Create a delivery zone
+// @Description Creates a delivery zone with its rate table for a branch (admin only)
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param request body schemas.DeliveryZoneSchema true "Delivery zone"
+// @Success 201 {object} schemas.DeliveryZoneResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /shipping/zones/create [post]
+func CreateDeliveryZone(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.DeliveryZoneSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	zone, err := crud.CreateDeliveryZone(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"zone": zone.ToResponse()})
+}
+
+// UpdateDeliveryZone
+// @Summary Update a delivery zone
+// @Description Updates a delivery zone and replaces its rate table (admin only)
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery zone ID"
+// @Param request body schemas.DeliveryZoneSchema true "Delivery zone"
+// @Success 200 {object} schemas.DeliveryZoneResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /shipping/zones/update/{id} [put]
+func UpdateDeliveryZone(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.DeliveryZoneSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	zone, err := crud.UpdateDeliveryZone(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"zone": zone.ToResponse()})
+}
+
+// DeleteDeliveryZone
+// @Summary Delete a delivery zone
+// @Description Deletes a delivery zone and its rate table (admin only)
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery zone ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /shipping/zones/delete/{id} [delete]
+func DeleteDeliveryZone(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteDeliveryZone(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery zone deleted successfully"})
+}
+
+func ShippingRouter(router *gin.Engine) {
+	public := router.Group("/api/v1/shipping")
+	{
+		public.GET("/zones/:branch_id", ListDeliveryZones)
+	}
+	protected := router.Group("/api/v1/shipping")
+	protected.Use(middlewares.AuthMiddleware())
+	{
+		protected.POST("/quote", QuoteShipping)
+	}
+	admin := router.Group("/api/v1/shipping/zones")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.POST("/create", CreateDeliveryZone)
+		admin.PUT("/update/:id", UpdateDeliveryZone)
+		admin.DELETE("/delete/:id", DeleteDeliveryZone)
+	}
+}
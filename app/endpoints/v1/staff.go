@@ -0,0 +1,265 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/crud"
+	"ecommerce/app/crud/orders"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListMyBranches
+// @Summary List the branches of the staff member
+// @Description Retrieves the branches the authenticated user works at
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/mine [get]
+func ListMyBranches(c *gin.Context) {
+	db := core.GetDB()
+	user := c.MustGet("user").(models.User)
+
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListUserBranches(db, user, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(branch models.Branch) schemas.BranchResponseSchema {
+		return branch.ToResponse()
+	}))
+}
+
+// ListBranchOrders
+// @Summary List the order queue of a branch
+// @Description Retrieves the orders of a branch with full item detail, for the branch staff
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param status query string false "Comma separated statuses, e.g. pending,paid"
+// @Param type query string false "Order type (pickup or shipping)"
+// @Param from query string false "Created at or after (RFC 3339)"
+// @Param to query string false "Created before (RFC 3339)"
+// @Param scheduled_from query string false "Scheduled at or after (RFC 3339)"
+// @Param scheduled_to query string false "Scheduled before (RFC 3339)"
+// @Param is_scheduled query bool false "Only scheduled or only immediate orders"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.QueueOrderResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/{id}/orders [get]
+func ListBranchOrders(c *gin.Context) {
+	db := core.GetDB()
+	branchID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var query schemas.BranchOrdersQuerySchema
+	if err := c.ShouldBindQuery(&query); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := orders.ListBranchOrders(db, uint(branchID), query, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(order models.Order) schemas.QueueOrderResponseSchema {
+		return order.ToQueueResponse()
+	}))
+}
+
+// UpdateBranchOrdersStatus
+// @Summary Change the status of several branch orders
+// @Description Moves orders of a branch to a status at once, nothing changes when one order can not make the transition. Only paid orders go to preparing, and orders only become paid through their payment
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BulkOrderStatusSchema true "Orders and status"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/{id}/orders/status [post]
+func UpdateBranchOrdersStatus(c *gin.Context) {
+	db := core.GetDB()
+	branchID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+	var request schemas.BulkOrderStatusSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	updatedOrders, err := orders.UpdateBranchOrdersStatus(db, c.MustGet("user").(models.User), uint(branchID), request.OrderIDs, request.Status)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	orderIDs := make([]uint, len(updatedOrders))
+	for i, order := range updatedOrders {
+		orderIDs[i] = order.ID
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Orders updated successfully", "order_ids": orderIDs, "status": request.Status})
+}
+
+// ListBranchStaff
+// @Summary List the staff of a branch
+// @Description Retrieves the members of a branch team (admin only)
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.BranchStaffResponseSchema]
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/{id}/staff/list [get]
+func ListBranchStaff(c *gin.Context) {
+	db := core.GetDB()
+	branchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid branch ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListBranchStaff(db, uint(branchID), pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(member models.BranchStaff) schemas.BranchStaffResponseSchema {
+		return member.ToResponse()
+	}))
+}
+
+// AddBranchStaff
+// @Summary Add a staff member to a branch
+// @Description Adds a user to a branch team or changes their role (admin only)
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param request body schemas.BranchStaffSchema true "Staff member"
+// @Success 200 {object} schemas.BranchStaffResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/{id}/staff/add [post]
+func AddBranchStaff(c *gin.Context) {
+	db := core.GetDB()
+	branchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid branch ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.BranchStaffSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	member, err := crud.AddBranchStaff(db, uint(branchID), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"staff": member.ToResponse()})
+}
+
+// RemoveBranchStaff
+// @Summary Remove a staff member from a branch
+// @Description Removes a user from a branch team (admin only)
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path int true "Branch ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /branches/{id}/staff/remove/{user_id} [delete]
+func RemoveBranchStaff(c *gin.Context) {
+	db := core.GetDB()
+	branchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid branch ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid user ID",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.RemoveBranchStaff(db, uint(branchID), uint(userID)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Staff member removed successfully"})
+}
+
+func BranchStaffRouter(router *gin.Engine) {
+	protected := router.Group("/api/v1/branches")
+	protected.Use(middlewares.AuthMiddleware())
+	{
+		protected.GET("/mine", ListMyBranches)
+	}
+	staff := router.Group("/api/v1/branches/:id/orders")
+	staff.Use(middlewares.AuthMiddleware(), middlewares.BranchStaffMiddleware())
+	{
+		staff.GET("", ListBranchOrders)
+		staff.POST("/status", UpdateBranchOrdersStatus)
+	}
+	admin := router.Group("/api/v1/branches/:id/staff")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.GET("/list", ListBranchStaff)
+		admin.POST("/add", AddBranchStaff)
+		admin.DELETE("/remove/:user_id", RemoveBranchStaff)
+	}
+}
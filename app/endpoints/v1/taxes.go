@@ -0,0 +1,181 @@
+package v1
+
+import (
+	"ecommerce/app/core"
+	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/pagination"
+	"ecommerce/app/crud"
+	"ecommerce/app/models"
+	"ecommerce/app/schemas"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListTaxCategories
+// @Summary List tax categories
+// @Description Retrieves the tax categories with their rates (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param with_total query bool false "Also count the whole list"
+// @Success 200 {object} pagination.Page[schemas.TaxCategoryResponseSchema]
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /taxes/categories/list [get]
+func ListTaxCategories(c *gin.Context) {
+	db := core.GetDB()
+
+	var pageParams pagination.Params
+	if err := c.ShouldBindQuery(&pageParams); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	page, err := crud.ListTaxCategories(db, pageParams)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pagination.Map(page, func(category models.TaxCategory) schemas.TaxCategoryResponseSchema {
+		return category.ToResponse()
+	}))
+}
+
+// CreateTaxCategory
+// @Summary Create a tax category
+// @Description Creates a tax category products and addons can be assigned to (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param request body schemas.TaxCategorySchema true "Tax category"
+// @Success 201 {object} schemas.TaxCategoryResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /taxes/categories/create [post]
+func CreateTaxCategory(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.TaxCategorySchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	category, err := crud.CreateTaxCategory(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"category": category.ToResponse()})
+}
+
+// CreateTaxRate
+// @Summary Create a tax rate
+// @Description Creates the rate of a tax category for a branch or a region (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param request body schemas.TaxRateSchema true "Tax rate"
+// @Success 201 {object} schemas.TaxRateResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /taxes/rates/create [post]
+func CreateTaxRate(c *gin.Context) {
+	db := core.GetDB()
+
+	var request schemas.TaxRateSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	rate, err := crud.CreateTaxRate(db, request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rate": rate.ToResponse()})
+}
+
+// UpdateTaxRate
+// @Summary Update a tax rate
+// @Description Updates a tax rate, orders already placed keep the tax they were charged (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param id path int true "Tax rate ID"
+// @Param request body schemas.TaxRateSchema true "Tax rate"
+// @Success 200 {object} schemas.TaxRateResponseSchema
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /taxes/rates/update/{id} [put]
+func UpdateTaxRate(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	var request schemas.TaxRateSchema
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleValidationErrors(c, err)
+		return
+	}
+	rate, err := crud.UpdateTaxRate(db, uint(id), request)
+	if err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rate": rate.ToResponse()})
+}
+
+// DeleteTaxRate
+// @Summary Delete a tax rate
+// @Description Deletes a tax rate (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param id path int true "Tax rate ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /taxes/rates/delete/{id} [delete]
+func DeleteTaxRate(c *gin.Context) {
+	db := core.GetDB()
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		core.CustomErrorResponse(c, &core.HTTPError{
+			Message:    "Invalid id",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if err := crud.DeleteTaxRate(db, uint(id)); err != nil {
+		core.CustomErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rate deleted successfully"})
+}
+
+func TaxesRouter(router *gin.Engine) {
+	admin := router.Group("/api/v1/taxes")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.GET("/categories/list", ListTaxCategories)
+		admin.POST("/categories/create", CreateTaxCategory)
+		admin.POST("/rates/create", CreateTaxRate)
+		admin.PUT("/rates/update/:id", UpdateTaxRate)
+		admin.DELETE("/rates/delete/:id", DeleteTaxRate)
+	}
+}
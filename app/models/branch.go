@@ -1,9 +1,304 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"ecommerce/app/schemas"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
 
 type Branch struct {
 	gorm.Model
-	Name     string    `gorm:"type:varchar(20);not null"`
+	Name      string   `gorm:"type:varchar(100);not null" json:"name"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+
+	AddressLine1 string `gorm:"type:varchar(255)" json:"address_line_1"`
+	AddressLine2 string `gorm:"type:varchar(255)" json:"address_line_2"`
+	City         string `gorm:"type:varchar(100)" json:"city"`
+	State        string `gorm:"type:varchar(100)" json:"state"`
+	Postcode     string `gorm:"type:varchar(20)" json:"postcode"`
+	Country      string `gorm:"type:varchar(100)" json:"country"`
+	PhoneNumber  string `gorm:"type:varchar(20)" json:"phone_number"`
+	Email        string `gorm:"type:varchar(255)" json:"email"`
+	// inactive branches are hidden from customers and take no orders
+	IsActive bool `gorm:"not null;default:true" json:"is_active"`
+
+	TaxRegion        string `gorm:"type:varchar(20)" json:"tax_region"`
+	PricesIncludeTax bool   `gorm:"default:false" json:"prices_include_tax"`
+
+	// IANA timezone the opening hours and holidays are expressed in
+	Timezone string `gorm:"type:varchar(50);not null;default:'UTC'" json:"timezone"`
+	// a paused branch takes no orders until PausedUntil, or until it is resumed when PausedUntil is not set
+	IsPaused    bool       `gorm:"not null;default:false" json:"is_paused"`
+	PausedUntil *time.Time `json:"paused_until"`
+	// minimum time between placing an order and its pickup or delivery
+	PickupLeadMinutes   uint `gorm:"not null;default:15" json:"pickup_lead_minutes"`
+	DeliveryLeadMinutes uint `gorm:"not null;default:45" json:"delivery_lead_minutes"`
+	SlotMinutes         uint `gorm:"not null;default:15" json:"slot_minutes"`
+	// maximum scheduled orders per slot, 0 means unlimited
+	SlotCapacity uint `gorm:"not null;default:0" json:"slot_capacity"`
+	// how long before their scheduled time scheduled orders are sent to the preparation queue
+	ReleaseLeadMinutes uint `gorm:"not null;default:30" json:"release_lead_minutes"`
+	// customers can cancel an order within CancelWindowMinutes of placing it,
+	// or a scheduled order up to CancelScheduledLeadMinutes before its scheduled time
+	CancelWindowMinutes        uint `gorm:"not null;default:5" json:"cancel_window_minutes"`
+	CancelScheduledLeadMinutes uint `gorm:"not null;default:60" json:"cancel_scheduled_lead_minutes"`
+
+	OpeningHours []BranchOpeningHour `gorm:"foreignkey:BranchID" json:"opening_hours"`
+	Holidays     []BranchHoliday     `gorm:"foreignkey:BranchID" json:"holidays"`
+
 	Products []Product `gorm:"foreignkey:BranchID"`
 }
+
+// BranchOpeningHour is an opening period of a weekday in the branch timezone, a day can have several
+type BranchOpeningHour struct {
+	gorm.Model
+	BranchID uint         `gorm:"not null;index" json:"branch_id"`
+	Weekday  time.Weekday `gorm:"not null" json:"weekday"`
+	OpensAt  string       `gorm:"type:varchar(5);not null" json:"opens_at"`
+	ClosesAt string       `gorm:"type:varchar(5);not null" json:"closes_at"`
+}
+
+// BranchHoliday closes the branch for a whole day of its calendar
+type BranchHoliday struct {
+	gorm.Model
+	BranchID uint      `gorm:"not null;index" json:"branch_id"`
+	Date     time.Time `gorm:"type:date;not null" json:"date"`
+	Reason   string    `gorm:"type:varchar(100)" json:"reason"`
+}
+
+func (b *Branch) ToResponse() schemas.BranchResponseSchema {
+	openingHours := make([]schemas.OpeningHourSchema, len(b.OpeningHours))
+	for i, period := range b.OpeningHours {
+		openingHours[i] = schemas.OpeningHourSchema{
+			Weekday:  int(period.Weekday),
+			OpensAt:  period.OpensAt,
+			ClosesAt: period.ClosesAt,
+		}
+	}
+	holidays := make([]schemas.BranchHolidayResponseSchema, len(b.Holidays))
+	for i, holiday := range b.Holidays {
+		holidays[i] = holiday.ToResponse()
+	}
+	return schemas.BranchResponseSchema{
+		ID:                         b.ID,
+		Name:                       b.Name,
+		AddressLine1:               b.AddressLine1,
+		AddressLine2:               b.AddressLine2,
+		City:                       b.City,
+		State:                      b.State,
+		Postcode:                   b.Postcode,
+		Country:                    b.Country,
+		Latitude:                   b.Latitude,
+		Longitude:                  b.Longitude,
+		PhoneNumber:                b.PhoneNumber,
+		Email:                      b.Email,
+		Timezone:                   b.Timezone,
+		IsActive:                   b.IsActive,
+		IsPaused:                   b.IsPaused,
+		PausedUntil:                b.PausedUntil,
+		PickupLeadMinutes:          b.PickupLeadMinutes,
+		DeliveryLeadMinutes:        b.DeliveryLeadMinutes,
+		SlotMinutes:                b.SlotMinutes,
+		SlotCapacity:               b.SlotCapacity,
+		ReleaseLeadMinutes:         b.ReleaseLeadMinutes,
+		CancelWindowMinutes:        b.CancelWindowMinutes,
+		CancelScheduledLeadMinutes: b.CancelScheduledLeadMinutes,
+		TaxRegion:                  b.TaxRegion,
+		PricesIncludeTax:           b.PricesIncludeTax,
+		OpeningHours:               openingHours,
+		Holidays:                   holidays,
+	}
+}
+
+func (h *BranchHoliday) ToResponse() schemas.BranchHolidayResponseSchema {
+	return schemas.BranchHolidayResponseSchema{
+		ID:     h.ID,
+		Date:   h.Date.Format(time.DateOnly),
+		Reason: h.Reason,
+	}
+}
+
+// SlotBooking counts the scheduled orders booked in a slot of a branch
+type SlotBooking struct {
+	ID        uint      `gorm:"primarykey"`
+	BranchID  uint      `gorm:"not null;uniqueIndex:idx_slot_bookings_branch_slot"`
+	SlotStart time.Time `gorm:"not null;uniqueIndex:idx_slot_bookings_branch_slot"`
+	Booked    uint      `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+// Location returns the branch timezone, UTC when it is not set or unknown
+func (b *Branch) Location() *time.Location {
+	loc, err := time.LoadLocation(b.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsPausedAt reports whether the pause switch covers t
+func (b *Branch) IsPausedAt(t time.Time) bool {
+	return b.IsPaused && (b.PausedUntil == nil || t.Before(*b.PausedUntil))
+}
+
+// IsOpenAt reports whether t falls in an opening period and not on a holiday, OpeningHours and Holidays must be loaded.
+// A branch without opening hours is open around the clock.
+func (b *Branch) IsOpenAt(t time.Time) bool {
+	local := t.In(b.Location())
+	if b.isHoliday(local) {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	for _, period := range b.periodsOf(local.Weekday()) {
+		opens, closes, err := period.Minutes()
+		if err == nil && minute >= opens && minute < closes {
+			return true
+		}
+	}
+	return false
+}
+
+// LeadTime is the minimum time before an order of the given type can be ready
+func (b *Branch) LeadTime(orderType string) time.Duration {
+	if orderType == "shipping" {
+		return time.Duration(b.DeliveryLeadMinutes) * time.Minute
+	}
+	return time.Duration(b.PickupLeadMinutes) * time.Minute
+}
+
+// CanCustomerCancel reports whether the cancellation policy of the branch still lets the customer cancel the order
+func (b *Branch) CanCustomerCancel(order Order, now time.Time) bool {
+	if order.Status != "pending" && order.Status != "paid" {
+		return false
+	}
+	if now.Before(order.CreatedAt.Add(time.Duration(b.CancelWindowMinutes) * time.Minute)) {
+		return true
+	}
+	return order.IsScheduled && order.ReleasedAt == nil &&
+		now.Before(order.ScheduleTime.Add(-time.Duration(b.CancelScheduledLeadMinutes)*time.Minute))
+}
+
+// SlotLength is the length of the scheduling slots of the branch
+func (b *Branch) SlotLength() time.Duration {
+	if b.SlotMinutes == 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(b.SlotMinutes) * time.Minute
+}
+
+// SlotStart returns the start of the slot t falls in, slots are aligned on the opening of their period
+func (b *Branch) SlotStart(t time.Time) time.Time {
+	local := t.In(b.Location())
+	minute := local.Hour()*60 + local.Minute()
+	base := 0
+	for _, period := range b.periodsOf(local.Weekday()) {
+		opens, closes, err := period.Minutes()
+		if err == nil && minute >= opens && minute < closes {
+			base = opens
+			break
+		}
+	}
+	slotMinutes := int(b.SlotLength() / time.Minute)
+	start := base + (minute-base)/slotMinutes*slotMinutes
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, start, 0, 0, local.Location())
+}
+
+// NextSlots returns up to count slot start times of an order type after from, searching the next days.
+// Slots for which available returns false are skipped, a nil available accepts every slot.
+func (b *Branch) NextSlots(from time.Time, orderType string, count int, days int, available func(time.Time) bool) []time.Time {
+	earliest := from.Add(b.LeadTime(orderType))
+
+	var slots []time.Time
+	local := from.In(b.Location())
+	for i := 0; i < days && len(slots) < count; i++ {
+		for _, slot := range b.DaySlots(local.AddDate(0, 0, i)) {
+			if len(slots) == count {
+				break
+			}
+			if slot.Before(earliest) || b.IsPausedAt(slot) || (available != nil && !available(slot)) {
+				continue
+			}
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// DaySlots returns every slot start time of the branch calendar day of t, none on holidays
+func (b *Branch) DaySlots(t time.Time) []time.Time {
+	loc := b.Location()
+	day := t.In(loc)
+	if b.isHoliday(day) {
+		return nil
+	}
+
+	var slots []time.Time
+	for _, period := range b.periodsOf(day.Weekday()) {
+		opens, closes, err := period.Minutes()
+		if err != nil {
+			continue
+		}
+		// built from the calendar date so the periods keep their clock time on DST days
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, opens, 0, 0, loc)
+		end := time.Date(day.Year(), day.Month(), day.Day(), 0, closes, 0, 0, loc)
+		for slot := start; slot.Before(end); slot = slot.Add(b.SlotLength()) {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+func (b *Branch) isHoliday(local time.Time) bool {
+	date := local.Format(time.DateOnly)
+	for _, holiday := range b.Holidays {
+		if holiday.Date.Format(time.DateOnly) == date {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Branch) periodsOf(weekday time.Weekday) []BranchOpeningHour {
+	if len(b.OpeningHours) == 0 {
+		return []BranchOpeningHour{{Weekday: weekday, OpensAt: "00:00", ClosesAt: "24:00"}}
+	}
+	var periods []BranchOpeningHour
+	for _, period := range b.OpeningHours {
+		if period.Weekday == weekday {
+			periods = append(periods, period)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].OpensAt < periods[j].OpensAt })
+	return periods
+}
+
+// Minutes converts the period to minutes since midnight, "24:00" closes at the end of the day
+func (h *BranchOpeningHour) Minutes() (int, int, error) {
+	opens, err := ParseClock(h.OpensAt)
+	if err != nil {
+		return 0, 0, err
+	}
+	closes, err := ParseClock(h.ClosesAt)
+	if err != nil {
+		return 0, 0, err
+	}
+	if closes <= opens {
+		return 0, 0, fmt.Errorf("period closes at %s before it opens at %s", h.ClosesAt, h.OpensAt)
+	}
+	return opens, closes, nil
+}
+
+// ParseClock parses a "15:04" clock time into minutes since midnight
+func ParseClock(clock string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil || len(clock) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// testBranch is a Paris branch open on Monday 09:00-12:00 and 14:00-18:00 and on Saturday 10:00-24:00,
+// closed on Monday 9 March 2026. Paris is UTC+1 in early March 2026.
+func testBranch() Branch {
+	return Branch{
+		Timezone: "Europe/Paris",
+		OpeningHours: []BranchOpeningHour{
+			{Weekday: time.Monday, OpensAt: "14:00", ClosesAt: "18:00"},
+			{Weekday: time.Monday, OpensAt: "09:00", ClosesAt: "12:00"},
+			{Weekday: time.Saturday, OpensAt: "10:00", ClosesAt: "24:00"},
+		},
+		Holidays: []BranchHoliday{{Date: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)}},
+	}
+}
+
+func TestBranchIsOpenAt(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alwaysOpen := Branch{Holidays: testBranch().Holidays}
+
+	tests := []struct {
+		name   string
+		branch Branch
+		at     time.Time
+		want   bool
+	}{
+		{name: "opening", branch: testBranch(), at: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), want: true},
+		{name: "before opening", branch: testBranch(), at: time.Date(2026, 3, 2, 7, 59, 0, 0, time.UTC)},
+		{name: "last minute", branch: testBranch(), at: time.Date(2026, 3, 2, 10, 59, 0, 0, time.UTC), want: true},
+		{name: "closing", branch: testBranch(), at: time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC)},
+		{name: "between periods", branch: testBranch(), at: time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)},
+		{name: "second period", branch: testBranch(), at: time.Date(2026, 3, 2, 13, 0, 0, 0, time.UTC), want: true},
+		{name: "time in the branch timezone", branch: testBranch(), at: time.Date(2026, 3, 2, 9, 0, 0, 0, paris), want: true},
+		{name: "day without periods", branch: testBranch(), at: time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)},
+		{name: "holiday", branch: testBranch(), at: time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{name: "open until midnight", branch: testBranch(), at: time.Date(2026, 3, 7, 22, 59, 0, 0, time.UTC), want: true},
+		// still Saturday in UTC, already Sunday in Paris
+		{name: "next local day", branch: testBranch(), at: time.Date(2026, 3, 7, 23, 30, 0, 0, time.UTC)},
+		{name: "without opening hours", branch: alwaysOpen, at: time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC), want: true},
+		{name: "without opening hours on a holiday", branch: alwaysOpen, at: time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC)},
+		{
+			name:   "unknown timezone falls back to UTC",
+			branch: Branch{Timezone: "Mars/Olympus", OpeningHours: testBranch().OpeningHours},
+			at:     time.Date(2026, 3, 2, 11, 30, 0, 0, time.UTC),
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.branch.IsOpenAt(tt.at); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchDaySlots(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, paris) }
+	hourly := testBranch()
+	hourly.SlotMinutes = 60
+
+	tests := []struct {
+		name   string
+		branch Branch
+		day    time.Time
+		want   []time.Time
+	}{
+		{
+			name:   "periods in order",
+			branch: hourly,
+			day:    at(2, 0, 0),
+			want:   []time.Time{at(2, 9, 0), at(2, 10, 0), at(2, 11, 0), at(2, 14, 0), at(2, 15, 0), at(2, 16, 0), at(2, 17, 0)},
+		},
+		{
+			// 20:00 UTC on Monday is still Monday in Paris
+			name:   "day of the branch calendar",
+			branch: hourly,
+			day:    time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC),
+			want:   []time.Time{at(2, 9, 0), at(2, 10, 0), at(2, 11, 0), at(2, 14, 0), at(2, 15, 0), at(2, 16, 0), at(2, 17, 0)},
+		},
+		{
+			name:   "last slot before closing",
+			branch: Branch{Timezone: "Europe/Paris", SlotMinutes: 45, OpeningHours: []BranchOpeningHour{{Weekday: time.Monday, OpensAt: "09:00", ClosesAt: "11:00"}}},
+			day:    at(2, 0, 0),
+			want:   []time.Time{at(2, 9, 0), at(2, 9, 45), at(2, 10, 30)},
+		},
+		{name: "day without periods", branch: hourly, day: at(3, 12, 0)},
+		{name: "holiday", branch: hourly, day: at(9, 12, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.branch.DaySlots(tt.day)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d slots %v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("slot %d: got %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// the clocks go forward on 29 March 2026 in Paris, the day has 23 hourly slots
+	alwaysOpen := Branch{Timezone: "Europe/Paris", SlotMinutes: 60}
+	dstDay := alwaysOpen.DaySlots(at(29, 12, 0))
+	if len(dstDay) != 23 || !dstDay[0].Equal(at(29, 0, 0)) || !dstDay[22].Equal(at(29, 23, 0)) {
+		t.Errorf("daylight saving day: got %v", dstDay)
+	}
+}
+
+func TestBranchSlotStart(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 2, hour, minute, 0, 0, paris) }
+	branch := testBranch()
+	branch.SlotMinutes = 45
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{name: "opening", t: at(9, 0), want: at(9, 0)},
+		{name: "aligned on the opening", t: at(9, 50), want: at(9, 45)},
+		{name: "aligned on the second period", t: at(14, 50), want: at(14, 45)},
+		{name: "time in UTC", t: time.Date(2026, 3, 2, 9, 40, 0, 0, time.UTC), want: at(10, 30)},
+		{name: "outside the periods aligned on midnight", t: at(13, 0), want: at(12, 45)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := branch.SlotStart(tt.t); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchNextSlots(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, paris) }
+	branch := testBranch()
+	branch.SlotMinutes = 60
+	branch.PickupLeadMinutes = 30
+	branch.DeliveryLeadMinutes = 90
+	from := time.Date(2026, 3, 2, 16, 20, 0, 0, paris)
+	pausedUntil := at(7, 11)
+
+	tests := []struct {
+		name      string
+		branch    Branch
+		orderType string
+		available func(time.Time) bool
+		want      []time.Time
+	}{
+		{
+			// the Monday 9 March holiday is skipped
+			name:      "pickup lead time",
+			branch:    branch,
+			orderType: "pickup",
+			want:      []time.Time{at(2, 17), at(7, 10), at(7, 11)},
+		},
+		{
+			name:      "delivery lead time",
+			branch:    branch,
+			orderType: "shipping",
+			want:      []time.Time{at(7, 10), at(7, 11), at(7, 12)},
+		},
+		{
+			name:      "unavailable slots",
+			branch:    branch,
+			orderType: "pickup",
+			available: func(slot time.Time) bool { return !slot.Equal(at(7, 10)) },
+			want:      []time.Time{at(2, 17), at(7, 11), at(7, 12)},
+		},
+		{
+			name: "paused",
+			branch: func() Branch {
+				paused := branch
+				paused.IsPaused = true
+				paused.PausedUntil = &pausedUntil
+				return paused
+			}(),
+			orderType: "pickup",
+			want:      []time.Time{at(7, 11), at(7, 12), at(7, 13)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.branch.NextSlots(from, tt.orderType, 3, 14, tt.available)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("slot %d: got %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBranchCanCustomerCancel(t *testing.T) {
+	branch := Branch{CancelWindowMinutes: 5, CancelScheduledLeadMinutes: 60}
+	placed := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	released := placed.Add(time.Hour)
+	order := func(status string, scheduled bool, scheduleTime time.Time, releasedAt *time.Time) Order {
+		o := Order{Status: status, IsScheduled: scheduled, ScheduleTime: scheduleTime, ReleasedAt: releasedAt}
+		o.CreatedAt = placed
+		return o
+	}
+	inFiveHours := placed.Add(5 * time.Hour)
+
+	tests := []struct {
+		name  string
+		order Order
+		now   time.Time
+		want  bool
+	}{
+		{name: "pending within the window", order: order("pending", false, time.Time{}, nil), now: placed.Add(4 * time.Minute), want: true},
+		{name: "paid within the window", order: order("paid", false, time.Time{}, nil), now: placed.Add(4 * time.Minute), want: true},
+		{name: "end of the window", order: order("pending", false, time.Time{}, nil), now: placed.Add(5 * time.Minute)},
+		{name: "after the window", order: order("pending", false, time.Time{}, nil), now: placed.Add(time.Hour)},
+		{name: "preparing within the window", order: order("preparing", false, time.Time{}, nil), now: placed.Add(time.Minute)},
+		{name: "cancelled", order: order("cancelled", false, time.Time{}, nil), now: placed.Add(time.Minute)},
+		{name: "scheduled before the lead time", order: order("paid", true, inFiveHours, nil), now: placed.Add(3 * time.Hour), want: true},
+		{name: "scheduled at the lead time", order: order("paid", true, inFiveHours, nil), now: inFiveHours.Add(-time.Hour)},
+		{name: "scheduled within the lead time", order: order("paid", true, inFiveHours, nil), now: inFiveHours.Add(-30 * time.Minute)},
+		{name: "scheduled and released", order: order("paid", true, inFiveHours, &released), now: placed.Add(2 * time.Hour)},
+		{name: "scheduled within the window", order: order("pending", true, placed.Add(30*time.Minute), nil), now: placed.Add(time.Minute), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := branch.CanCustomerCancel(tt.order, tt.now); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,24 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"ecommerce/app/core/storage"
+	"ecommerce/app/schemas"
+	"gorm.io/gorm"
+)
 
+// Category is a node of the category tree, the root categories have no parent.
+// Siblings are shown in their position order.
 type Category struct {
 	gorm.Model
 	Title         string        `json:"title"`
+	Slug          *string       `gorm:"type:varchar(255);uniqueIndex:idx_categories_slug,where:deleted_at IS NULL" json:"slug"`
+	ParentID      *uint         `gorm:"index" json:"parent_id"`
+	Parent        *Category     `json:"-" gorm:"foreignKey:ParentID"`
+	Children      []Category    `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+	Position      int           `gorm:"not null;default:0" json:"position"`
+	Image         string        `gorm:"type:varchar(2048)" json:"image"`
+	MediaID       *uint         `json:"media_id"`
+	Media         *MediaFile    `json:"-" gorm:"foreignKey:MediaID"`
 	SubCategories []SubCategory `json:"sub_categories" gorm:"foreignKey:CategoryID"`
 }
 
@@ -14,3 +28,19 @@ type SubCategory struct {
 	CategoryID uint     `json:"category_id"`
 	Category   Category `json:"-" gorm:"foreignKey:CategoryID"`
 }
+
+func (c *Category) ToResponse() schemas.CategoryResponseSchema {
+	image := c.Image
+	if c.Media != nil {
+		image = storage.URL(c.Media.Key)
+	}
+	return schemas.CategoryResponseSchema{
+		ID:       c.ID,
+		Title:    c.Title,
+		Slug:     c.Slug,
+		ParentID: c.ParentID,
+		Position: c.Position,
+		Image:    image,
+		MediaID:  c.MediaID,
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"ecommerce/app/schemas"
+	"gorm.io/gorm"
+)
+
+// FavouriteOrder is a named order a user saved to place again
+type FavouriteOrder struct {
+	gorm.Model
+	Name      string `gorm:"type:varchar(100);not null" json:"name"`
+	UserID    uint   `gorm:"not null;index" json:"user_id"`
+	BranchID  uint   `gorm:"not null" json:"branch_id"`
+	OrderType string `gorm:"type:varchar(20);not null" json:"order_type"`
+	// the items with their selected variations and addons, checked again when the order is placed
+	Products []schemas.OrderItemSchema `gorm:"serializer:json;type:jsonb;not null" json:"products"`
+}
+
+func (f *FavouriteOrder) ToResponse() schemas.FavouriteOrderResponseSchema {
+	return schemas.FavouriteOrderResponseSchema{
+		ID:        f.ID,
+		Name:      f.Name,
+		BranchID:  f.BranchID,
+		OrderType: f.OrderType,
+		Products:  f.Products,
+		CreatedAt: f.CreatedAt,
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"ecommerce/app/core/storage"
+	"ecommerce/app/schemas"
+	"gorm.io/gorm"
+)
+
+// MediaFile is an uploaded image kept in the blob store, with its thumbnails
+type MediaFile struct {
+	gorm.Model
+	Key         string `gorm:"type:varchar(255);not null;uniqueIndex" json:"key"`
+	ContentType string `gorm:"type:varchar(50);not null" json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	// blob keys of the thumbnails by size name, the sizes larger than the image are not made
+	Thumbnails   map[string]string `gorm:"serializer:json;type:jsonb" json:"thumbnails"`
+	UploadedByID uint              `gorm:"index" json:"uploaded_by_id"`
+}
+
+// Keys are the blob keys of the file and its thumbnails
+func (m *MediaFile) Keys() []string {
+	keys := []string{m.Key}
+	for _, key := range m.Thumbnails {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (m *MediaFile) ToResponse() schemas.MediaResponseSchema {
+	thumbnails := make(map[string]string, len(m.Thumbnails))
+	for name, key := range m.Thumbnails {
+		thumbnails[name] = storage.URL(key)
+	}
+	return schemas.MediaResponseSchema{
+		ID:          m.ID,
+		URL:         storage.URL(m.Key),
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		Width:       m.Width,
+		Height:      m.Height,
+		Thumbnails:  thumbnails,
+		CreatedAt:   m.CreatedAt,
+	}
+}
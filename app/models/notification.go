@@ -4,4 +4,10 @@ import "gorm.io/gorm"
 
 type Notification struct {
 	gorm.Model
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	IsRead  bool   `gorm:"default:false" json:"is_read"`
+
+	UserID uint `gorm:"index" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"ecommerce/app/schemas"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,16 @@ type Order struct {
 	ScheduleTime time.Time `json:"schedule_time"`
 	Coupon       string    `gorm:"type:varchar(20);null" json:"coupon"`
 	Discount     float64   `gorm:"type:decimal(10, 2);null" json:"discount"`
+	ShippingFee  float64   `gorm:"type:decimal(10,2);not null;default:0" json:"shipping_fee"`
+	TaxTotal     float64   `gorm:"type:decimal(10,2);not null;default:0" json:"tax_total"`
+	// whether the item prices already include the tax, taken from the branch when the order is placed
+	PricesIncludeTax bool `gorm:"not null;default:false" json:"prices_include_tax"`
+
+	DeliveryZoneID *uint `json:"delivery_zone_id"`
+	// start of the capacity slot booked by a scheduled order, cleared when the slot is released
+	SlotStart *time.Time `json:"slot_start"`
+	// when a scheduled order was sent to the branch preparation queue
+	ReleasedAt *time.Time `json:"released_at"`
 
 	UserID uint
 	User   User `gorm:"foreignkey:UserID"`
@@ -29,12 +40,18 @@ type Order struct {
 	ShippingAddress ShippingAddress `gorm:"foreignKey:OrderID;references:ID"`
 
 	Payment Payment `gorm:"foreignkey:OrderID"`
+
+	Taxes []OrderTax `gorm:"foreignkey:OrderID"`
+
+	History []OrderStatusHistory `gorm:"foreignkey:OrderID"`
 }
 
 type OrderItem struct {
 	gorm.Model
 	Quantity   uint    `gorm:"not null" json:"quantity"`
+	UnitPrice  float64 `gorm:"type:decimal(10,2);not null;default:0" json:"unit_price"`
 	TotalPrice float64 `gorm:"not null" json:"total_price"`
+	TaxAmount  float64 `gorm:"type:decimal(10,2);not null;default:0" json:"tax_amount"`
 
 	ProductID uint    `gorm:"not null" json:"product_id"`
 	Product   Product `gorm:"foreignkey:ProductID" json:"product"`
@@ -44,6 +61,7 @@ type OrderItem struct {
 
 	SelectedVariations []OrderItemVariation `gorm:"foreignkey:OrderItemID" json:"selected_variations"`
 	SelectedAddons     []OrderItemAddon     `gorm:"foreignkey:OrderItemID" json:"selected_addons"`
+	Taxes              []OrderItemTax       `gorm:"foreignkey:OrderItemID" json:"taxes"`
 }
 
 type OrderItemVariation struct {
@@ -62,34 +80,118 @@ type OrderItemAddon struct {
 	Quantity    uint  `gorm:"not null" json:"quantity"`
 }
 
+// OrderItemTax is the tax of an order line for one rate
+type OrderItemTax struct {
+	gorm.Model
+	OrderItemID   uint    `gorm:"not null;index" json:"order_item_id"`
+	Name          string  `json:"name"`
+	Rate          float64 `gorm:"type:decimal(6,3)" json:"rate"`
+	TaxableAmount float64 `gorm:"type:decimal(10,2)" json:"taxable_amount"`
+	Amount        float64 `gorm:"type:decimal(10,2)" json:"amount"`
+}
+
+// OrderTax is the order tax breakdown per rate, after the coupon discount
+type OrderTax struct {
+	gorm.Model
+	OrderID       uint    `gorm:"not null;index" json:"order_id"`
+	Name          string  `json:"name"`
+	Rate          float64 `gorm:"type:decimal(6,3)" json:"rate"`
+	TaxableAmount float64 `gorm:"type:decimal(10,2)" json:"taxable_amount"`
+	Amount        float64 `gorm:"type:decimal(10,2)" json:"amount"`
+}
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID    uint   `gorm:"not null;index" json:"order_id"`
+	FromStatus string `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus   string `gorm:"type:varchar(20);not null" json:"to_status"`
+	Reason     string `gorm:"type:varchar(255)" json:"reason"`
+	// nil when the change was made by the system (e.g. the scheduled order worker)
+	ChangedByID *uint `json:"changed_by_id"`
+}
+
 func (o *Order) ToResponse() schemas.OrderResponseSchema {
-	var productSchemas []schemas.OrderItemSchema
+	var productSchemas []schemas.OrderItemResponseSchema
 	for _, item := range o.Products {
-		productSchema := schemas.OrderItemSchema{
+		productSchema := schemas.OrderItemResponseSchema{
 			ProductID:  item.ProductID,
 			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+			TotalPrice: item.TotalPrice,
+			TaxAmount:  item.TaxAmount,
+			Taxes:      convertItemTaxes(item.Taxes),
 			Variations: convertVariations(item.SelectedVariations),
 			Addons:     convertAddons(item.SelectedAddons),
 		}
 		productSchemas = append(productSchemas, productSchema)
 	}
 
+	var taxSchemas []schemas.TaxLineSchema
+	for _, tax := range o.Taxes {
+		taxSchemas = append(taxSchemas, schemas.TaxLineSchema{
+			Name:          tax.Name,
+			Rate:          tax.Rate,
+			TaxableAmount: tax.TaxableAmount,
+			Amount:        tax.Amount,
+		})
+	}
+
+	var historySchemas []schemas.OrderStatusHistorySchema
+	for _, change := range o.History {
+		historySchemas = append(historySchemas, schemas.OrderStatusHistorySchema{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Reason:     change.Reason,
+			ChangedAt:  change.CreatedAt,
+		})
+	}
+
 	return schemas.OrderResponseSchema{
-		ID:           o.ID,
-		Status:       o.Status,
-		Type:         o.Type,
-		Total:        o.Total,
-		SubTotal:     o.SubTotal,
-		IsPaid:       o.IsPaid,
-		IsScheduled:  o.IsScheduled,
-		ScheduleTime: o.ScheduleTime,
-		UserID:       o.UserID,
-		BranchID:     o.BranchID,
-		Products:     productSchemas,
+		ID:               o.ID,
+		Status:           o.Status,
+		Type:             o.Type,
+		Total:            o.Total,
+		SubTotal:         o.SubTotal,
+		Discount:         o.Discount,
+		ShippingFee:      o.ShippingFee,
+		TaxTotal:         o.TaxTotal,
+		Taxes:            taxSchemas,
+		PricesIncludeTax: o.PricesIncludeTax,
+		IsPaid:           o.IsPaid,
+		IsScheduled:      o.IsScheduled,
+		ScheduleTime:     o.ScheduleTime,
+		UserID:           o.UserID,
+		BranchID:         o.BranchID,
+		Products:         productSchemas,
+		History:          historySchemas,
+	}
+}
+
+// ToCreationSchema returns the item as it is sent to create an order, to order it again
+func (i *OrderItem) ToCreationSchema() schemas.OrderItemSchema {
+	return schemas.OrderItemSchema{
+		ProductID:  i.ProductID,
+		Quantity:   i.Quantity,
+		Addons:     convertAddons(i.SelectedAddons),
+		Variations: convertVariations(i.SelectedVariations),
 	}
 }
 
 // Helper Functions
+func convertItemTaxes(taxes []OrderItemTax) []schemas.TaxLineSchema {
+	var taxSchemas []schemas.TaxLineSchema
+	for _, tax := range taxes {
+		taxSchemas = append(taxSchemas, schemas.TaxLineSchema{
+			Name:          tax.Name,
+			Rate:          tax.Rate,
+			TaxableAmount: tax.TaxableAmount,
+			Amount:        tax.Amount,
+		})
+	}
+	return taxSchemas
+}
+
 func convertVariations(variations []OrderItemVariation) []schemas.ProductVariationSchema {
 	var variationSchemas []schemas.ProductVariationSchema
 	for _, variation := range variations {
@@ -127,9 +229,92 @@ func convertAddons(addons []OrderItemAddon) []schemas.AddonSchema {
 
 func (o *Order) ValidateStatus(status string) bool {
 	switch status {
-	case "pending", "paid", "shipped":
+	case "pending", "paid", "preparing", "ready", "shipped", "completed", "cancelled":
 		return true
 	default:
 		return false
 	}
 }
+
+// IsPaymentCompleted reports whether the order payment went through, Payment must be loaded
+func (o *Order) IsPaymentCompleted() bool {
+	return o.IsPaid || o.Payment.Status == "succeeded"
+}
+
+// orderTransitions lists the statuses an order can move to from each status
+var orderTransitions = map[string][]string{
+	"pending":   {"paid", "preparing", "cancelled"},
+	"paid":      {"preparing", "cancelled"},
+	"preparing": {"ready", "cancelled"},
+	"ready":     {"shipped", "completed", "cancelled"},
+	"shipped":   {"completed"},
+}
+
+// CanTransitionTo reports whether the order can move from its current status to status
+func (o *Order) CanTransitionTo(status string) bool {
+	for _, next := range orderTransitions[o.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ToQueueResponse converts the order for the branch preparation board,
+// User, ShippingAddress and the item variations, options and addons must be loaded
+func (o *Order) ToQueueResponse() schemas.QueueOrderResponseSchema {
+	items := make([]schemas.QueueItemSchema, len(o.Products))
+	for i, item := range o.Products {
+		variations := make([]schemas.QueueVariationSchema, len(item.SelectedVariations))
+		for j, variation := range item.SelectedVariations {
+			options := make([]schemas.QueueOptionSchema, len(variation.SelectedOptions))
+			for k, option := range variation.SelectedOptions {
+				options[k] = schemas.QueueOptionSchema{VariationOptionID: option.ID, Title: option.Title}
+			}
+			variations[j] = schemas.QueueVariationSchema{
+				ProductVariationID: variation.ProductVariationID,
+				Title:              variation.ProductVariation.Title,
+				Options:            options,
+			}
+		}
+		addons := make([]schemas.QueueAddonSchema, len(item.SelectedAddons))
+		for j, addon := range item.SelectedAddons {
+			addons[j] = schemas.QueueAddonSchema{AddonID: addon.AddonID, Title: addon.Addon.Title, Quantity: addon.Quantity}
+		}
+		items[i] = schemas.QueueItemSchema{
+			ProductID:  item.ProductID,
+			Quantity:   item.Quantity,
+			Variations: variations,
+			Addons:     addons,
+		}
+	}
+
+	response := schemas.QueueOrderResponseSchema{
+		ID:            o.ID,
+		Status:        o.Status,
+		Type:          o.Type,
+		IsPaid:        o.IsPaid,
+		Total:         o.Total,
+		IsScheduled:   o.IsScheduled,
+		ScheduleTime:  o.ScheduleTime,
+		ReleasedAt:    o.ReleasedAt,
+		CreatedAt:     o.CreatedAt,
+		CustomerName:  strings.TrimSpace(o.User.FirstName + " " + o.User.LastName),
+		CustomerPhone: o.User.PhoneNumber,
+		Items:         items,
+	}
+	if o.Type == "shipping" && o.ShippingAddress.ID != 0 {
+		address := o.ShippingAddress
+		response.ShippingAddress = &schemas.ShippingAddressSchema{
+			AddressLine1: address.AddressLine1,
+			AddressLine2: address.AddressLine2,
+			City:         address.City,
+			Country:      address.Country,
+			Postcode:     address.Postcode,
+			State:        address.State,
+			Latitude:     address.Latitude,
+			Longitude:    address.Longitude,
+		}
+	}
+	return response
+}
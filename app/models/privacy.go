@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// DataExport is an archive of everything we store about a user, generated in the background
+type DataExport struct {
+	gorm.Model
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	Format    string    `gorm:"type:varchar(10);not null" json:"format"`
+	FilePath  string    `json:"-"`
+	Error     string    `json:"error,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	User   User `json:"-"`
+}
+
+// AccountDeletionRequest schedules the anonymisation of a user after a grace period
+type AccountDeletionRequest struct {
+	gorm.Model
+	ScheduledAt time.Time  `gorm:"not null" json:"scheduled_at"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+	ProcessedAt *time.Time `json:"processed_at"`
+
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	User   User `json:"-"`
+}
@@ -9,24 +9,113 @@ import (
 
 type Product struct {
 	gorm.Model
-	Price                float64            `json:"price"`
-	Image                string             `json:"image"`
-	Description          string             `json:"description"`
-	Tags                 pq.StringArray     `gorm:"type:text[]" json:"tags"`
-	IsActive             bool               `json:"is_active"`
-	StockType            string             `json:"stock_type"`
-	DailyStock           uint               `json:"daily_stock"`
-	Stock                uint               `json:"stock"`
-	LastDailyStockUpdate time.Time          `json:"last_daily_stock_update"`
-	DiscountType         string             `json:"discount_type"`
-	DiscountValue        float64            `json:"discount_value"`
-	TotalSales           uint               `json:"total_sales" gorm:"default:0"`
-	Variations           []ProductVariation `json:"variations" gorm:"foreignKey:ProductID"`
-	Addons               []Addon            `json:"addons" gorm:"many2many:product_addons;"`
-	CategoryID           uint               `json:"category_id"`
-	Category             Category           `json:"category" gorm:"foreignKey:CategoryID"`
-	BranchID             uint               `json:"branch_id"`
-	Branch               Branch             `json:"branch" gorm:"foreignKey:BranchID"`
+	Title                string                           `gorm:"type:varchar(255);not null;default:''" json:"title"`
+	Slug                 *string                          `gorm:"type:varchar(255);uniqueIndex:idx_products_slug,where:deleted_at IS NULL" json:"slug"`
+	SKU                  *string                          `gorm:"type:varchar(64);uniqueIndex:idx_products_branch_sku,priority:2,where:deleted_at IS NULL;uniqueIndex:idx_products_shared_sku,where:branch_id IS NULL AND deleted_at IS NULL" json:"sku"`
+	Barcode              *string                          `gorm:"type:varchar(64);index" json:"barcode"`
+	Price                float64                          `json:"price"`
+	Image                string                           `json:"image"`
+	Images               []ProductImage                   `json:"images" gorm:"foreignKey:ProductID"`
+	Description          string                           `json:"description"`
+	Tags                 pq.StringArray                   `gorm:"type:text[]" json:"tags"`
+	Attributes           []schemas.ProductAttributeSchema `json:"attributes" gorm:"serializer:json;type:jsonb"`
+	IsActive             bool                             `json:"is_active"`
+	PublishFrom          *time.Time                       `json:"publish_from"`
+	PublishUntil         *time.Time                       `json:"publish_until"`
+	StockType            string                           `json:"stock_type"`
+	DailyStock           uint                             `json:"daily_stock"`
+	Stock                uint                             `json:"stock"`
+	LastDailyStockUpdate time.Time                        `json:"last_daily_stock_update"`
+	DiscountType         string                           `json:"discount_type"`
+	DiscountValue        float64                          `json:"discount_value"`
+	TotalSales           uint                             `json:"total_sales" gorm:"default:0"`
+	Weight               float64                          `json:"weight" gorm:"default:0"`
+	TaxCategoryID        *uint                            `json:"tax_category_id"`
+	Variations           []ProductVariation               `json:"variations" gorm:"foreignKey:ProductID"`
+	Addons               []Addon                          `json:"addons" gorm:"many2many:product_addons;"`
+	CategoryID           uint                             `json:"category_id"`
+	Category             Category                         `json:"category" gorm:"foreignKey:CategoryID"`
+	Categories           []Category                       `json:"categories" gorm:"many2many:product_categories;"`
+	SubCategoryID        *uint                            `json:"sub_category_id" gorm:"index"`
+	SubCategory          *SubCategory                     `json:"sub_category" gorm:"foreignKey:SubCategoryID"`
+	BranchID             *uint                            `json:"branch_id" gorm:"uniqueIndex:idx_products_branch_sku,priority:1"`
+	Branch               *Branch                          `json:"branch" gorm:"foreignKey:BranchID"`
+	BranchProducts       []BranchProduct                  `json:"branch_products" gorm:"foreignKey:ProductID"`
+	SourceProductID      *uint                            `json:"source_product_id" gorm:"index"`
+	// average review rating, only loaded by the product lists sorted by rating
+	AverageRating float64 `json:"-" gorm:"->;-:migration"`
+	// availability in a branch, only loaded by the product lists of a branch
+	IsAvailable *bool `json:"-" gorm:"->;-:migration"`
+}
+
+// BranchProduct offers a shared product (a product without branch) in a branch, with the branch price, stock and flags.
+// The products of a branch don't have any, they hold their own price and stock.
+type BranchProduct struct {
+	gorm.Model
+	ProductID uint    `json:"product_id" gorm:"uniqueIndex:idx_branch_products_product_branch,where:deleted_at IS NULL"`
+	Product   Product `json:"product" gorm:"foreignKey:ProductID"`
+	BranchID  uint    `json:"branch_id" gorm:"uniqueIndex:idx_branch_products_product_branch;index"`
+	Branch    Branch  `json:"branch" gorm:"foreignKey:BranchID"`
+	// the product price is used when not set
+	Price                *float64  `json:"price"`
+	StockType            string    `json:"stock_type" gorm:"type:varchar(20);not null"`
+	Stock                uint      `json:"stock"`
+	DailyStock           uint      `json:"daily_stock"`
+	LastDailyStockUpdate time.Time `json:"last_daily_stock_update"`
+	// an active product that is temporarily not sold, e.g. sold out for the day
+	IsAvailable bool `json:"is_available"`
+	IsActive    bool `json:"is_active"`
+}
+
+// Apply gives the product the price, stock and flags of the branch
+func (bp *BranchProduct) Apply(p *Product) {
+	if bp.Price != nil {
+		p.Price = *bp.Price
+	}
+	p.StockType = bp.StockType
+	p.Stock = bp.Stock
+	p.DailyStock = bp.DailyStock
+	p.LastDailyStockUpdate = bp.LastDailyStockUpdate
+	p.IsActive = p.IsActive && bp.IsActive
+	p.IsAvailable = &bp.IsAvailable
+}
+
+// ProductImage is one of the ordered images of a product
+type ProductImage struct {
+	gorm.Model
+	ProductID uint       `json:"product_id" gorm:"index"`
+	MediaID   *uint      `json:"media_id" gorm:"index"`
+	Media     *MediaFile `json:"media" gorm:"foreignKey:MediaID"`
+	// external URL, the uploaded images are served from the blob store
+	URL      string `json:"url" gorm:"type:varchar(2048);not null"`
+	AltText  string `json:"alt_text" gorm:"type:varchar(255)"`
+	Position int    `json:"position"`
+}
+
+// PublishedProductSQL selects the products that are active and within their publish window
+const PublishedProductSQL = `products.is_active AND (products.publish_from IS NULL OR products.publish_from <= now())
+	AND (products.publish_until IS NULL OR products.publish_until > now())`
+
+// IsPublished tells whether the product is active and within its publish window, like PublishedProductSQL
+func (p *Product) IsPublished(now time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.PublishFrom != nil && p.PublishFrom.After(now) {
+		return false
+	}
+	return p.PublishUntil == nil || p.PublishUntil.After(now)
+}
+
+// DiscountPercentage is the product discount as a percentage of its price
+func (p *Product) DiscountPercentage() float64 {
+	if p.DiscountType == "percentage" {
+		return p.DiscountValue
+	}
+	if p.DiscountValue > 0 && p.Price > 0 {
+		return p.DiscountValue / p.Price * 100
+	}
+	return 0
 }
 
 type ProductVariation struct {
@@ -50,10 +139,13 @@ type VariationOption struct {
 
 type Addon struct {
 	gorm.Model
-	Title    string  `json:"title"`
-	Price    float64 `json:"price"`
-	Tax      float64
-	Products []Product `json:"products" gorm:"many2many:product_addons;"`
+	Title string  `json:"title"`
+	Price float64 `json:"price"`
+	// Deprecated: the flat tax amount of the addons created before the tax categories, it is no longer charged
+	// and is only kept for one release so the existing values can be moved to a TaxCategoryID.
+	Tax           float64   `json:"tax"`
+	TaxCategoryID *uint     `json:"tax_category_id"`
+	Products      []Product `json:"products" gorm:"many2many:product_addons;"`
 }
 
 type Review struct {
@@ -78,20 +170,54 @@ func (p *Product) ToResponse() schemas.ProductResponseSchema {
 	for i, a := range p.Addons {
 		addonSchemas[i] = a.ToResponse()
 	}
+	imageSchemas := make([]schemas.ProductImageResponseSchema, len(p.Images))
+	for i, image := range p.Images {
+		imageSchemas[i] = image.ToResponse()
+	}
+	// the uploaded images have expiring URLs, the stored image is only used for the external ones
+	image := p.Image
+	if len(imageSchemas) > 0 {
+		image = imageSchemas[0].URL
+	}
+	categoryIDs := []uint{p.CategoryID}
+	for _, category := range p.Categories {
+		if category.ID != p.CategoryID {
+			categoryIDs = append(categoryIDs, category.ID)
+		}
+	}
+	attributes := p.Attributes
+	if attributes == nil {
+		attributes = []schemas.ProductAttributeSchema{}
+	}
 	return schemas.ProductResponseSchema{
-		ID:            p.ID,
-		Price:         p.Price,
-		Image:         p.Image,
-		Description:   p.Description,
-		Tags:          p.Tags,
-		Stock:         p.Stock,
-		DiscountType:  p.DiscountType,
-		DiscountValue: p.DiscountValue,
-		TotalSales:    p.TotalSales,
-		Variations:    variationSchemas,
-		Addons:        addonSchemas,
-		CategoryID:    p.CategoryID,
-		BranchID:      p.BranchID,
+		ID:              p.ID,
+		Title:           p.Title,
+		Slug:            p.Slug,
+		SKU:             p.SKU,
+		Barcode:         p.Barcode,
+		Price:           p.Price,
+		Image:           image,
+		Images:          imageSchemas,
+		Description:     p.Description,
+		Tags:            p.Tags,
+		Attributes:      attributes,
+		IsActive:        p.IsActive,
+		IsAvailable:     p.IsAvailable == nil || *p.IsAvailable,
+		PublishFrom:     p.PublishFrom,
+		PublishUntil:    p.PublishUntil,
+		StockType:       p.StockType,
+		Stock:           p.Stock,
+		DiscountType:    p.DiscountType,
+		DiscountValue:   p.DiscountValue,
+		TotalSales:      p.TotalSales,
+		Variations:      variationSchemas,
+		Addons:          addonSchemas,
+		CategoryID:      p.CategoryID,
+		CategoryIDs:     categoryIDs,
+		SubCategoryID:   p.SubCategoryID,
+		BranchID:        p.BranchID,
+		SourceProductID: p.SourceProductID,
+		TaxCategoryID:   p.TaxCategoryID,
 	}
 }
 func (v *ProductVariation) ToResponse() schemas.ProductVariationResponse {
@@ -100,10 +226,40 @@ func (v *ProductVariation) ToResponse() schemas.ProductVariationResponse {
 	}
 }
 
+func (i *ProductImage) ToResponse() schemas.ProductImageResponseSchema {
+	response := schemas.ProductImageResponseSchema{
+		ID:       i.ID,
+		MediaID:  i.MediaID,
+		URL:      i.URL,
+		AltText:  i.AltText,
+		Position: i.Position,
+	}
+	if i.Media != nil {
+		media := i.Media.ToResponse()
+		response.URL = media.URL
+		response.Thumbnails = media.Thumbnails
+	}
+	return response
+}
+
+func (bp *BranchProduct) ToResponse() schemas.BranchProductResponseSchema {
+	return schemas.BranchProductResponseSchema{
+		ProductID:   bp.ProductID,
+		BranchID:    bp.BranchID,
+		Price:       bp.Price,
+		StockType:   bp.StockType,
+		Stock:       bp.Stock,
+		DailyStock:  bp.DailyStock,
+		IsAvailable: bp.IsAvailable,
+		IsActive:    bp.IsActive,
+	}
+}
+
 func (a *Addon) ToResponse() schemas.AddonResponse {
 	return schemas.AddonResponse{
-		AddonID: a.ID,
-		Price:   a.Price,
-		Tax:     a.Tax,
+		AddonID:       a.ID,
+		Price:         a.Price,
+		Tax:           a.Tax,
+		TaxCategoryID: a.TaxCategoryID,
 	}
 }
@@ -1,15 +1,131 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"ecommerce/app/schemas"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
 
+// ShippingAddress is the immutable snapshot of the address an order is shipped to
 type ShippingAddress struct {
 	gorm.Model
-	AddressLine1 string `json:"address_line_1"`
-	AddressLine2 string `json:"address_line_2"`
-	City         string `json:"city"`
-	Country      string `json:"country"`
-	Postcode     string `json:"postcode"`
-	State        string `json:"state"`
+	AddressLine1 string   `json:"address_line_1"`
+	AddressLine2 string   `json:"address_line_2"`
+	City         string   `json:"city"`
+	Country      string   `json:"country"`
+	Postcode     string   `json:"postcode"`
+	State        string   `json:"state"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+
+	// the address book entry it was copied from, if any
+	AddressID *uint `json:"address_id"`
 
 	OrderID uint `json:"order_id"`
 }
+
+// Address is an entry of the user's address book
+type Address struct {
+	gorm.Model
+	Label        string   `gorm:"type:varchar(50)" json:"label"`
+	AddressLine1 string   `gorm:"not null" json:"address_line_1"`
+	AddressLine2 string   `json:"address_line_2"`
+	City         string   `gorm:"not null" json:"city"`
+	Country      string   `gorm:"not null" json:"country"`
+	Postcode     string   `gorm:"not null" json:"postcode"`
+	State        string   `json:"state"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	IsDefault    bool     `gorm:"default:false" json:"is_default"`
+
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (a *Address) ToResponse() schemas.AddressResponseSchema {
+	return schemas.AddressResponseSchema{
+		ID:           a.ID,
+		Label:        a.Label,
+		AddressLine1: a.AddressLine1,
+		AddressLine2: a.AddressLine2,
+		City:         a.City,
+		Country:      a.Country,
+		Postcode:     a.Postcode,
+		State:        a.State,
+		Latitude:     a.Latitude,
+		Longitude:    a.Longitude,
+		IsDefault:    a.IsDefault,
+	}
+}
+
+// ToShippingAddress copies the address book entry into an order snapshot
+func (a *Address) ToShippingAddress(orderID uint) ShippingAddress {
+	addressID := a.ID
+	return ShippingAddress{
+		AddressLine1: a.AddressLine1,
+		AddressLine2: a.AddressLine2,
+		City:         a.City,
+		Country:      a.Country,
+		Postcode:     a.Postcode,
+		State:        a.State,
+		Latitude:     a.Latitude,
+		Longitude:    a.Longitude,
+		AddressID:    &addressID,
+		OrderID:      orderID,
+	}
+}
+
+// DeliveryZone is an area a branch delivers to, matched by postcode list, radius around the branch or polygon
+type DeliveryZone struct {
+	gorm.Model
+	Name      string         `gorm:"type:varchar(50);not null" json:"name"`
+	Type      string         `gorm:"type:varchar(20);not null" json:"type"`
+	Postcodes pq.StringArray `gorm:"type:text[]" json:"postcodes"`
+	RadiusKm  float64        `json:"radius_km"`
+	// flattened lat, lng pairs of the polygon vertices
+	Polygon               pq.Float64Array `gorm:"type:double precision[]" json:"polygon"`
+	RateBasis             string          `gorm:"type:varchar(20);not null;default:'flat'" json:"rate_basis"`
+	FreeShippingThreshold float64         `gorm:"type:decimal(10,2);default:0" json:"free_shipping_threshold"`
+	Priority              int             `gorm:"default:0" json:"priority"`
+	IsActive              bool            `gorm:"default:true" json:"is_active"`
+
+	BranchID uint           `gorm:"not null;index" json:"branch_id"`
+	Rates    []ShippingRate `gorm:"foreignKey:DeliveryZoneID" json:"rates"`
+}
+
+// ShippingRate is a row of a zone rate table, MinValue <= measure < MaxValue (MaxValue 0 means no upper bound)
+type ShippingRate struct {
+	gorm.Model
+	MinValue     float64 `json:"min_value"`
+	MaxValue     float64 `json:"max_value"`
+	Price        float64 `gorm:"type:decimal(10,2);not null" json:"price"`
+	PricePerUnit float64 `gorm:"type:decimal(10,2);default:0" json:"price_per_unit"`
+
+	DeliveryZoneID uint `gorm:"not null;index" json:"delivery_zone_id"`
+}
+
+func (z *DeliveryZone) ToResponse() schemas.DeliveryZoneResponseSchema {
+	rates := make([]schemas.ShippingRateSchema, len(z.Rates))
+	for i, rate := range z.Rates {
+		rates[i] = schemas.ShippingRateSchema{
+			MinValue:     rate.MinValue,
+			MaxValue:     rate.MaxValue,
+			Price:        rate.Price,
+			PricePerUnit: rate.PricePerUnit,
+		}
+	}
+	return schemas.DeliveryZoneResponseSchema{
+		ID:                    z.ID,
+		BranchID:              z.BranchID,
+		Name:                  z.Name,
+		Type:                  z.Type,
+		Postcodes:             z.Postcodes,
+		RadiusKm:              z.RadiusKm,
+		Polygon:               z.Polygon,
+		RateBasis:             z.RateBasis,
+		FreeShippingThreshold: z.FreeShippingThreshold,
+		Priority:              z.Priority,
+		IsActive:              z.IsActive,
+		Rates:                 rates,
+	}
+}
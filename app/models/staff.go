@@ -0,0 +1,29 @@
+package models
+
+import (
+	"ecommerce/app/schemas"
+	"gorm.io/gorm"
+)
+
+// BranchStaff makes a user a member of a branch team, members can work the branch order queue
+type BranchStaff struct {
+	gorm.Model
+	Role string `gorm:"type:varchar(20);not null;default:'staff'" json:"role"`
+
+	BranchID uint   `gorm:"not null;uniqueIndex:idx_branch_staff_branch_user" json:"branch_id"`
+	Branch   Branch `gorm:"foreignKey:BranchID" json:"-"`
+
+	UserID uint `gorm:"not null;uniqueIndex:idx_branch_staff_branch_user" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (s *BranchStaff) ToResponse() schemas.BranchStaffResponseSchema {
+	return schemas.BranchStaffResponseSchema{
+		UserID:    s.UserID,
+		BranchID:  s.BranchID,
+		Role:      s.Role,
+		Email:     s.User.Email,
+		FirstName: s.User.FirstName,
+		LastName:  s.User.LastName,
+	}
+}
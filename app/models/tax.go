@@ -0,0 +1,63 @@
+package models
+
+import (
+	"ecommerce/app/schemas"
+	"gorm.io/gorm"
+	"math"
+)
+
+// TaxCategory groups products and addons taxed the same way (e.g. standard, reduced, food)
+type TaxCategory struct {
+	gorm.Model
+	Code  string    `gorm:"type:varchar(30);unique;not null" json:"code"`
+	Name  string    `gorm:"type:varchar(50);not null" json:"name"`
+	Rates []TaxRate `gorm:"foreignKey:TaxCategoryID" json:"rates"`
+}
+
+// TaxRate is the rate of a category for a branch, or for a region when BranchID is not set
+type TaxRate struct {
+	gorm.Model
+	Name          string  `gorm:"type:varchar(50);not null" json:"name"`
+	Rate          float64 `gorm:"type:decimal(6,3);not null" json:"rate"`
+	Region        string  `gorm:"type:varchar(20);index" json:"region"`
+	BranchID      *uint   `gorm:"index" json:"branch_id"`
+	TaxCategoryID uint    `gorm:"not null;index" json:"tax_category_id"`
+}
+
+// Compute splits an amount into its net part and its tax, the amount already includes the tax when inclusive is set
+func (r *TaxRate) Compute(amount float64, inclusive bool) (float64, float64) {
+	if inclusive {
+		net := RoundMoney(amount / (1 + r.Rate/100))
+		return net, RoundMoney(amount - net)
+	}
+	return amount, RoundMoney(amount * r.Rate / 100)
+}
+
+func (c *TaxCategory) ToResponse() schemas.TaxCategoryResponseSchema {
+	rates := make([]schemas.TaxRateResponseSchema, len(c.Rates))
+	for i, rate := range c.Rates {
+		rates[i] = rate.ToResponse()
+	}
+	return schemas.TaxCategoryResponseSchema{
+		ID:    c.ID,
+		Code:  c.Code,
+		Name:  c.Name,
+		Rates: rates,
+	}
+}
+
+func (r *TaxRate) ToResponse() schemas.TaxRateResponseSchema {
+	return schemas.TaxRateResponseSchema{
+		ID:            r.ID,
+		Name:          r.Name,
+		Rate:          r.Rate,
+		Region:        r.Region,
+		BranchID:      r.BranchID,
+		TaxCategoryID: r.TaxCategoryID,
+	}
+}
+
+// RoundMoney rounds an amount to the cent
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
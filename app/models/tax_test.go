@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestTaxRateCompute(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		amount    float64
+		inclusive bool
+		net       float64
+		tax       float64
+	}{
+		{name: "exclusive", rate: 20, amount: 100, net: 100, tax: 20},
+		{name: "exclusive rounds the tax", rate: 20, amount: 9.99, net: 9.99, tax: 2},
+		{name: "exclusive reduced rate", rate: 5.5, amount: 10, net: 10, tax: 0.55},
+		{name: "exclusive zero rate", rate: 0, amount: 10, net: 10, tax: 0},
+		{name: "exclusive zero amount", rate: 20, amount: 0, net: 0, tax: 0},
+		{name: "inclusive", rate: 20, amount: 120, inclusive: true, net: 100, tax: 20},
+		{name: "inclusive rounds the net", rate: 20, amount: 10, inclusive: true, net: 8.33, tax: 1.67},
+		{name: "inclusive reduced rate", rate: 5.5, amount: 10.55, inclusive: true, net: 10, tax: 0.55},
+		{name: "inclusive zero rate", rate: 0, amount: 10, inclusive: true, net: 10, tax: 0},
+		{name: "inclusive zero amount", rate: 20, amount: 0, inclusive: true, net: 0, tax: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := TaxRate{Rate: tt.rate}
+			net, tax := rate.Compute(tt.amount, tt.inclusive)
+			if net != tt.net || tax != tt.tax {
+				t.Errorf("got net %v and tax %v, want %v and %v", net, tax, tt.net, tt.tax)
+			}
+			// an inclusive amount is split, it never grows
+			if tt.inclusive && RoundMoney(net+tax) != tt.amount {
+				t.Errorf("net %v and tax %v don't add up to %v", net, tax, tt.amount)
+			}
+		})
+	}
+}
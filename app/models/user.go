@@ -8,13 +8,14 @@ import (
 
 type User struct {
 	gorm.Model
-	Email          string `gorm:"type:varchar(20);unique;index" json:"email"`
+	Email          string `gorm:"type:varchar(255);unique;index" json:"email"`
 	PhoneNumber    string `gorm:"type:varchar(20);unique" json:"phone_number"`
 	HashedPassword string
 	LastLogin      time.Time
 	FirstName      string
 	LastName       string
 	IsVerified     bool `gorm:"default:false"`
+	PhoneVerified  bool `gorm:"default:false" json:"phone_verified"`
 	IsSuperUser    bool `gorm:"default:false"`
 }
 
@@ -35,3 +36,42 @@ type PasswordResetToken struct {
 	UserID    uint
 	User      User
 }
+
+// EmailChangeRequest is a pending email change, applied once the link sent to the new address is confirmed
+type EmailChangeRequest struct {
+	UUID      uuid.UUID `gorm:"type:uuid;primary_key" json:"uuid"`
+	NewEmail  string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt time.Time
+	UserID    uint
+	User      User
+}
+
+// PhoneVerificationCode holds the pending OTP of a user, only the hash of the code is stored
+type PhoneVerificationCode struct {
+	UserID      uint `gorm:"primary_key"`
+	User        User
+	PhoneNumber string `gorm:"type:varchar(20);not null"`
+	CodeHash    string `gorm:"not null"`
+	Attempts    int    `gorm:"default:0"`
+	ExpiresAt   time.Time
+	LastSentAt  time.Time
+}
+
+// UserIdentity links an external OpenID Connect account (provider + subject) to a user
+type UserIdentity struct {
+	gorm.Model
+	Provider string `gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject  string `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email    string `json:"email"`
+	UserID   uint   `gorm:"not null;index" json:"user_id"`
+	User     User   `json:"-"`
+}
+
+// OIDCAuthState keeps the state, nonce and PKCE verifier of a pending social login
+type OIDCAuthState struct {
+	State        string `gorm:"primary_key"`
+	Provider     string `gorm:"type:varchar(50);not null"`
+	Nonce        string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"`
+	ExpiresAt    time.Time
+}
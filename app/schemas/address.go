@@ -0,0 +1,28 @@
+package schemas
+
+type AddressSchema struct {
+	Label        string   `json:"label" binding:"max=50"`
+	AddressLine1 string   `json:"address_line_1" binding:"required"`
+	AddressLine2 string   `json:"address_line_2"`
+	City         string   `json:"city" binding:"required"`
+	Country      string   `json:"country" binding:"required"`
+	Postcode     string   `json:"postcode" binding:"required"`
+	State        string   `json:"state"`
+	Latitude     *float64 `json:"latitude" binding:"required_with=Longitude,omitempty,latitude"`
+	Longitude    *float64 `json:"longitude" binding:"required_with=Latitude,omitempty,longitude"`
+	IsDefault    bool     `json:"is_default"`
+}
+
+type AddressResponseSchema struct {
+	ID           uint     `json:"id"`
+	Label        string   `json:"label"`
+	AddressLine1 string   `json:"address_line_1"`
+	AddressLine2 string   `json:"address_line_2"`
+	City         string   `json:"city"`
+	Country      string   `json:"country"`
+	Postcode     string   `json:"postcode"`
+	State        string   `json:"state"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	IsDefault    bool     `json:"is_default"`
+}
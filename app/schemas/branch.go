@@ -0,0 +1,123 @@
+package schemas
+
+import "time"
+
+type OpeningHourSchema struct {
+	// 0 is Sunday
+	Weekday  int    `json:"weekday" binding:"min=0,max=6"`
+	OpensAt  string `json:"opens_at" binding:"required,len=5"`
+	ClosesAt string `json:"closes_at" binding:"required,len=5"`
+}
+
+// BranchHoursSchema replaces the hours of a branch, the optional settings keep their current value when not set
+type BranchHoursSchema struct {
+	Timezone            string `json:"timezone" binding:"required,max=50"`
+	PickupLeadMinutes   *uint  `json:"pickup_lead_minutes" binding:"omitempty,max=1440"`
+	DeliveryLeadMinutes *uint  `json:"delivery_lead_minutes" binding:"omitempty,max=1440"`
+	SlotMinutes         uint   `json:"slot_minutes" binding:"required,min=5,max=240"`
+	// maximum scheduled orders per slot, 0 means unlimited
+	SlotCapacity *uint `json:"slot_capacity" binding:"omitempty,max=10000"`
+	// how long before their scheduled time scheduled orders are sent to the preparation queue
+	ReleaseLeadMinutes *uint               `json:"release_lead_minutes" binding:"omitempty,max=1440"`
+	OpeningHours       []OpeningHourSchema `json:"opening_hours" binding:"dive"`
+}
+
+type BranchHolidaySchema struct {
+	Date   string `json:"date" binding:"required,datetime=2006-01-02"`
+	Reason string `json:"reason" binding:"max=100"`
+}
+
+type BranchPauseSchema struct {
+	IsPaused bool `json:"is_paused"`
+	// optional end of the pause, the branch stays paused until resumed when not set
+	PausedUntil *time.Time `json:"paused_until"`
+}
+
+type BranchSlotsResponseSchema struct {
+	BranchID uint        `json:"branch_id"`
+	Timezone string      `json:"timezone"`
+	IsOpen   bool        `json:"is_open"`
+	Pickup   []time.Time `json:"pickup"`
+	Delivery []time.Time `json:"delivery"`
+}
+
+type BranchSchema struct {
+	Name             string   `json:"name" binding:"required,max=100"`
+	AddressLine1     string   `json:"address_line_1" binding:"required,max=255"`
+	AddressLine2     string   `json:"address_line_2" binding:"max=255"`
+	City             string   `json:"city" binding:"required,max=100"`
+	State            string   `json:"state" binding:"max=100"`
+	Postcode         string   `json:"postcode" binding:"required,max=20"`
+	Country          string   `json:"country" binding:"required,max=100"`
+	Latitude         *float64 `json:"latitude" binding:"required_with=Longitude,omitempty,latitude"`
+	Longitude        *float64 `json:"longitude" binding:"required_with=Latitude,omitempty,longitude"`
+	PhoneNumber      string   `json:"phone_number" binding:"omitempty,e164"`
+	Email            string   `json:"email" binding:"omitempty,email,max=255"`
+	Timezone         string   `json:"timezone" binding:"required,max=50"`
+	IsActive         *bool    `json:"is_active"`
+	TaxRegion        string   `json:"tax_region" binding:"max=20"`
+	PricesIncludeTax bool     `json:"prices_include_tax"`
+	// cancellation policy, the current values are kept when not set
+	CancelWindowMinutes        *uint `json:"cancel_window_minutes" binding:"omitempty,max=1440"`
+	CancelScheduledLeadMinutes *uint `json:"cancel_scheduled_lead_minutes" binding:"omitempty,max=10080"`
+}
+
+type BranchHolidayResponseSchema struct {
+	ID     uint   `json:"id"`
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+}
+
+type BranchResponseSchema struct {
+	ID                         uint                          `json:"id"`
+	Name                       string                        `json:"name"`
+	AddressLine1               string                        `json:"address_line_1"`
+	AddressLine2               string                        `json:"address_line_2"`
+	City                       string                        `json:"city"`
+	State                      string                        `json:"state"`
+	Postcode                   string                        `json:"postcode"`
+	Country                    string                        `json:"country"`
+	Latitude                   *float64                      `json:"latitude"`
+	Longitude                  *float64                      `json:"longitude"`
+	PhoneNumber                string                        `json:"phone_number"`
+	Email                      string                        `json:"email"`
+	Timezone                   string                        `json:"timezone"`
+	IsActive                   bool                          `json:"is_active"`
+	IsPaused                   bool                          `json:"is_paused"`
+	PausedUntil                *time.Time                    `json:"paused_until"`
+	PickupLeadMinutes          uint                          `json:"pickup_lead_minutes"`
+	DeliveryLeadMinutes        uint                          `json:"delivery_lead_minutes"`
+	SlotMinutes                uint                          `json:"slot_minutes"`
+	SlotCapacity               uint                          `json:"slot_capacity"`
+	ReleaseLeadMinutes         uint                          `json:"release_lead_minutes"`
+	CancelWindowMinutes        uint                          `json:"cancel_window_minutes"`
+	CancelScheduledLeadMinutes uint                          `json:"cancel_scheduled_lead_minutes"`
+	TaxRegion                  string                        `json:"tax_region"`
+	PricesIncludeTax           bool                          `json:"prices_include_tax"`
+	OpeningHours               []OpeningHourSchema           `json:"opening_hours"`
+	Holidays                   []BranchHolidayResponseSchema `json:"holidays"`
+	// distance from the searched point, only set by the nearest branches search
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+type NearestBranchesQuerySchema struct {
+	Latitude  *float64 `form:"latitude" binding:"required,latitude"`
+	Longitude *float64 `form:"longitude" binding:"required,longitude"`
+	RadiusKm  float64  `form:"radius_km" binding:"omitempty,min=0"`
+}
+
+type SlotSchema struct {
+	Start  time.Time `json:"start"`
+	Booked uint      `json:"booked"`
+	// not set when the branch slots have no capacity limit
+	Remaining *uint `json:"remaining"`
+	IsFull    bool  `json:"is_full"`
+}
+
+type SlotAvailabilityResponseSchema struct {
+	BranchID uint         `json:"branch_id"`
+	Date     string       `json:"date"`
+	Timezone string       `json:"timezone"`
+	Capacity uint         `json:"capacity"`
+	Slots    []SlotSchema `json:"slots"`
+}
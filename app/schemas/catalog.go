@@ -0,0 +1,110 @@
+package schemas
+
+import "time"
+
+// CatalogSchema is a branch catalog in the JSON import and export format
+type CatalogSchema struct {
+	Products []CatalogProductSchema `json:"products"`
+}
+
+// CatalogProductSchema is a product of a catalog, the products are matched by SKU within the branch and the
+// categories are referenced by slug, or by id for the categories without slug. The images are URLs, the
+// uploaded images are written media:<id>.
+type CatalogProductSchema struct {
+	SKU           string                   `json:"sku" binding:"required,max=64"`
+	Title         string                   `json:"title" binding:"required,min=2,max=255"`
+	Barcode       string                   `json:"barcode,omitempty" binding:"omitempty,numeric,min=8,max=14"`
+	Price         float64                  `json:"price" binding:"min=0"`
+	Description   string                   `json:"description,omitempty" binding:"max=5000"`
+	Tags          []string                 `json:"tags,omitempty" binding:"max=30,dive,max=50"`
+	Category      string                   `json:"category" binding:"required,max=255"`
+	Categories    []string                 `json:"categories,omitempty" binding:"max=20,dive,max=255"`
+	StockType     string                   `json:"stock_type" binding:"required,oneof=FIXED DAILY UNLIMITED"`
+	Stock         uint                     `json:"stock"`
+	DailyStock    uint                     `json:"daily_stock"`
+	DiscountType  string                   `json:"discount_type,omitempty" binding:"omitempty,oneof=percentage fixed"`
+	DiscountValue float64                  `json:"discount_value" binding:"min=0"`
+	Weight        float64                  `json:"weight" binding:"min=0"`
+	TaxCategoryID *uint                    `json:"tax_category_id,omitempty"`
+	IsActive      *bool                    `json:"is_active,omitempty"`
+	PublishFrom   *time.Time               `json:"publish_from,omitempty"`
+	PublishUntil  *time.Time               `json:"publish_until,omitempty"`
+	Images        []string                 `json:"images,omitempty" binding:"max=20,dive,max=2048"`
+	Attributes    []ProductAttributeSchema `json:"attributes,omitempty" binding:"max=50,dive"`
+	Addons        []CatalogAddonSchema     `json:"addons,omitempty" binding:"max=50,dive"`
+	Variations    []CatalogVariationSchema `json:"variations,omitempty" binding:"max=20,dive"`
+}
+
+// CatalogAddonSchema is an addon of a catalog product, the addons with the same title, price and tax category are shared
+type CatalogAddonSchema struct {
+	Title         string  `json:"title" binding:"required,max=255"`
+	Price         float64 `json:"price" binding:"min=0"`
+	TaxCategoryID *uint   `json:"tax_category_id,omitempty"`
+}
+
+// CatalogVariationSchema is a variation of a catalog product, the variations and their options are matched by title
+type CatalogVariationSchema struct {
+	Title         string                         `json:"title" binding:"required,max=255"`
+	Type          string                         `json:"type" binding:"max=50"`
+	MinSelections uint                           `json:"min_selections"`
+	MaxSelections uint                           `json:"max_selections"`
+	Required      bool                           `json:"required"`
+	Options       []CatalogVariationOptionSchema `json:"options" binding:"max=50,dive"`
+}
+
+type CatalogVariationOptionSchema struct {
+	Title string  `json:"title" binding:"required,max=255"`
+	Price float64 `json:"price" binding:"min=0"`
+}
+
+type CatalogImportQuerySchema struct {
+	BranchID uint `form:"branch_id" binding:"required"`
+	// the format is taken from the file extension when not set
+	Format string `form:"format" binding:"omitempty,oneof=csv json"`
+	DryRun bool   `form:"dry_run"`
+}
+
+type CatalogExportQuerySchema struct {
+	BranchID uint   `form:"branch_id" binding:"required"`
+	Format   string `form:"format" binding:"omitempty,oneof=csv json"`
+}
+
+// CatalogCopySchema copies the products of a branch to another one. The copies linked to their source are
+// matched by it and the others by SKU, so copying again syncs the products copied before, they keep their stock.
+type CatalogCopySchema struct {
+	SourceBranchID uint `json:"source_branch_id" binding:"required"`
+	TargetBranchID uint `json:"target_branch_id" binding:"required,nefield=SourceBranchID"`
+	// only these products of the source branch when set
+	ProductIDs []uint `json:"product_ids" binding:"max=5000"`
+	// applied to the product, option and addon prices, e.g. 10 for 10% more expensive
+	PriceAdjustmentPercent float64                      `json:"price_adjustment_percent" binding:"min=-90,max=1000"`
+	PriceOverrides         []CatalogPriceOverrideSchema `json:"price_overrides" binding:"max=5000,dive"`
+	// the new copies start without stock
+	ResetStock bool `json:"reset_stock"`
+	// keep a link from the copies to their source product
+	LinkSource bool `json:"link_source"`
+	DryRun     bool `json:"dry_run"`
+}
+
+// CatalogPriceOverrideSchema sets the price of the copy of a source product, instead of the adjusted price
+type CatalogPriceOverrideSchema struct {
+	ProductID uint    `json:"product_id" binding:"required"`
+	Price     float64 `json:"price" binding:"min=0"`
+}
+
+// CatalogRowErrorSchema gives the errors of a catalog row by field, the rows are numbered from 1 in the file order
+type CatalogRowErrorSchema struct {
+	Row int    `json:"row"`
+	SKU string `json:"sku"`
+	// the source product of the copies
+	ProductID uint                   `json:"product_id,omitempty"`
+	Errors    map[string]interface{} `json:"errors"`
+}
+
+// CatalogImportResultSchema reports an import or a copy, nothing is saved when there are errors or for a dry run
+type CatalogImportResultSchema struct {
+	DryRun  bool                    `json:"dry_run"`
+	Created int                     `json:"created"`
+	Updated int                     `json:"updated"`
+	Errors  []CatalogRowErrorSchema `json:"errors"`
+}
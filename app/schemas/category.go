@@ -0,0 +1,39 @@
+package schemas
+
+// CategorySchema creates or updates a category, the slug is made from the title when not set on creation
+// and kept when not set on update.
+// A category without a parent is a root category.
+type CategorySchema struct {
+	Title    string `json:"title" binding:"required,max=100"`
+	Slug     string `json:"slug" binding:"max=255"`
+	ParentID *uint  `json:"parent_id"`
+	// position among its siblings, new categories are added last when not set
+	Position *int   `json:"position" binding:"omitempty,min=0"`
+	Image    string `json:"image" binding:"omitempty,url,max=2048"`
+	// uploaded image, it wins over the image URL
+	MediaID *uint `json:"media_id"`
+}
+
+// CategoryReorderSchema moves categories under a parent, in the given order
+type CategoryReorderSchema struct {
+	ParentID    *uint  `json:"parent_id"`
+	CategoryIDs []uint `json:"category_ids" binding:"required,min=1,max=500"`
+}
+
+type CategoryResponseSchema struct {
+	ID       uint    `json:"id"`
+	Title    string  `json:"title"`
+	Slug     *string `json:"slug"`
+	ParentID *uint   `json:"parent_id"`
+	Position int     `json:"position"`
+	Image    string  `json:"image"`
+	MediaID  *uint   `json:"media_id"`
+}
+
+// CategoryTreeSchema is a node of the category tree, ProductCount counts the published products
+// of the category and of all its descendants, each product once
+type CategoryTreeSchema struct {
+	CategoryResponseSchema
+	ProductCount int64                `json:"product_count"`
+	Children     []CategoryTreeSchema `json:"children"`
+}
@@ -0,0 +1,15 @@
+package schemas
+
+import "time"
+
+type MediaResponseSchema struct {
+	ID          uint   `json:"id"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	// thumbnail URLs by size name (small, medium, large)
+	Thumbnails map[string]string `json:"thumbnails"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
@@ -17,34 +17,112 @@ type ShippingAddressSchema struct {
 	Country      string `json:"country"  binding:"required"`
 	Postcode     string `json:"postcode" binding:"required"`
 	State        string `json:"state" binding:"required"`
+
+	Latitude  *float64 `json:"latitude" binding:"required_with=Longitude,omitempty,latitude"`
+	Longitude *float64 `json:"longitude" binding:"required_with=Latitude,omitempty,longitude"`
 }
 
 type OrderCreationSchema struct {
-	Products        []OrderItemSchema     `json:"products" binding:"required"`
-	OrderType       string                `json:"order_type" binding:"required"`
-	BranchID        uint                  `json:"branch_id" binding:"required"`
-	IsScheduled     bool                  `json:"is_scheduled"`
-	ScheduleAt      time.Time             `json:"schedule_time"`
-	ShippingAddress ShippingAddressSchema `json:"shipping_address"`
-	Payment         NewPaymentSchema      `json:"payment" binding:"required"`
-	CouponCode      string                `json:"coupon_code"`
+	Products    []OrderItemSchema `json:"products" binding:"required"`
+	OrderType   string            `json:"order_type" binding:"required"`
+	BranchID    uint              `json:"branch_id" binding:"required"`
+	IsScheduled bool              `json:"is_scheduled"`
+	ScheduleAt  time.Time         `json:"schedule_time"`
+	// shipping orders use either a saved address (shipping_address_id) or an inline one
+	ShippingAddressID *uint                  `json:"shipping_address_id"`
+	ShippingAddress   *ShippingAddressSchema `json:"shipping_address"`
+	Payment           NewPaymentSchema       `json:"payment" binding:"required"`
+	CouponCode        string                 `json:"coupon_code"`
 }
 
 type OrderResponseSchema struct {
-	ID           uint              `json:"id"`
-	Status       string            `json:"status"`
-	Type         string            `json:"type"`
-	Total        float64           `json:"total"`
-	SubTotal     float64           `json:"sub_total"`
-	IsPaid       bool              `json:"is_paid"`
-	IsScheduled  bool              `json:"is_scheduled"`
-	ScheduleTime time.Time         `json:"schedule_time"`
-	UserID       uint              `json:"user_id"`
-	BranchID     uint              `json:"branch_id"`
-	Products     []OrderItemSchema `json:"products"`
-}
-
-type UpdateOrderStatusSchema struct {
-	Status  string `json:"status" binding:"required"`
-	OrderID uint   `json:"order_id" binding:"required"`
+	ID               uint                       `json:"id"`
+	Status           string                     `json:"status"`
+	Type             string                     `json:"type"`
+	Total            float64                    `json:"total"`
+	SubTotal         float64                    `json:"sub_total"`
+	Discount         float64                    `json:"discount"`
+	ShippingFee      float64                    `json:"shipping_fee"`
+	TaxTotal         float64                    `json:"tax_total"`
+	Taxes            []TaxLineSchema            `json:"taxes"`
+	PricesIncludeTax bool                       `json:"prices_include_tax"`
+	IsPaid           bool                       `json:"is_paid"`
+	IsScheduled      bool                       `json:"is_scheduled"`
+	ScheduleTime     time.Time                  `json:"schedule_time"`
+	UserID           uint                       `json:"user_id"`
+	BranchID         uint                       `json:"branch_id"`
+	Products         []OrderItemResponseSchema  `json:"products"`
+	History          []OrderStatusHistorySchema `json:"history"`
+}
+
+type OrderStatusHistorySchema struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type CancelOrderSchema struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+type TaxLineSchema struct {
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	Amount        float64 `json:"amount"`
+}
+
+type OrderItemResponseSchema struct {
+	ProductID  uint                     `json:"product_id"`
+	Quantity   uint                     `json:"quantity"`
+	UnitPrice  float64                  `json:"unit_price"`
+	TotalPrice float64                  `json:"total_price"`
+	TaxAmount  float64                  `json:"tax_amount"`
+	Taxes      []TaxLineSchema          `json:"taxes"`
+	Addons     []AddonSchema            `json:"addons"`
+	Variations []ProductVariationSchema `json:"variation"`
+}
+
+// PlaceAgainSchema places a past order or a favourite order again, the items come from the stored order
+type PlaceAgainSchema struct {
+	// defaults to the type of the stored order
+	OrderType         string                 `json:"order_type" binding:"omitempty,oneof=pickup shipping"`
+	IsScheduled       bool                   `json:"is_scheduled"`
+	ScheduleAt        time.Time              `json:"schedule_time"`
+	ShippingAddressID *uint                  `json:"shipping_address_id"`
+	ShippingAddress   *ShippingAddressSchema `json:"shipping_address"`
+	Payment           NewPaymentSchema       `json:"payment" binding:"required"`
+	CouponCode        string                 `json:"coupon_code"`
+	// places the order without the items that are no longer available instead of failing
+	SkipUnavailable bool `json:"skip_unavailable"`
+}
+
+type UnavailableItemSchema struct {
+	ProductID uint   `json:"product_id"`
+	Quantity  uint   `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+type ReorderResponseSchema struct {
+	Order            OrderCreationSchema     `json:"order"`
+	UnavailableItems []UnavailableItemSchema `json:"unavailable_items"`
+}
+
+type FavouriteOrderSchema struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// copies the items, branch and type of a past order, the other fields are ignored when set
+	OrderID   *uint             `json:"order_id"`
+	BranchID  uint              `json:"branch_id" binding:"required_without=OrderID"`
+	OrderType string            `json:"order_type" binding:"required_without=OrderID,omitempty,oneof=pickup shipping"`
+	Products  []OrderItemSchema `json:"products" binding:"required_without=OrderID,dive"`
+}
+
+type FavouriteOrderResponseSchema struct {
+	ID        uint              `json:"id"`
+	Name      string            `json:"name"`
+	BranchID  uint              `json:"branch_id"`
+	OrderType string            `json:"order_type"`
+	Products  []OrderItemSchema `json:"products"`
+	CreatedAt time.Time         `json:"created_at"`
 }
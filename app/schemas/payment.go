@@ -1,11 +1,11 @@
 package schemas
 
+// NewPaymentSchema links the gateway payment intent of an order, the amount is the order total and the payment
+// only succeeds once the gateway confirms it
 type NewPaymentSchema struct {
-	Amount              float64 `json:"amount" binding:"required"`
-	Currency            string  `json:"currency" binding:"required"`
-	Status              string  `json:"status" binding:"required"`
-	Gateway             string  `json:"gateway" binding:"required"`
-	PaymentIntentID     string  `json:"payment_intent_id" binding:"required"`
-	PaymentClientSecret string  `json:"payment_client_secret" binding:"required"`
-	ReceiptEmail        string  `json:"receipt_email" binding:"required"`
+	Currency            string `json:"currency" binding:"required"`
+	Gateway             string `json:"gateway" binding:"required"`
+	PaymentIntentID     string `json:"payment_intent_id" binding:"required"`
+	PaymentClientSecret string `json:"payment_client_secret" binding:"required"`
+	ReceiptEmail        string `json:"receipt_email" binding:"required"`
 }
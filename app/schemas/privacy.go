@@ -0,0 +1,71 @@
+package schemas
+
+import "time"
+
+type ExportProfileSchema struct {
+	ID            uint      `json:"id"`
+	Email         string    `json:"email"`
+	PhoneNumber   string    `json:"phone_number"`
+	FirstName     string    `json:"first_name"`
+	LastName      string    `json:"last_name"`
+	IsVerified    bool      `json:"is_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
+	LastLogin     time.Time `json:"last_login"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportPaymentSchema only holds payment metadata, secrets are never exported
+type ExportPaymentSchema struct {
+	ID              uint      `json:"id"`
+	OrderID         uint      `json:"order_id"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency"`
+	Status          string    `json:"status"`
+	Gateway         string    `json:"gateway"`
+	PaymentIntentID string    `json:"payment_intent_id"`
+	ReceiptEmail    string    `json:"receipt_email"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ExportReviewSchema struct {
+	ID        uint      `json:"id"`
+	ProductID uint      `json:"product_id"`
+	Rating    uint      `json:"rating"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportAddressSchema covers both order shipping addresses and address book entries (no order_id)
+type ExportAddressSchema struct {
+	ID           uint   `json:"id"`
+	OrderID      uint   `json:"order_id,omitempty"`
+	Label        string `json:"label,omitempty"`
+	AddressLine1 string `json:"address_line_1"`
+	AddressLine2 string `json:"address_line_2"`
+	City         string `json:"city"`
+	Country      string `json:"country"`
+	Postcode     string `json:"postcode"`
+	State        string `json:"state"`
+}
+
+type ExportNotificationSchema struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserDataExportSchema struct {
+	GeneratedAt   time.Time                  `json:"generated_at"`
+	Profile       ExportProfileSchema        `json:"profile"`
+	Orders        []OrderResponseSchema      `json:"orders"`
+	Payments      []ExportPaymentSchema      `json:"payments"`
+	Reviews       []ExportReviewSchema       `json:"reviews"`
+	Addresses     []ExportAddressSchema      `json:"addresses"`
+	Notifications []ExportNotificationSchema `json:"notifications"`
+}
+
+type DataExportRequestSchema struct {
+	Format string `json:"format" binding:"omitempty,oneof=json zip"`
+}
@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type AddonSchema struct {
 	AddonID  uint `json:"id" binding:"required"`
 	Quantity uint `json:"quantity" binding:"required"`
@@ -8,7 +10,9 @@ type AddonSchema struct {
 type AddonResponse struct {
 	AddonID uint    `json:"id"`
 	Price   float64 `json:"price"`
-	Tax     float64 `json:"tax"`
+	// Deprecated: use TaxCategoryID, the flat tax is no longer charged
+	Tax           float64 `json:"tax"`
+	TaxCategoryID *uint   `json:"tax_category_id"`
 }
 
 type VariationOptionSchema struct {
@@ -24,18 +28,179 @@ type ProductVariationResponse struct {
 	ProductVariationID uint `json:"id"`
 }
 
+// ProductAttributeSchema is a typed product attribute, e.g. the allergens (list), the calories (number)
+// or the dimensions (text), the value must match the type
+type ProductAttributeSchema struct {
+	Name  string      `json:"name" binding:"required,max=50"`
+	Type  string      `json:"type" binding:"required,oneof=text number boolean list"`
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit" binding:"max=20"`
+}
+
+// ProductImageSchema is an image of a product, either an uploaded media file or an external URL
+type ProductImageSchema struct {
+	MediaID *uint  `json:"media_id"`
+	URL     string `json:"url" binding:"required_without=MediaID,omitempty,url,max=2048"`
+	AltText string `json:"alt_text" binding:"max=255"`
+}
+
+type ProductImageResponseSchema struct {
+	ID       uint   `json:"id"`
+	MediaID  *uint  `json:"media_id"`
+	URL      string `json:"url"`
+	AltText  string `json:"alt_text"`
+	Position int    `json:"position"`
+	// thumbnail URLs by size name, only for the uploaded images
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+}
+
+// ProductSchema creates or updates a product, the slug is made from the title when not set on creation
+// and kept when not set on update, the images are kept in the given order
+type ProductSchema struct {
+	Title         string                   `json:"title" binding:"required,min=2,max=255"`
+	Slug          string                   `json:"slug" binding:"max=255"`
+	SKU           string                   `json:"sku" binding:"max=64"`
+	Barcode       string                   `json:"barcode" binding:"omitempty,numeric,min=8,max=14"`
+	Price         float64                  `json:"price" binding:"min=0"`
+	Description   string                   `json:"description" binding:"max=5000"`
+	Tags          []string                 `json:"tags" binding:"max=30,dive,max=50"`
+	Images        []ProductImageSchema     `json:"images" binding:"max=20,dive"`
+	Attributes    []ProductAttributeSchema `json:"attributes" binding:"max=50,dive"`
+	IsActive      *bool                    `json:"is_active"`
+	PublishFrom   *time.Time               `json:"publish_from"`
+	PublishUntil  *time.Time               `json:"publish_until"`
+	StockType     string                   `json:"stock_type" binding:"required,oneof=FIXED DAILY UNLIMITED"`
+	Stock         uint                     `json:"stock"`
+	DailyStock    uint                     `json:"daily_stock"`
+	DiscountType  string                   `json:"discount_type" binding:"omitempty,oneof=percentage fixed"`
+	DiscountValue float64                  `json:"discount_value" binding:"min=0"`
+	Weight        float64                  `json:"weight" binding:"min=0"`
+	TaxCategoryID *uint                    `json:"tax_category_id"`
+	CategoryID    uint                     `json:"category_id" binding:"required"`
+	CategoryIDs   []uint                   `json:"category_ids" binding:"max=20"`
+	SubCategoryID *uint                    `json:"sub_category_id"`
+	// a shared product, sold by the branches through their branch products, when not set
+	BranchID *uint  `json:"branch_id"`
+	AddonIDs []uint `json:"addon_ids"`
+}
+
+// BranchProductSchema sets the price, stock and flags of a shared product in a branch
+type BranchProductSchema struct {
+	BranchID uint `json:"branch_id" binding:"required"`
+	// the product price is used when not set
+	Price       *float64 `json:"price" binding:"omitempty,min=0"`
+	StockType   string   `json:"stock_type" binding:"required,oneof=FIXED DAILY UNLIMITED"`
+	Stock       uint     `json:"stock"`
+	DailyStock  uint     `json:"daily_stock"`
+	IsAvailable *bool    `json:"is_available"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+type BranchProductResponseSchema struct {
+	ProductID   uint     `json:"product_id"`
+	BranchID    uint     `json:"branch_id"`
+	Price       *float64 `json:"price"`
+	StockType   string   `json:"stock_type"`
+	Stock       uint     `json:"stock"`
+	DailyStock  uint     `json:"daily_stock"`
+	IsAvailable bool     `json:"is_available"`
+	IsActive    bool     `json:"is_active"`
+}
+
 type ProductResponseSchema struct {
-	ID            uint                       `json:"id"`
-	Price         float64                    `json:"price"`
-	Image         string                     `json:"image"`
-	Description   string                     `json:"description"`
-	Tags          []string                   `json:"tags"`
-	Stock         uint                       `json:"stock"`
-	DiscountType  string                     `json:"discount_type"`
-	DiscountValue float64                    `json:"discount_value"`
-	TotalSales    uint                       `json:"total_sales"`
-	Variations    []ProductVariationResponse `json:"variations"`
-	Addons        []AddonResponse            `json:"addons"`
-	CategoryID    uint                       `json:"category_id"`
-	BranchID      uint                       `json:"branch_id"`
+	ID            uint                         `json:"id"`
+	Title         string                       `json:"title"`
+	Slug          *string                      `json:"slug"`
+	SKU           *string                      `json:"sku"`
+	Barcode       *string                      `json:"barcode"`
+	Price         float64                      `json:"price"`
+	Image         string                       `json:"image"`
+	Images        []ProductImageResponseSchema `json:"images"`
+	Description   string                       `json:"description"`
+	Tags          []string                     `json:"tags"`
+	Attributes    []ProductAttributeSchema     `json:"attributes"`
+	IsActive      bool                         `json:"is_active"`
+	IsAvailable   bool                         `json:"is_available"`
+	PublishFrom   *time.Time                   `json:"publish_from"`
+	PublishUntil  *time.Time                   `json:"publish_until"`
+	StockType     string                       `json:"stock_type"`
+	Stock         uint                         `json:"stock"`
+	DiscountType  string                       `json:"discount_type"`
+	DiscountValue float64                      `json:"discount_value"`
+	TotalSales    uint                         `json:"total_sales"`
+	Variations    []ProductVariationResponse   `json:"variations"`
+	Addons        []AddonResponse              `json:"addons"`
+	CategoryID    uint                         `json:"category_id"`
+	CategoryIDs   []uint                       `json:"category_ids"`
+	SubCategoryID *uint                        `json:"sub_category_id"`
+	// not set for the shared products
+	BranchID *uint `json:"branch_id"`
+	// the product it was copied from in another branch, for the syncs
+	SourceProductID *uint `json:"source_product_id"`
+	TaxCategoryID   *uint `json:"tax_category_id"`
+}
+
+type ProductSearchQuerySchema struct {
+	Query      string `form:"q" binding:"required,max=200"`
+	BranchID   *uint  `form:"branch_id"`
+	CategoryID *uint  `form:"category_id"`
+}
+
+type ProductSearchResultSchema struct {
+	Product ProductResponseSchema `json:"product"`
+	Rank    float64               `json:"rank"`
+	// matching text with the matched words wrapped in <mark></mark>
+	Snippet string `json:"snippet"`
+}
+
+type AutocompleteQuerySchema struct {
+	Query    string `form:"q" binding:"required,max=100"`
+	BranchID *uint  `form:"branch_id"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=20"`
+}
+
+// ProductListQuerySchema filters the product list, the multi-select filters are repeated query parameters
+// (e.g. category_id=1&category_id=2) and match any of their values
+type ProductListQuerySchema struct {
+	CategoryIDs    []uint   `form:"category_id"`
+	SubCategoryIDs []uint   `form:"subcategory_id"`
+	BranchIDs      []uint   `form:"branch_id"`
+	Tags           []string `form:"tag"`
+	MinPrice       *float64 `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice       *float64 `form:"max_price" binding:"omitempty,min=0"`
+	Search         string   `form:"search" binding:"max=200"`
+	InStock        bool     `form:"in_stock"`
+	OnSale         bool     `form:"on_sale"`
+	MinRating      *float64 `form:"min_rating" binding:"omitempty,min=1,max=5"`
+	SortBy         string   `form:"sort_by" binding:"max=100"`
+	SortOrder      string   `form:"sort_order" binding:"omitempty,oneof=asc desc ASC DESC"`
+}
+
+type FacetValueSchema struct {
+	// id of the category or branch, not set for tags
+	ID    uint   `json:"id,omitempty"`
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceBucketSchema struct {
+	Min float64 `json:"min"`
+	// not set for the last bucket
+	Max   *float64 `json:"max"`
+	Count int64    `json:"count"`
+}
+
+type ProductFacetsSchema struct {
+	Categories []FacetValueSchema  `json:"categories"`
+	Tags       []FacetValueSchema  `json:"tags"`
+	Branches   []FacetValueSchema  `json:"branches"`
+	Prices     []PriceBucketSchema `json:"prices"`
+}
+
+type ProductListResponseSchema struct {
+	Data       []ProductResponseSchema `json:"data"`
+	NextCursor string                  `json:"next_cursor"`
+	HasMore    bool                    `json:"has_more"`
+	Total      *int64                  `json:"total,omitempty"`
+	Facets     ProductFacetsSchema     `json:"facets"`
 }
@@ -0,0 +1,59 @@
+package schemas
+
+type ShippingRateSchema struct {
+	MinValue     float64 `json:"min_value" binding:"min=0"`
+	MaxValue     float64 `json:"max_value" binding:"min=0"`
+	Price        float64 `json:"price" binding:"min=0"`
+	PricePerUnit float64 `json:"price_per_unit" binding:"min=0"`
+}
+
+type DeliveryZoneSchema struct {
+	BranchID              uint                 `json:"branch_id" binding:"required"`
+	Name                  string               `json:"name" binding:"required,max=50"`
+	Type                  string               `json:"type" binding:"required,oneof=postcode radius polygon"`
+	Postcodes             []string             `json:"postcodes" binding:"required_if=Type postcode"`
+	RadiusKm              float64              `json:"radius_km" binding:"required_if=Type radius,min=0"`
+	Polygon               []float64            `json:"polygon" binding:"required_if=Type polygon"`
+	RateBasis             string               `json:"rate_basis" binding:"required,oneof=flat distance weight order_value"`
+	FreeShippingThreshold float64              `json:"free_shipping_threshold" binding:"min=0"`
+	Priority              int                  `json:"priority"`
+	IsActive              *bool                `json:"is_active"`
+	Rates                 []ShippingRateSchema `json:"rates" binding:"required,min=1,dive"`
+}
+
+type DeliveryZoneResponseSchema struct {
+	ID                    uint                 `json:"id"`
+	BranchID              uint                 `json:"branch_id"`
+	Name                  string               `json:"name"`
+	Type                  string               `json:"type"`
+	Postcodes             []string             `json:"postcodes"`
+	RadiusKm              float64              `json:"radius_km"`
+	Polygon               []float64            `json:"polygon"`
+	RateBasis             string               `json:"rate_basis"`
+	FreeShippingThreshold float64              `json:"free_shipping_threshold"`
+	Priority              int                  `json:"priority"`
+	IsActive              bool                 `json:"is_active"`
+	Rates                 []ShippingRateSchema `json:"rates"`
+}
+
+type ShippingQuoteItemSchema struct {
+	ProductID  uint                     `json:"product_id" binding:"required"`
+	Quantity   uint                     `json:"quantity" binding:"required"`
+	Addons     []AddonSchema            `json:"addons"`
+	Variations []ProductVariationSchema `json:"variation"`
+}
+
+type ShippingQuoteSchema struct {
+	BranchID          uint                      `json:"branch_id" binding:"required"`
+	ShippingAddressID *uint                     `json:"shipping_address_id"`
+	ShippingAddress   *ShippingAddressSchema    `json:"shipping_address"`
+	Products          []ShippingQuoteItemSchema `json:"products" binding:"dive"`
+}
+
+type ShippingQuoteResponseSchema struct {
+	DeliveryZoneID uint    `json:"delivery_zone_id"`
+	ZoneName       string  `json:"zone_name"`
+	ShippingFee    float64 `json:"shipping_fee"`
+	FreeShipping   bool    `json:"free_shipping"`
+	DistanceKm     float64 `json:"distance_km,omitempty"`
+}
@@ -0,0 +1,77 @@
+package schemas
+
+import "time"
+
+type BranchStaffSchema struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required,oneof=staff manager"`
+}
+
+type BranchStaffResponseSchema struct {
+	UserID    uint   `json:"user_id"`
+	BranchID  uint   `json:"branch_id"`
+	Role      string `json:"role"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type BranchOrdersQuerySchema struct {
+	// comma separated list of statuses, e.g. pending,paid
+	Status string `form:"status"`
+	Type   string `form:"type" binding:"omitempty,oneof=pickup shipping"`
+	// creation date range
+	From time.Time `form:"from"`
+	To   time.Time `form:"to"`
+	// scheduled time range, only matches scheduled orders
+	ScheduledFrom time.Time `form:"scheduled_from"`
+	ScheduledTo   time.Time `form:"scheduled_to"`
+	IsScheduled   *bool     `form:"is_scheduled"`
+}
+
+// BulkOrderStatusSchema moves orders of a branch to a status, orders only become paid through their payment
+type BulkOrderStatusSchema struct {
+	OrderIDs []uint `json:"order_ids" binding:"required,min=1,max=100"`
+	Status   string `json:"status" binding:"required,oneof=preparing ready shipped completed cancelled"`
+}
+
+type QueueOptionSchema struct {
+	VariationOptionID uint   `json:"variation_option_id"`
+	Title             string `json:"title"`
+}
+
+type QueueVariationSchema struct {
+	ProductVariationID uint                `json:"product_variation_id"`
+	Title              string              `json:"title"`
+	Options            []QueueOptionSchema `json:"options"`
+}
+
+type QueueAddonSchema struct {
+	AddonID  uint   `json:"addon_id"`
+	Title    string `json:"title"`
+	Quantity uint   `json:"quantity"`
+}
+
+type QueueItemSchema struct {
+	ProductID  uint                   `json:"product_id"`
+	Quantity   uint                   `json:"quantity"`
+	Variations []QueueVariationSchema `json:"variations"`
+	Addons     []QueueAddonSchema     `json:"addons"`
+}
+
+// QueueOrderResponseSchema is an order as shown on the branch preparation board
+type QueueOrderResponseSchema struct {
+	ID              uint                   `json:"id"`
+	Status          string                 `json:"status"`
+	Type            string                 `json:"type"`
+	IsPaid          bool                   `json:"is_paid"`
+	Total           float64                `json:"total"`
+	IsScheduled     bool                   `json:"is_scheduled"`
+	ScheduleTime    time.Time              `json:"schedule_time"`
+	ReleasedAt      *time.Time             `json:"released_at"`
+	CreatedAt       time.Time              `json:"created_at"`
+	CustomerName    string                 `json:"customer_name"`
+	CustomerPhone   string                 `json:"customer_phone"`
+	ShippingAddress *ShippingAddressSchema `json:"shipping_address,omitempty"`
+	Items           []QueueItemSchema      `json:"items"`
+}
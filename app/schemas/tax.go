@@ -0,0 +1,30 @@
+package schemas
+
+type TaxCategorySchema struct {
+	Code string `json:"code" binding:"required,max=30"`
+	Name string `json:"name" binding:"required,max=50"`
+}
+
+type TaxRateSchema struct {
+	Name          string  `json:"name" binding:"required,max=50"`
+	Rate          float64 `json:"rate" binding:"min=0,max=100"`
+	Region        string  `json:"region" binding:"max=20"`
+	BranchID      *uint   `json:"branch_id"`
+	TaxCategoryID uint    `json:"tax_category_id" binding:"required"`
+}
+
+type TaxRateResponseSchema struct {
+	ID            uint    `json:"id"`
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	Region        string  `json:"region"`
+	BranchID      *uint   `json:"branch_id"`
+	TaxCategoryID uint    `json:"tax_category_id"`
+}
+
+type TaxCategoryResponseSchema struct {
+	ID    uint                    `json:"id"`
+	Code  string                  `json:"code"`
+	Name  string                  `json:"name"`
+	Rates []TaxRateResponseSchema `json:"rates"`
+}
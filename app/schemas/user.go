@@ -27,6 +27,10 @@ type UserChangePasswordSchema struct {
 type UpdateUserRequest struct {
 	FirstName   *string `json:"first_name"`
 	LastName    *string `json:"last_name"`
-	Email       *string `json:"email"`
-	PhoneNumber *string `json:"phone_number"`
+	Email       *string `json:"email" binding:"omitempty,email"`
+	PhoneNumber *string `json:"phone_number" binding:"omitempty,e164"`
+}
+
+type VerifyPhoneSchema struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
 }
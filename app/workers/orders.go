@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"ecommerce/app/crud/orders"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// StartScheduledOrderWorker periodically releases the due scheduled orders to their branch preparation queue
+func StartScheduledOrderWorker(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := orders.ReleaseDueScheduledOrders(db); err != nil {
+				log.Printf("Error releasing scheduled orders: %s", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// StartRefundWorker periodically retries the refunds of the cancelled orders that didn't go through
+func StartRefundWorker(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := orders.RefundPendingPayments(db); err != nil {
+				log.Printf("Error refunding payments: %s", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
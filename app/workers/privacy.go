@@ -0,0 +1,29 @@
+package workers
+
+import (
+	"ecommerce/app/crud"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// StartPrivacyWorker periodically generates the requested data exports, processes due account deletions
+// and removes expired data exports
+func StartPrivacyWorker(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := crud.ProcessPendingDataExports(db); err != nil {
+				log.Printf("Error generating data exports: %s", err)
+			}
+			if err := crud.ProcessDueAccountDeletions(db); err != nil {
+				log.Printf("Error processing account deletions: %s", err)
+			}
+			if err := crud.CleanupExpiredDataExports(db); err != nil {
+				log.Printf("Error cleaning up data exports: %s", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"ecommerce/app/commands"
 	"ecommerce/app/core"
 	"ecommerce/app/core/middlewares"
+	"ecommerce/app/core/realtime"
+	"ecommerce/app/core/search"
+	"ecommerce/app/core/storage"
 	v1 "ecommerce/app/endpoints/v1"
+	"ecommerce/app/workers"
 	_ "ecommerce/docs"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"golang.org/x/time/rate"
 	"log"
+	"os"
+	"time"
+	// embedded zoneinfo for the branch timezones
+	_ "time/tzdata"
 )
 
 // @title Go Ecommerce API
@@ -22,8 +31,9 @@ import (
 // @name Authorization
 // @description "JWT token required. Format: Bearer {token}"
 func main() {
-	// define Gin
-	r := gin.Default()
+	// define Gin, the logger leaves out the access tokens of the SSE query strings
+	r := gin.New()
+	r.Use(middlewares.Logger(), gin.Recovery())
 
 	// Init DB
 	if err := core.InitDB(); err != nil {
@@ -31,6 +41,37 @@ func main() {
 		return
 	}
 
+	// Product search index (Postgres full-text search unless another index is set)
+	if err := search.Setup(core.GetDB()); err != nil {
+		log.Fatalf("failed to set up the search index: %v", err)
+	}
+
+	// Uploaded files go to the local media directory unless STORAGE_BACKEND=s3
+	if err := storage.ConfigureFromEnv(); err != nil {
+		log.Fatalf("failed to configure the media storage: %v", err)
+	}
+
+	// Command line tools run instead of the server, e.g. `go run . catalog import -branch 1 menu.csv`
+	if len(os.Args) > 1 {
+		if err := commands.Run(core.GetDB(), os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Real-time events go through Postgres LISTEN/NOTIFY so every replica gets them,
+	// REALTIME_BACKEND=memory keeps them in process for a single instance
+	if os.Getenv("REALTIME_BACKEND") != "memory" {
+		if err := realtime.UsePostgres(core.DSN()); err != nil {
+			log.Fatalf("failed to start the realtime listener: %v", err)
+		}
+	}
+
+	// Start the background workers
+	workers.StartPrivacyWorker(core.GetDB(), time.Minute)
+	workers.StartScheduledOrderWorker(core.GetDB(), time.Minute)
+	workers.StartRefundWorker(core.GetDB(), 5*time.Minute)
+
 	// Apply rate limiting to all routes
 	// Allow 5 requests per second with a burst of 10
 	r.Use(middlewares.RateLimitMiddleware(rate.Limit(5), 10))
@@ -44,7 +85,13 @@ func main() {
 	v1.ProductsRouter(r)
 	v1.CategoriesRouter(r)
 	v1.BranchesRouter(r)
+	v1.BranchStaffRouter(r)
 	v1.CouponsRouter(r)
+	v1.AddressesRouter(r)
+	v1.ShippingRouter(r)
+	v1.TaxesRouter(r)
+	v1.EventsRouter(r)
+	v1.MediaRouter(r)
 
 	// Start the server
 	if err := r.Run(":8080"); err != nil {